@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/WeTrustPlatform/account-indexer/common"
+	"github.com/WeTrustPlatform/account-indexer/common/config"
+	"github.com/WeTrustPlatform/account-indexer/fetcher"
+	"github.com/WeTrustPlatform/account-indexer/http"
+	"github.com/WeTrustPlatform/account-indexer/indexer"
+	"github.com/WeTrustPlatform/account-indexer/repository/keyvalue"
+	"github.com/WeTrustPlatform/account-indexer/service"
+	log "github.com/sirupsen/logrus"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var logLevels = map[string]log.Level{
+	"":      log.InfoLevel,
+	"panic": log.PanicLevel,
+	"fatal": log.FatalLevel,
+	"error": log.ErrorLevel,
+	"warn":  log.WarnLevel,
+	"info":  log.InfoLevel,
+	"debug": log.DebugLevel,
+	"trace": log.TraceLevel,
+}
+
+// setConfig read the settings of the flags and of the config file of --config into the global config
+func setConfig(ctx *cli.Context) error {
+	file, err := loadConfigFile(ctx)
+	if err != nil {
+		return err
+	}
+	con, err := readConfig(ctx, file)
+	if err != nil {
+		return err
+	}
+	con.StartTime = time.Now()
+	config.SetConfig(con)
+	log.SetLevel(logLevels[con.LogLevel])
+	log.WithField("config", config.GetConfig()).Info("Found configuration")
+	return nil
+}
+
+// loadConfigFile the config file of --config, a file without settings if there is none
+func loadConfigFile(ctx *cli.Context) (*config.File, error) {
+	path := ctx.GlobalString(configFlag.Name)
+	if path == "" {
+		return &config.File{}, nil
+	}
+	return config.LoadFile(path)
+}
+
+// readConfig the settings of the flags, a setting of the config file is used if its flag is not set.
+// The error has all settings that are not valid.
+func readConfig(ctx *cli.Context, file *config.File) (*config.Configuration, error) {
+	con := &config.Configuration{File: ctx.GlobalString(configFlag.Name)}
+	problems := []string{}
+	check := func(valid bool, format string, args ...interface{}) {
+		if !valid {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+	con.CleanInterval = durationSetting(ctx, cleanIntervalFlag, time.Minute, file.CleanInterval)
+	check(con.CleanInterval >= time.Second, "cleanInterval (%v) of %v should be at least 1s", flagRef(cleanIntervalFlag.Name), con.CleanInterval)
+	con.BlockTTL = durationSetting(ctx, blockTimeToLiveFlag, time.Hour, file.BlockTTL)
+	check(con.BlockTTL >= time.Hour, "blockTTL (%v) of %v should be at least 1h", flagRef(blockTimeToLiveFlag.Name), con.BlockTTL)
+	con.WatcherInterval = durationSetting(ctx, watcherIntervalFlag, time.Minute, file.WatcherInterval)
+	check(con.WatcherInterval >= time.Second, "watcherInterval (%v) of %v should be at least 1s", flagRef(watcherIntervalFlag.Name), con.WatcherInterval)
+	con.PollInterval = durationSetting(ctx, pollIntervalFlag, time.Second, file.PollInterval)
+	check(con.PollInterval >= 100*time.Millisecond, "pollInterval (%v) of %v should be at least 100ms", flagRef(pollIntervalFlag.Name), con.PollInterval)
+	con.ProbeInterval = durationSetting(ctx, probeIntervalFlag, time.Second, file.ProbeInterval)
+	check(con.ProbeInterval >= time.Second, "probeInterval (%v) of %v should be at least 1s", flagRef(probeIntervalFlag.Name), con.ProbeInterval)
+	con.ProgressInterval = durationSetting(ctx, progressIntervalFlag, time.Minute, file.ProgressInterval)
+	check(con.ProgressInterval >= time.Second, "progressInterval (%v) of %v should be at least 1s", flagRef(progressIntervalFlag.Name), con.ProgressInterval)
+	con.GapInterval = durationSetting(ctx, gapIntervalFlag, time.Minute, file.GapInterval)
+	check(con.GapInterval >= time.Second, "gapInterval (%v) of %v should be at least 1s", flagRef(gapIntervalFlag.Name), con.GapInterval)
+	con.OOSThreshold = durationSetting(ctx, oosThresholdFlag, time.Second, file.OOSThreshold)
+	check(con.OOSThreshold >= time.Second, "oosThreshold (%v) of %v should be at least 1s", flagRef(oosThresholdFlag.Name), con.OOSThreshold)
+
+	con.Port = intSetting(ctx, portFlag.Name, file.Port)
+	check(con.Port > 0 && con.Port < 65536, "port (%v) of %v should be 1 to 65535", flagRef(portFlag.Name), con.Port)
+	con.NumBatch = intSetting(ctx, batchFlag.Name, file.NumBatch)
+	check(con.NumBatch >= 1 && con.NumBatch <= 127, "batchWorkers (%v) of %v should be 1 to 127", flagRef(batchFlag.Name), con.NumBatch)
+	con.ChunkSize = int64Setting(ctx, chunkFlag.Name, file.ChunkSize)
+	check(con.ChunkSize >= 1, "chunkSize (%v) of %v should be at least 1", flagRef(chunkFlag.Name), con.ChunkSize)
+	con.FetchBatchSize = intSetting(ctx, fetchBatchFlag.Name, file.FetchBatchSize)
+	check(con.FetchBatchSize >= 1, "fetchBatchSize (%v) of %v should be at least 1", flagRef(fetchBatchFlag.Name), con.FetchBatchSize)
+	con.Quorum = intSetting(ctx, quorumFlag.Name, file.Quorum)
+	check(con.Quorum >= 0, "quorum (%v) of %v should not be negative", flagRef(quorumFlag.Name), con.Quorum)
+	con.SenderMode = stringSetting(ctx, senderFlag.Name, file.SenderMode)
+	check(con.SenderMode == fetcher.SenderModeRPC || con.SenderMode == fetcher.SenderModeLocal,
+		"sender (%v) of %v should be %v or %v", flagRef(senderFlag.Name), con.SenderMode, fetcher.SenderModeRPC, fetcher.SenderModeLocal)
+	con.Backend = stringSetting(ctx, backendFlag.Name, file.Backend)
+	if err := keyvalue.ValidateBackend(con.Backend); err != nil {
+		check(false, "backend (%v): %v", flagRef(backendFlag.Name), err.Error())
+	}
+	con.DbPath = stringSetting(ctx, dbFlag.Name, file.DbPath)
+	check(con.DbPath != "", "db (%v) should not be empty", dbFlag.Name)
+	con.BackupDir = stringSetting(ctx, backupDirFlag.Name, file.BackupDir)
+
+	chains, err := chainSetting(ctx, file)
+	con.Chains = chains
+	if err == nil {
+		err = config.ValidateChains(con.Chains)
+	}
+	if err != nil {
+		check(false, "chains (%v): %v", flagRef(chainFlag.Name), err.Error())
+	}
+	for _, chain := range con.Chains {
+		check(con.Quorum <= len(chain.IPCs), "quorum (%v) of %v is more than number of ipc %v of chain %v", flagRef(quorumFlag.Name), con.Quorum, len(chain.IPCs), chain.ID)
+		for _, ipc := range chain.IPCs {
+			_, err := service.GetTransport(ipc)
+			check(ipc != "" && err == nil, "endpoint %q of chain %v is not valid", ipc, chain.ID)
+		}
+	}
+
+	con.LogLevel = strings.ToLower(stringSetting(ctx, logLevelFlag.Name, file.LogLevel))
+	_, ok := logLevels[con.LogLevel]
+	check(ok, "logLevel (%v) of %v should be panic, fatal, error, warn, info, debug or trace", flagRef(logLevelFlag.Name), con.LogLevel)
+
+	con.AdminUsers = adminUsers(file)
+	if len(con.AdminUsers) > 0 {
+		if err := config.ValidateAdminUsers(con.AdminUsers); err != nil {
+			check(false, "admin (%v, %v): %v", http.AdminUserName, http.AdminPassword, err.Error())
+		}
+	}
+
+	con.CORSOrigins = file.CORSOrigins
+	if ctx.GlobalIsSet(corsFlag.Name) || file.CORSOrigins == nil {
+		con.CORSOrigins = splitList(ctx.GlobalString(corsFlag.Name))
+	}
+	con.RateLimit = ctx.GlobalFloat64(rateFlag.Name)
+	con.RateBurst = ctx.GlobalInt(burstFlag.Name)
+	if file.RateLimit != nil {
+		if !ctx.GlobalIsSet(rateFlag.Name) {
+			con.RateLimit = file.RateLimit.RequestsPerSecond
+		}
+		if !ctx.GlobalIsSet(burstFlag.Name) {
+			con.RateBurst = file.RateLimit.Burst
+		}
+	}
+	check(con.RateLimit >= 0, "rateLimit.requestsPerSecond (%v) of %v should not be negative", flagRef(rateFlag.Name), con.RateLimit)
+	check(con.RateLimit == 0 || con.RateBurst >= 1, "rateLimit.burst (%v) of %v should be at least 1", flagRef(burstFlag.Name), con.RateBurst)
+	con.APIKeyMode = strings.ToLower(stringSetting(ctx, apiKeysFlag.Name, file.APIKeyMode))
+	check(con.APIKeyMode == config.APIKeyOptional || con.APIKeyMode == config.APIKeyRequired,
+		"apiKeys (%v) of %v should be %v or %v", flagRef(apiKeysFlag.Name), con.APIKeyMode, config.APIKeyOptional, config.APIKeyRequired)
+	con.QueryBudget = intSetting(ctx, queryBudgetFlag.Name, file.QueryBudget)
+	check(con.QueryBudget >= 0, "queryBudget (%v) of %v should not be negative", flagRef(queryBudgetFlag.Name), con.QueryBudget)
+	con.QueryTimeout = durationSetting(ctx, queryTimeoutFlag, time.Second, file.QueryTimeout)
+	check(con.QueryTimeout >= 0, "queryTimeout (%v) of %v should not be negative", flagRef(queryTimeoutFlag.Name), con.QueryTimeout)
+	con.CacheSize = intSetting(ctx, cacheSizeFlag.Name, file.CacheSize)
+	check(con.CacheSize >= 0, "cacheSize (%v) of %v should not be negative", flagRef(cacheSizeFlag.Name), con.CacheSize)
+	con.ExtraFields = file.ExtraFields
+	if ctx.GlobalIsSet(extrasFlag.Name) || file.ExtraFields == nil {
+		con.ExtraFields = splitList(ctx.GlobalString(extrasFlag.Name))
+	}
+	for _, field := range con.ExtraFields {
+		check(common.Contains(config.ExtraFieldNames, field), "extras (%v) of %v should be among %v",
+			flagRef(extrasFlag.Name), field, strings.Join(config.ExtraFieldNames, ", "))
+	}
+
+	if len(problems) > 0 {
+		return nil, errors.New("invalid configuration:\n  - " + strings.Join(problems, "\n  - "))
+	}
+	return con, nil
+}
+
+// adminUsers users of the admin api: the user of INDEXER_USER_NAME/INDEXER_PASSWORD (or admin.user/admin.password
+// of the config file) is an operator, followed by admin.users of the config file
+func adminUsers(file *config.File) []config.AdminUser {
+	name := os.Getenv(http.AdminUserName)
+	password := os.Getenv(http.AdminPassword)
+	fileUsers := []config.AdminUser{}
+	if file.Admin != nil {
+		if name == "" {
+			name = file.Admin.User
+		}
+		if password == "" {
+			password = file.Admin.Password
+		}
+		fileUsers = file.Admin.Users
+	}
+	users := []config.AdminUser{}
+	if name != "" {
+		users = append(users, config.AdminUser{Name: name, Password: password, Role: config.RoleOperator})
+	}
+	return append(users, fileUsers...)
+}
+
+// chainSetting the chains of --chain, of the config file, or the default chain of --ipc and --genesis
+func chainSetting(ctx *cli.Context, file *config.File) ([]config.ChainConfig, error) {
+	values := ctx.GlobalStringSlice(chainFlag.Name)
+	if len(values) == 0 && len(file.Chains) > 0 {
+		return file.ChainConfigs(), nil
+	}
+	if len(values) == 0 {
+		ipcs := file.IPC
+		if ctx.GlobalIsSet(ipcFlag.Name) || len(ipcs) == 0 {
+			ipcs = splitList(ctx.GlobalString(ipcFlag.Name))
+		}
+		genesis := int64Setting(ctx, genesisFlag.Name, file.Genesis)
+		return []config.ChainConfig{{ID: common.DefaultChainID, IPCs: ipcs, Genesis: genesis}}, nil
+	}
+	chains := []config.ChainConfig{}
+	for _, value := range values {
+		chain, err := config.ParseChain(value)
+		if err != nil {
+			return nil, err
+		}
+		chains = append(chains, chain)
+	}
+	return chains, nil
+}
+
+// durationSetting the value of a flag in unit, or of the config file if the flag is not set
+func durationSetting(ctx *cli.Context, flag cli.Float64Flag, unit time.Duration, fileValue *time.Duration) time.Duration {
+	if fileValue != nil && !ctx.GlobalIsSet(flag.Name) {
+		return *fileValue
+	}
+	return time.Duration(ctx.GlobalFloat64(flag.Name) * float64(unit))
+}
+
+func intSetting(ctx *cli.Context, name string, fileValue *int) int {
+	if fileValue != nil && !ctx.GlobalIsSet(name) {
+		return *fileValue
+	}
+	return ctx.GlobalInt(name)
+}
+
+func int64Setting(ctx *cli.Context, name string, fileValue *int64) int64 {
+	if fileValue != nil && !ctx.GlobalIsSet(name) {
+		return *fileValue
+	}
+	return ctx.GlobalInt64(name)
+}
+
+func stringSetting(ctx *cli.Context, name string, fileValue *string) string {
+	if fileValue != nil && !ctx.GlobalIsSet(name) {
+		return *fileValue
+	}
+	return ctx.GlobalString(name)
+}
+
+// flagRef a flag as it's written in the command line
+func flagRef(name string) string {
+	if len(name) == 1 {
+		return "-" + name
+	}
+	return "--" + name
+}
+
+// splitList values separated by ',', nil for an empty string
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// watchReload reload the config file on SIGHUP until ctx is cancelled
+func watchReload(ctx context.Context, cliCtx *cli.Context, indexers []*indexer.Indexer) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			reloadConfig(cliCtx, indexers)
+		}
+	}
+}
+
+// reloadConfig apply the settings of the config file that can change while indexing, see Configuration.Reload.
+// Nothing changes if the file is not valid.
+func reloadConfig(ctx *cli.Context, indexers []*indexer.Indexer) {
+	file, err := loadConfigFile(ctx)
+	var con *config.Configuration
+	if err == nil {
+		con, err = readConfig(ctx, file)
+	}
+	if err == nil && len(con.AdminUsers) == 0 {
+		err = errors.New("admin user is required")
+	}
+	if err != nil {
+		log.WithField("error", err.Error()).Error("Cannot reload configuration, keeping the current one")
+		return
+	}
+	restart := config.GetConfig().Reload(con)
+	log.SetLevel(logLevels[con.LogLevel])
+	if !common.Contains(restart, "Chains") {
+		for i, idx := range indexers {
+			if err := updateEndpoints(idx, con.Chains[i].IPCs); err != nil {
+				log.WithFields(log.Fields{
+					"chain": idx.ChainID,
+					"error": err.Error(),
+				}).Error("Cannot update endpoints")
+			}
+		}
+	}
+	if len(restart) > 0 {
+		log.WithField("settings", restart).Warn("Reloaded configuration, changed settings need a restart")
+	}
+	log.WithField("config", config.GetConfig()).Info("Reloaded configuration")
+}
+
+// updateEndpoints set the endpoints of the chain of idx if they changed
+func updateEndpoints(idx *indexer.Indexer, ipcs []string) error {
+	current := []string{}
+	for _, status := range idx.IpcManager.GetEndpointStatuses() {
+		current = append(current, status.Endpoint)
+	}
+	if strings.Join(current, ",") == strings.Join(ipcs, ",") {
+		return nil
+	}
+	return idx.IpcManager.UpdateIPC(ipcs)
+}
@@ -1,23 +1,27 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"math/big"
 	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/WeTrustPlatform/account-indexer/common"
 	"github.com/WeTrustPlatform/account-indexer/common/config"
+	"github.com/WeTrustPlatform/account-indexer/fetcher"
 	"github.com/WeTrustPlatform/account-indexer/indexer"
-	"github.com/WeTrustPlatform/account-indexer/repository/keyvalue/dao"
 	"github.com/WeTrustPlatform/account-indexer/service"
 	"github.com/WeTrustPlatform/account-indexer/watcher"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/WeTrustPlatform/account-indexer/http"
 	"github.com/WeTrustPlatform/account-indexer/repository/keyvalue"
-	"github.com/ethereum/go-ethereum/console"
+	"github.com/ethereum/go-ethereum/console/prompt"
 	"github.com/syndtr/goleveldb/leveldb"
 
 	"os"
@@ -28,11 +32,24 @@ import (
 var (
 	app = newApp()
 
+	configFlag = cli.StringFlag{
+		Name:  "config",
+		Usage: "YAML config file, flags override its settings. It's reloaded on SIGHUP",
+	}
 	ipcFlag = cli.StringFlag{
 		Name:  "ipc",
-		Usage: "ipc file paths separated by ','",
+		Usage: "geth endpoints separated by ',': ipc file paths, http(s):// or ws(s):// urls",
 		Value: common.DefaultIpc,
 	}
+	chainFlag = cli.StringSliceFlag{
+		Name:  "chain",
+		Usage: "a chain to index as ID[:GENESIS]=ENDPOINT[,ENDPOINT...], repeat it to index several chains in one database, --ipc and --genesis are ignored then",
+	}
+	genesisFlag = cli.Int64Flag{
+		Name:  "genesis",
+		Usage: "first block to index of the chain of --ipc",
+		Value: common.DefaultGenesis,
+	}
 	dbFlag = cli.StringFlag{
 		Name:  "db",
 		Usage: "leveldb file path",
@@ -53,6 +70,26 @@ var (
 		Usage: "watcher interval (int) in minute",
 		Value: common.DefaultWatcherInterval,
 	}
+	pollIntervalFlag = cli.Float64Flag{
+		Name:  "poll",
+		Usage: "interval (in second) to poll new blocks of http endpoints",
+		Value: common.DefaultPollInterval,
+	}
+	probeIntervalFlag = cli.Float64Flag{
+		Name:  "probe",
+		Usage: "interval (in second) to probe health of all endpoints",
+		Value: common.DefaultProbeInterval,
+	}
+	progressIntervalFlag = cli.Float64Flag{
+		Name:  "pi",
+		Usage: "batch progress log interval (int) in minute",
+		Value: common.DefaultProgressInterval,
+	}
+	gapIntervalFlag = cli.Float64Flag{
+		Name:  "gap",
+		Usage: "interval (in minute) to look for blocks missed by realtime index and backfill them",
+		Value: common.DefaultGapInterval,
+	}
 	oosThresholdFlag = cli.Float64Flag{
 		Name:  "oos",
 		Usage: "threshold (in second) to consider a node as out of sync",
@@ -66,19 +103,187 @@ var (
 
 	batchFlag = cli.IntFlag{
 		Name:  "b",
-		Usage: "initial number of batch (1-127)",
+		Usage: "number of batch workers (1-127), can be changed on restart",
 		Value: common.DefaultNumBatch,
 	}
+	chunkFlag = cli.Int64Flag{
+		Name:  "chunk",
+		Usage: "number of blocks in a batch chunk",
+		Value: common.DefaultChunkSize,
+	}
+	fetchBatchFlag = cli.IntFlag{
+		Name:  "fb",
+		Usage: "number of blocks in a json-rpc batch request",
+		Value: common.DefaultFetchBatchSize,
+	}
+	quorumFlag = cli.IntFlag{
+		Name:  "quorum",
+		Usage: "number of endpoints that have to agree on a block before it's stored, 0 to disable",
+		Value: common.DefaultQuorum,
+	}
+	senderFlag = cli.StringFlag{
+		Name:  "sender",
+		Usage: "how to get sender of transactions: rpc (ask geth node, batch requests use the sender returned with the block) or local (recover from signatures)",
+		Value: common.DefaultSenderMode,
+	}
+	backendFlag = cli.StringFlag{
+		Name:  "backend",
+		Usage: "storage backend of the database: leveldb or pebble",
+		Value: common.DefaultBackend,
+	}
+	logLevelFlag = cli.StringFlag{
+		Name:   "log-level",
+		Usage:  "log level: panic, fatal, error, warn, info, debug or trace",
+		Value:  common.DefaultLogLevel,
+		EnvVar: "INDEXER_LOG_LEVEL",
+	}
+	corsFlag = cli.StringFlag{
+		Name:  "cors",
+		Usage: "origins separated by ',' allowed to call the public api from a browser, \"*\" for all",
+	}
+	rateFlag = cli.Float64Flag{
+		Name:  "rate",
+		Usage: "requests per second of a client to the public api, 0 to disable",
+		Value: common.DefaultRateLimit,
+	}
+	burstFlag = cli.IntFlag{
+		Name:  "burst",
+		Usage: "requests a client can do at once when --rate is set",
+		Value: common.DefaultRateBurst,
+	}
+	apiKeysFlag = cli.StringFlag{
+		Name:  "api-keys",
+		Usage: "api keys of the public api: optional (requests without key are limited by ip) or required",
+		Value: common.DefaultAPIKeyMode,
+	}
+	queryBudgetFlag = cli.IntFlag{
+		Name:  "query-budget",
+		Usage: "max number of address records an account query reads, 0 for no limit",
+		Value: common.DefaultQueryBudget,
+	}
+	queryTimeoutFlag = cli.Float64Flag{
+		Name:  "query-timeout",
+		Usage: "max duration (in second) of an account query, 0 for no limit",
+		Value: common.DefaultQueryTimeout,
+	}
+	cacheSizeFlag = cli.IntFlag{
+		Name:  "cache-size",
+		Usage: "max number of account query results and of transaction extras cached per chain, 0 to disable",
+		Value: common.DefaultCacheSize,
+	}
+	extrasFlag = cli.StringFlag{
+		Name:  "extras",
+		Usage: "fields of transactions kept in the database for the fl param of the account api, separated by ',': data, gas, gasPrice, type, nonce, maxFeePerGas, maxPriorityFeePerGas, effectiveGasPrice and gasUsed. Other fields are fetched from the node",
+	}
+	backupDirFlag = cli.StringFlag{
+		Name:  "backup-dir",
+		Usage: "directory of backups taken with POST /admin/backup, default is the db path with suffix \"_backups\"",
+	}
+	backupOutFlag = cli.StringFlag{
+		Name:  "out",
+		Usage: "path of the backup tarball to write",
+	}
+	restoreInFlag = cli.StringFlag{
+		Name:  "in",
+		Usage: "path of the backup tarball to restore",
+	}
+	verifyFromFlag = cli.Int64Flag{
+		Name:  "from",
+		Usage: "first block to verify",
+	}
+	verifyToFlag = cli.Int64Flag{
+		Name:  "to",
+		Usage: "last block to verify",
+	}
+	verifyRepairFlag = cli.BoolFlag{
+		Name:  "repair",
+		Usage: "repair records that differ from the chain",
+	}
+	verifyChainFlag = cli.StringFlag{
+		Name:  "chain-id",
+		Usage: "id of the chain of --chain to verify, default is the first one",
+	}
+	genesisFileFlag = cli.StringFlag{
+		Name:  "file",
+		Usage: "path of the genesis file (genesis.json of geth) to import",
+	}
+	genesisChainFlag = cli.StringFlag{
+		Name:  "chain-id",
+		Usage: "id of the chain of --chain to import to, default is the first one",
+	}
 
 	indexerFlags = []cli.Flag{
+		configFlag,
 		ipcFlag,
+		genesisFlag,
+		chainFlag,
 		dbFlag,
+		backendFlag,
 		cleanIntervalFlag,
 		blockTimeToLiveFlag,
 		watcherIntervalFlag,
+		pollIntervalFlag,
+		probeIntervalFlag,
+		progressIntervalFlag,
+		gapIntervalFlag,
 		oosThresholdFlag,
 		portFlag,
 		batchFlag,
+		chunkFlag,
+		fetchBatchFlag,
+		senderFlag,
+		quorumFlag,
+		backupDirFlag,
+		logLevelFlag,
+		corsFlag,
+		rateFlag,
+		burstFlag,
+		apiKeysFlag,
+		queryBudgetFlag,
+		queryTimeoutFlag,
+		cacheSizeFlag,
+		extrasFlag,
+	}
+
+	backupCommand = cli.Command{
+		Name:      "backup",
+		Usage:     "back up the database of --db to a tarball, the indexer must be stopped (use POST /admin/backup while it runs)",
+		ArgsUsage: " ",
+		Flags:     []cli.Flag{backupOutFlag},
+		Action:    backup,
+	}
+	restoreCommand = cli.Command{
+		Name:      "restore",
+		Usage:     "verify a backup tarball and restore it to a new database at --db",
+		ArgsUsage: " ",
+		Flags:     []cli.Flag{restoreInFlag},
+		Action:    restore,
+	}
+	verifyCommand = cli.Command{
+		Name:      "verify",
+		Usage:     "refetch blocks from --ipc (or the chain of --chain-id) and compare them with the address database at --db, the indexer must be stopped (use POST /admin/verify while it runs)",
+		ArgsUsage: " ",
+		Flags:     []cli.Flag{verifyFromFlag, verifyToFlag, verifyRepairFlag, verifyChainFlag},
+		Action:    verify,
+	}
+	importGenesisCommand = cli.Command{
+		Name:      "import-genesis",
+		Usage:     "import the allocations of a genesis file to the address database at --db as inflow records at the genesis timestamp, the indexer must be stopped",
+		ArgsUsage: " ",
+		Flags:     []cli.Flag{genesisFileFlag, genesisChainFlag},
+		Action:    importGenesis,
+	}
+	hashPasswordCommand = cli.Command{
+		Name:      "hash-password",
+		Usage:     "ask a password and print its bcrypt hash for passwordHash of admin.users of the config file",
+		ArgsUsage: " ",
+		Action:    hashPassword,
+	}
+	newTokenCommand = cli.Command{
+		Name:      "new-token",
+		Usage:     "print a random api token and its hash for tokenHash of admin.users of the config file",
+		ArgsUsage: " ",
+		Action:    newToken,
 	}
 )
 
@@ -93,84 +298,308 @@ func newApp() *cli.App {
 	return app
 }
 
-func setConfig(ctx *cli.Context) {
-	clearInterval := ctx.GlobalFloat64(cleanIntervalFlag.Name)
-	blockTTL := ctx.GlobalFloat64(blockTimeToLiveFlag.Name)
-	watcherInterval := ctx.GlobalFloat64(watcherIntervalFlag.Name)
-	oosThreshold := ctx.GlobalFloat64(oosThresholdFlag.Name)
-	config := config.GetConfig()
-	config.CleanInterval = time.Duration(clearInterval) * time.Minute
-	if config.CleanInterval < 1*time.Second {
-		panic(fmt.Errorf("CleanInterval of %v is not valid", config.CleanInterval))
+// Entry point
+func index(ctx *cli.Context) error {
+	if err := setConfig(ctx); err != nil {
+		return err
 	}
-	config.BlockTTL = time.Duration(blockTTL) * time.Hour
-	if config.BlockTTL < 1*time.Hour {
-		panic(fmt.Errorf("BlockTTL of %v is not valid. Should not be less than 1 hour", config.BlockTTL))
+	if len(config.GetConfig().GetAdminUsers()) == 0 {
+		return errors.New("admin user is required, set " + http.AdminUserName + " and " + http.AdminPassword + ", admin.user or admin.users of the config file")
 	}
-	config.WatcherInterval = time.Duration(watcherInterval) * time.Minute
-	if config.WatcherInterval < 1*time.Second {
-		panic(fmt.Errorf("WatcherInterval of %v is not valid", config.WatcherInterval))
+	dbPath := config.GetConfig().DbPath
+
+	// every goroutine stops on SIGINT/SIGTERM and the databases are closed after all of them are done
+	rootCtx, cancel := signalContext()
+	defer cancel()
+	db, err := keyvalue.OpenDB(config.GetConfig().Backend, dbPath)
+	if err != nil {
+		panic(errors.New("Can't connect to " + config.GetConfig().Backend + " database. Error: " + err.Error()))
+	}
+	defer func() {
+		db.Close()
+		log.Info("Closed database, exit")
+	}()
+	migrateOldDatabases(db, dbPath)
+
+	indexers := []*indexer.Indexer{}
+	wg := sync.WaitGroup{}
+	for _, chain := range config.GetConfig().GetChains() {
+		idx := newChainIndexer(db, chain)
+		idx.IpcManager.StartProbing(rootCtx, fetcher.ProbeEndpoint, config.GetConfig().ProbeInterval)
+		indexers = append(indexers, idx)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			idx.FirstIndex(rootCtx)
+		}()
+		cleaner := watcher.NewCleaner(idx.IndexRepo)
+		go func() {
+			defer wg.Done()
+			cleaner.CleanBlockDB(rootCtx)
+		}()
 	}
-	config.OOSThreshold = time.Duration(oosThreshold) * time.Second
-	if config.OOSThreshold < 1*time.Second {
-		panic(fmt.Errorf("OOSThreshold of %v is not valid", config.OOSThreshold))
+	if config.GetConfig().File != "" {
+		go watchReload(rootCtx, ctx, indexers)
 	}
+	server := http.NewServer(indexers, db)
+	server.Start(rootCtx)
+	log.Info("Waiting for indexer to store in-flight blocks")
+	wg.Wait()
+	return nil
+}
 
-	config.Port = ctx.GlobalInt(portFlag.Name)
-	config.NumBatch = ctx.GlobalInt(batchFlag.Name)
-	config.StartTime = time.Now()
-	// byte range
-	if config.NumBatch < 1 || config.NumBatch > 127 {
-		panic(errors.New("number of batch should be 1 to 127"))
+// newChainIndexer an indexer of chain with its own endpoints, its repositories are in the namespace of the chain.
+// The default chain uses the global ipc manager.
+func newChainIndexer(db *keyvalue.DB, chain config.ChainConfig) *indexer.Indexer {
+	ipcManager := service.NewIpcManager()
+	if chain.ID == common.DefaultChainID {
+		ipcManager = service.GetIpcManager()
 	}
-	log.WithField("config", config).Info("Found configuration")
+	if err := ipcManager.SetIPC(chain.IPCs); err != nil {
+		panic(errors.New("Invalid ipc of chain " + chain.ID + ". Error: " + err.Error()))
+	}
+	indexRepo, batchRepo := db.ChainRepos(chain.ID)
+	buildCounters(chain.ID, indexRepo)
+	return indexer.NewChainIndexer(chain.ID, ipcManager, big.NewInt(chain.Genesis), indexRepo, batchRepo, nil)
 }
 
-// Entry point
-func index(ctx *cli.Context) {
-	setConfig(ctx)
-	ipcPath := ctx.GlobalString(ipcFlag.Name)
-	dbPath := ctx.GlobalString(dbFlag.Name)
-	config.GetConfig().DbPath = dbPath
+// buildCounters count address records of a database of an older version once, before indexing starts
+func buildCounters(chainID string, indexRepo *keyvalue.KVIndexRepo) {
+	if indexRepo.CountersReady() {
+		return
+	}
+	log.WithField("chain", chainID).Info("Building address counters")
+	start := time.Now()
+	total, err := indexRepo.RebuildCounters()
+	if err != nil {
+		panic(errors.New("Cannot build address counters of chain " + chainID + ". Error: " + err.Error()))
+	}
+	log.WithFields(log.Fields{
+		"chain":      chainID,
+		"numRecords": total,
+		"duration":   time.Since(start).String(),
+	}).Info("Built address counters")
+}
 
-	ipcs := strings.Split(ipcPath, ",")
-	service.GetIpcManager().SetIPC(ipcs)
-	addressDB, err := leveldb.OpenFile(dbPath+"_address", nil)
+// verify compare the address records of blocks --from to --to with the chain, it fails if
+// records differ and they are not repaired
+func verify(ctx *cli.Context) error {
+	if err := setConfig(ctx); err != nil {
+		return err
+	}
+	chain, err := findChain(ctx.String(verifyChainFlag.Name))
 	if err != nil {
-		panic(errors.New("Can't connect to Address LevelDB. Error: " + err.Error()))
+		return err
 	}
-	blockDB, err := leveldb.OpenFile(dbPath+"_block", nil)
+	backend := config.GetConfig().Backend
+	db, err := keyvalue.OpenDB(backend, config.GetConfig().DbPath)
 	if err != nil {
-		panic(errors.New("Can't connect to Block LevelDB. Error: " + err.Error()))
+		return errors.New("Can't open " + backend + " database. Error: " + err.Error())
 	}
-	batchDB, err := leveldb.OpenFile(dbPath+"_batch", nil)
+	defer db.Close()
+	verifier := indexer.NewVerifier(newChainIndexer(db, chain))
+	rootCtx, cancel := signalContext()
+	defer cancel()
+	from := big.NewInt(ctx.Int64(verifyFromFlag.Name))
+	to := big.NewInt(ctx.Int64(verifyToFlag.Name))
+	repair := ctx.Bool(verifyRepairFlag.Name)
+	report, err := verifier.Run(rootCtx, from, to, repair)
 	if err != nil {
-		panic(errors.New("Can't connect to Batch LevelDB. Error: " + err.Error()))
+		return errors.New("Verify failed. Error: " + err.Error())
+	}
+	if report.NumIssues() > 0 && !repair {
+		return fmt.Errorf("Found %v missing, %v extra and %v mismatched records", report.Missing, report.Extra, report.Mismatched)
 	}
+	return nil
+}
+
+// findChain the chain of --chain with id chainID, the first one if chainID is empty
+func findChain(chainID string) (config.ChainConfig, error) {
+	chains := config.GetConfig().GetChains()
+	if chainID == "" {
+		return chains[0], nil
+	}
+	for _, chain := range chains {
+		if chain.ID == chainID {
+			return chain, nil
+		}
+	}
+	return config.ChainConfig{}, errors.New("Unknown chain " + chainID)
+}
 
-	cleanUp := func() {
-		addressDB.Close()
-		blockDB.Close()
-		batchDB.Close()
+// importGenesis store the allocations of the genesis file of --file as address records of the chain
+func importGenesis(ctx *cli.Context) error {
+	if err := setConfig(ctx); err != nil {
+		return err
 	}
-	defer cleanUp()
+	chain, err := findChain(ctx.String(genesisChainFlag.Name))
+	if err != nil {
+		return err
+	}
+	path := ctx.String(genesisFileFlag.Name)
+	if path == "" {
+		return errors.New("--file is required")
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return errors.New("Can't open genesis file " + path + ". Error: " + err.Error())
+	}
+	defer file.Close()
+	genesis, err := indexer.ReadGenesis(file)
+	if err != nil {
+		return err
+	}
+	backend := config.GetConfig().Backend
+	db, err := keyvalue.OpenDB(backend, config.GetConfig().DbPath)
+	if err != nil {
+		return errors.New("Can't open " + backend + " database. Error: " + err.Error())
+	}
+	defer db.Close()
+	indexRepo, _ := db.ChainRepos(chain.ID)
+	buildCounters(chain.ID, indexRepo)
+	total, err := indexer.ImportGenesis(indexRepo, genesis)
+	if err != nil {
+		return errors.New("Import of genesis file failed. Error: " + err.Error())
+	}
+	log.WithFields(log.Fields{
+		"chain":      chain.ID,
+		"numRecords": total,
+	}).Info("Imported genesis allocations")
+	return nil
+}
+
+// signalContext a context cancelled on SIGINT/SIGTERM, a second signal exits immediately
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
 	interuptChan := make(chan os.Signal, 1)
-	signal.Notify(interuptChan, os.Interrupt)
+	signal.Notify(interuptChan, os.Interrupt, syscall.SIGTERM)
 	go func() {
+		sig := <-interuptChan
+		log.WithField("signal", sig.String()).Info("Received interupt signal, stopping...")
+		cancel()
 		<-interuptChan
-		cleanUp()
-		log.Info("Received interupt signal, cleanup and exit...")
+		log.Warn("Received second interupt signal, exit without cleanup")
 		os.Exit(1)
 	}()
+	return ctx, cancel
+}
+
+// migrateOldDatabases move the address, block and batch leveldbs of older versions into the key spaces of db,
+// a migrated database is renamed with suffix ".migrated"
+func migrateOldDatabases(db *keyvalue.DB, dbPath string) {
+	oldDBs := []struct {
+		suffix   string
+		keySpace []byte
+	}{
+		{"_address", keyvalue.AddressKeySpace},
+		{"_block", keyvalue.BlockKeySpace},
+		{"_batch", keyvalue.BatchKeySpace},
+	}
+	for _, oldDB := range oldDBs {
+		path := dbPath + oldDB.suffix
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			continue
+		}
+		log.WithField("db", path).Info("Migrating database")
+		old, err := leveldb.OpenFile(path, nil)
+		if err != nil {
+			panic(errors.New("Can't open LevelDB " + path + ". Error: " + err.Error()))
+		}
+		total, err := keyvalue.MigrateLevelDb(db.KeySpace(oldDB.keySpace), old)
+		old.Close()
+		if err != nil {
+			panic(errors.New("Can't migrate LevelDB " + path + ". Error: " + err.Error()))
+		}
+		if err := os.Rename(path, path+".migrated"); err != nil {
+			panic(errors.New("Can't rename LevelDB " + path + ". Error: " + err.Error()))
+		}
+		log.WithFields(log.Fields{
+			"db":    path,
+			"total": total,
+		}).Info("Migrated database")
+	}
+}
 
-	indexRepo := keyvalue.NewKVIndexRepo(dao.NewLevelDbDAO(addressDB), dao.NewLevelDbDAO(blockDB))
-	batchRepo := keyvalue.NewKVBatchRepo(dao.NewLevelDbDAO(batchDB))
-	idx := indexer.NewIndexer(indexRepo, batchRepo, nil)
-	go idx.FirstIndex()
-	cleaner := watcher.NewCleaner(indexRepo)
-	go cleaner.CleanBlockDB()
-	server := http.NewServer(idx)
-	server.Start()
+// backup write a backup of the database to the file of --out
+func backup(ctx *cli.Context) error {
+	out := ctx.String(backupOutFlag.Name)
+	if out == "" {
+		return errors.New("--out is required")
+	}
+	if err := setConfig(ctx); err != nil {
+		return err
+	}
+	backend := config.GetConfig().Backend
+	db, err := keyvalue.OpenDB(backend, config.GetConfig().DbPath)
+	if err != nil {
+		return errors.New("Can't open " + backend + " database. Error: " + err.Error())
+	}
+	defer db.Close()
+	rootCtx, cancel := signalContext()
+	defer cancel()
+	manifest, err := db.BackupFile(rootCtx, out)
+	if err != nil {
+		return errors.New("Backup failed. Error: " + err.Error())
+	}
+	log.WithFields(log.Fields{
+		"file":       out,
+		"lastBlocks": manifest.LastBlocks,
+		"numRecords": manifest.NumRecords,
+	}).Info("Backup finished")
+	return nil
+}
+
+// restore restore the backup of --in to a new database
+func restore(ctx *cli.Context) error {
+	in := ctx.String(restoreInFlag.Name)
+	if in == "" {
+		return errors.New("--in is required")
+	}
+	if err := setConfig(ctx); err != nil {
+		return err
+	}
+	backend := config.GetConfig().Backend
+	dbPath := config.GetConfig().DbPath
+	manifest, err := keyvalue.Restore(in, backend, dbPath)
+	if err != nil {
+		return errors.New("Restore failed. Error: " + err.Error())
+	}
+	log.WithFields(log.Fields{
+		"db":         dbPath,
+		"lastBlocks": manifest.LastBlocks,
+		"numRecords": manifest.NumRecords,
+	}).Info("Restore finished")
+	return nil
+}
+
+func hashPassword(ctx *cli.Context) error {
+	password, err := prompt.Stdin.PromptPassword("Password: ")
+	if err != nil {
+		return err
+	}
+	confirm, err := prompt.Stdin.PromptPassword("Repeat password: ")
+	if err != nil {
+		return err
+	}
+	if password == "" || password != confirm {
+		return errors.New("passwords are empty or do not match")
+	}
+	hash, err := http.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	fmt.Println("passwordHash:", hash)
+	return nil
+}
+
+func newToken(ctx *cli.Context) error {
+	token, hash, err := http.NewToken()
+	if err != nil {
+		return err
+	}
+	fmt.Println("token:", token)
+	fmt.Println("tokenHash:", hash)
+	return nil
 }
 
 func main() {
@@ -184,10 +613,11 @@ func init() {
 	logInit()
 	app.Action = index
 	app.Flags = append(app.Flags, indexerFlags...)
+	app.Commands = []cli.Command{backupCommand, restoreCommand, verifyCommand, importGenesisCommand, hashPasswordCommand, newTokenCommand}
 	// app.Before
 	app.After = func(ctx *cli.Context) error {
 		// debug.Exit()
-		console.Stdin.Close() // Resets terminal mode.
+		prompt.Stdin.Close() // Resets terminal mode.
 		return nil
 	}
 }
@@ -197,16 +627,7 @@ func logInit() {
 	// log.SetFormatter(&log.JSONFormatter{})
 
 	// Only log the warning severity or above.
+	// until the level of the config is set
 	logLevel := os.Getenv("INDEXER_LOG_LEVEL")
-	logLevelMap := map[string]log.Level{
-		"":      log.InfoLevel,
-		"panic": log.PanicLevel,
-		"fatal": log.FatalLevel,
-		"error": log.ErrorLevel,
-		"warn":  log.WarnLevel,
-		"info":  log.InfoLevel,
-		"debug": log.DebugLevel,
-		"trace": log.TraceLevel,
-	}
-	log.SetLevel(logLevelMap[strings.ToLower(logLevel)])
+	log.SetLevel(logLevels[strings.ToLower(logLevel)])
 }
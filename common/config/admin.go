@@ -0,0 +1,81 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// RoleReadOnly can only read the admin api
+	RoleReadOnly = "readonly"
+	// RoleOperator can also change the indexer: rerun blocks, set workers, take backups and verify
+	RoleOperator = "operator"
+)
+
+// AdminUser a user of the admin api, it logs in with basic auth and its password or with its api token
+// in an "Authorization: Bearer <token>" header
+type AdminUser struct {
+	Name string `yaml:"name"`
+	// PasswordHash bcrypt hash of the password, empty if the user only has a token
+	PasswordHash string `yaml:"passwordHash"`
+	// TokenHash hex sha256 of the api token, empty if the user only has a password
+	TokenHash string `yaml:"tokenHash"`
+	// Role RoleReadOnly or RoleOperator
+	Role string `yaml:"role"`
+	// Password plain password of the user of INDEXER_USER_NAME/INDEXER_PASSWORD or admin.user/admin.password
+	Password string `yaml:"-"`
+}
+
+func (user AdminUser) String() string {
+	return user.Name + ":" + user.Role
+}
+
+// CanWrite whether the user can call admin routes that change the indexer
+func (user AdminUser) CanWrite() bool {
+	return user.Role == RoleOperator
+}
+
+// HashToken hex sha256 of an api token, as in tokenHash of the config file
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ValidateAdminUsers check there is at least one user, names are unique, roles are known
+// and every user has a valid password hash, token hash or password
+func ValidateAdminUsers(users []AdminUser) error {
+	if len(users) == 0 {
+		return errors.New("no admin user")
+	}
+	names := map[string]bool{}
+	for _, user := range users {
+		if user.Name == "" {
+			return errors.New("admin user without name")
+		}
+		if names[user.Name] {
+			return fmt.Errorf("duplicate admin user %v", user.Name)
+		}
+		names[user.Name] = true
+		if user.Role != RoleReadOnly && user.Role != RoleOperator {
+			return fmt.Errorf("role %q of admin user %v should be %v or %v", user.Role, user.Name, RoleReadOnly, RoleOperator)
+		}
+		if user.PasswordHash == "" && user.TokenHash == "" && user.Password == "" {
+			return fmt.Errorf("admin user %v has no password or token", user.Name)
+		}
+		if user.PasswordHash != "" {
+			if _, err := bcrypt.Cost([]byte(user.PasswordHash)); err != nil {
+				return fmt.Errorf("passwordHash of admin user %v is not a bcrypt hash: %v", user.Name, err.Error())
+			}
+		}
+		if user.TokenHash != "" {
+			if hash, err := hex.DecodeString(user.TokenHash); err != nil || len(hash) != sha256.Size {
+				return fmt.Errorf("tokenHash of admin user %v is not a hex sha256", user.Name)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestValidateAdminUsers(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	assert.Nil(t, err)
+	admin := AdminUser{Name: "admin", Password: "secret", Role: RoleOperator}
+	alice := AdminUser{Name: "alice", PasswordHash: string(hash), Role: RoleOperator}
+	ci := AdminUser{Name: "ci", TokenHash: HashToken("token"), Role: RoleReadOnly}
+	assert.Nil(t, ValidateAdminUsers([]AdminUser{admin, alice, ci}))
+
+	assert.NotNil(t, ValidateAdminUsers(nil))
+	assert.NotNil(t, ValidateAdminUsers([]AdminUser{alice, alice}))
+	assert.NotNil(t, ValidateAdminUsers([]AdminUser{{Password: "secret", Role: RoleOperator}}))
+	assert.NotNil(t, ValidateAdminUsers([]AdminUser{{Name: "admin", Password: "secret", Role: "root"}}))
+	// empty credentials are not accepted
+	assert.NotNil(t, ValidateAdminUsers([]AdminUser{{Name: "admin", Role: RoleOperator}}))
+	assert.NotNil(t, ValidateAdminUsers([]AdminUser{{Name: "alice", PasswordHash: "secret", Role: RoleOperator}}))
+	assert.NotNil(t, ValidateAdminUsers([]AdminUser{{Name: "ci", TokenHash: "abc", Role: RoleReadOnly}}))
+}
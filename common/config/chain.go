@@ -0,0 +1,72 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var chainIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ChainConfig a chain indexed by this process
+type ChainConfig struct {
+	// ID of the chain in the api and its database namespace
+	ID string
+	// IPCs endpoints of the chain
+	IPCs []string
+	// Genesis first block to index
+	Genesis int64
+}
+
+func (chain ChainConfig) String() string {
+	return fmt.Sprintf("%v:%v=%v", chain.ID, chain.Genesis, strings.Join(chain.IPCs, ","))
+}
+
+// ParseChain parse a chain of format ID[:GENESIS]=ENDPOINT[,ENDPOINT...], genesis is 0 if it's not specified
+func ParseChain(value string) (ChainConfig, error) {
+	chain := ChainConfig{}
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return chain, errors.New("chain " + value + " should be ID[:GENESIS]=ENDPOINT[,ENDPOINT...]")
+	}
+	idGenesis := strings.SplitN(parts[0], ":", 2)
+	chain.ID = idGenesis[0]
+	if !chainIDPattern.MatchString(chain.ID) {
+		return chain, errors.New("chain id " + chain.ID + " should only have letters, digits, '_' and '-'")
+	}
+	if len(idGenesis) == 2 {
+		genesis, err := strconv.ParseInt(idGenesis[1], 10, 64)
+		if err != nil || genesis < 0 {
+			return chain, errors.New("invalid genesis block " + idGenesis[1] + " of chain " + chain.ID)
+		}
+		chain.Genesis = genesis
+	}
+	chain.IPCs = strings.Split(parts[1], ",")
+	return chain, nil
+}
+
+// ValidateChains error if there is no chain, a chain is not valid or chain ids are not unique
+func ValidateChains(chains []ChainConfig) error {
+	if len(chains) == 0 {
+		return errors.New("no chain specified")
+	}
+	ids := map[string]bool{}
+	for _, chain := range chains {
+		if !chainIDPattern.MatchString(chain.ID) {
+			return errors.New("chain id " + chain.ID + " should only have letters, digits, '_' and '-'")
+		}
+		if chain.Genesis < 0 {
+			return fmt.Errorf("invalid genesis block %v of chain %v", chain.Genesis, chain.ID)
+		}
+		if len(chain.IPCs) == 0 {
+			return errors.New("chain " + chain.ID + " has no endpoint")
+		}
+		if ids[chain.ID] {
+			return errors.New("duplicate chain id " + chain.ID)
+		}
+		ids[chain.ID] = true
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseChain(t *testing.T) {
+	chain, err := ParseChain("1=/geth.ipc,http://127.0.0.1:8545")
+	assert.Nil(t, err)
+	assert.Equal(t, ChainConfig{ID: "1", IPCs: []string{"/geth.ipc", "http://127.0.0.1:8545"}, Genesis: 0}, chain)
+
+	chain, err = ParseChain("goerli:100=ws://127.0.0.1:8546")
+	assert.Nil(t, err)
+	assert.Equal(t, ChainConfig{ID: "goerli", IPCs: []string{"ws://127.0.0.1:8546"}, Genesis: 100}, chain)
+
+	for _, value := range []string{"", "1", "1=", "=/geth.ipc", "a/b=/geth.ipc", "1:x=/geth.ipc", "1:-1=/geth.ipc"} {
+		_, err = ParseChain(value)
+		assert.NotNil(t, err, value)
+	}
+}
+
+func TestValidateChains(t *testing.T) {
+	assert.NotNil(t, ValidateChains(nil))
+	ipcs := []string{"/geth.ipc"}
+	assert.Nil(t, ValidateChains([]ChainConfig{{ID: "1", IPCs: ipcs}, {ID: "3", IPCs: ipcs}}))
+	assert.NotNil(t, ValidateChains([]ChainConfig{{ID: "1", IPCs: ipcs}, {ID: "1", IPCs: ipcs}}))
+	assert.NotNil(t, ValidateChains([]ChainConfig{{ID: "", IPCs: ipcs}}))
+	assert.NotNil(t, ValidateChains([]ChainConfig{{ID: "1", IPCs: ipcs, Genesis: -1}}))
+	assert.NotNil(t, ValidateChains([]ChainConfig{{ID: "1"}}))
+}
@@ -2,31 +2,217 @@ package config
 
 import (
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 )
 
-// Configuration for the indexer
+// Modes of api keys of the public api
+const (
+	// APIKeyOptional requests without api key are limited by ip, requests with an invalid key are rejected
+	APIKeyOptional = "optional"
+	// APIKeyRequired requests without a valid api key are rejected
+	APIKeyRequired = "required"
+)
+
+// Fields of transactions that can be kept in the database, see Configuration.ExtraFields
+const (
+	ExtraData                 = "data"
+	ExtraGas                  = "gas"
+	ExtraGasPrice             = "gasPrice"
+	ExtraType                 = "type"
+	ExtraNonce                = "nonce"
+	ExtraMaxFeePerGas         = "maxFeePerGas"
+	ExtraMaxPriorityFeePerGas = "maxPriorityFeePerGas"
+	ExtraEffectiveGasPrice    = "effectiveGasPrice"
+	// ExtraGasUsed is read from the receipt of the transaction, one more call to the node per transaction
+	ExtraGasUsed = "gasUsed"
+)
+
+// ExtraFieldNames all fields of transactions that can be kept in the database
+var ExtraFieldNames = []string{ExtraData, ExtraGas, ExtraGasPrice, ExtraType, ExtraNonce, ExtraMaxFeePerGas,
+	ExtraMaxPriorityFeePerGas, ExtraEffectiveGasPrice, ExtraGasUsed}
+
+// Configuration for the indexer. CleanInterval, WatcherInterval, LogLevel, AdminUsers and Chains can change on reload,
+// read them with their getters while indexing
 type Configuration struct {
 	CleanInterval   time.Duration
 	BlockTTL        time.Duration
 	WatcherInterval time.Duration
+	// PollInterval interval to poll new headers of endpoints that do not support subscription
+	PollInterval time.Duration
+	// ProbeInterval interval to probe health of all endpoints
+	ProbeInterval time.Duration
+	// ProgressInterval interval to log batch progress
+	ProgressInterval time.Duration
+	// GapInterval interval to look for blocks missed by realtime index
+	GapInterval time.Duration
 	// OOSThreshold threshold
 	OOSThreshold time.Duration
 	Port         int
 	NumBatch     int
-	DbPath       string
-	StartTime    time.Time
+	ChunkSize    int64
+	// FetchBatchSize number of blocks in a json-rpc batch request
+	FetchBatchSize int
+	// Quorum number of endpoints that have to agree on a block before it's stored, quorum mode is disabled below 2
+	Quorum int
+	// SenderMode how to get sender of transactions: "rpc" or "local"
+	SenderMode string
+	// Backend storage backend of the database: "leveldb" or "pebble"
+	Backend string
+	DbPath  string
+	// BackupDir directory of backups taken by the admin api, empty for DbPath + "_backups"
+	BackupDir string
+	// Chains chains indexed by this process, the first one is the default chain of the api
+	Chains []ChainConfig
+	// LogLevel "info", "warn", "debug"..., it can change on reload
+	LogLevel string
+	// AdminUsers users of the admin api, they can change on reload
+	AdminUsers []AdminUser
+	// CORSOrigins origins allowed to call the public api from a browser, "*" for all
+	CORSOrigins []string
+	// RateLimit requests per second of a client to the public api, 0 to disable
+	RateLimit float64
+	// RateBurst requests a client can do at once
+	RateBurst int
+	// APIKeyMode APIKeyOptional or APIKeyRequired
+	APIKeyMode string
+	// QueryBudget max number of address records an account query reads, 0 for no limit
+	QueryBudget int
+	// QueryTimeout max duration of an account query, 0 for no limit.
+	// A query that reaches a limit returns a partial total flagged as approximate
+	QueryTimeout time.Duration
+	// ExtraFields fields of ExtraFieldNames kept in the database when blocks are indexed, they are fetched from the node otherwise
+	ExtraFields []string
+	// CacheSize max number of account query results and of transaction extras cached per chain, 0 to disable
+	CacheSize int
+	// File path of the config file, empty if there is none
+	File      string
+	StartTime time.Time
 }
 
 func (con *Configuration) String() string {
-	return fmt.Sprintf("CleanInterval=%v BlockTTL=%v WatcherInterval=%v OOSThreshold=%v Port=%v NumBatch=%v DbPath=%v StartTime=%v",
-		con.CleanInterval, con.BlockTTL, con.WatcherInterval, con.OOSThreshold, con.Port, con.NumBatch, con.DbPath, con.StartTime.Format(time.RFC3339))
+	reloadMutex.RLock()
+	defer reloadMutex.RUnlock()
+	return fmt.Sprintf("CleanInterval=%v BlockTTL=%v WatcherInterval=%v PollInterval=%v ProbeInterval=%v ProgressInterval=%v GapInterval=%v OOSThreshold=%v Port=%v NumBatch=%v ChunkSize=%v FetchBatchSize=%v Quorum=%v SenderMode=%v Backend=%v DbPath=%v BackupDir=%v Chains=%v LogLevel=%v AdminUsers=%v CORSOrigins=%v RateLimit=%v RateBurst=%v APIKeyMode=%v QueryBudget=%v QueryTimeout=%v CacheSize=%v ExtraFields=%v File=%v StartTime=%v",
+		con.CleanInterval, con.BlockTTL, con.WatcherInterval, con.PollInterval, con.ProbeInterval, con.ProgressInterval, con.GapInterval, con.OOSThreshold, con.Port, con.NumBatch, con.ChunkSize, con.FetchBatchSize, con.Quorum, con.SenderMode, con.Backend, con.DbPath, con.BackupDir, con.Chains, con.LogLevel, con.AdminUsers, con.CORSOrigins, con.RateLimit, con.RateBurst, con.APIKeyMode, con.QueryBudget, con.QueryTimeout, con.CacheSize, con.ExtraFields, con.File, con.StartTime.Format(time.RFC3339))
+}
+
+// GetCleanInterval interval of the block db cleaner
+func (con *Configuration) GetCleanInterval() time.Duration {
+	reloadMutex.RLock()
+	defer reloadMutex.RUnlock()
+	return con.CleanInterval
+}
+
+// GetWatcherInterval interval of the node status watcher
+func (con *Configuration) GetWatcherInterval() time.Duration {
+	reloadMutex.RLock()
+	defer reloadMutex.RUnlock()
+	return con.WatcherInterval
+}
+
+// GetAdminUsers users of the admin api
+func (con *Configuration) GetAdminUsers() []AdminUser {
+	reloadMutex.RLock()
+	defer reloadMutex.RUnlock()
+	return con.AdminUsers
+}
+
+// GetLogLevel level of the logs
+func (con *Configuration) GetLogLevel() string {
+	reloadMutex.RLock()
+	defer reloadMutex.RUnlock()
+	return con.LogLevel
+}
+
+// GetChains chains indexed by this process, their endpoints
+func (con *Configuration) GetChains() []ChainConfig {
+	reloadMutex.RLock()
+	defer reloadMutex.RUnlock()
+	return con.Chains
+}
+
+// KeepsExtra whether field of ExtraFieldNames is kept in the database
+func (con *Configuration) KeepsExtra(field string) bool {
+	for _, kept := range con.ExtraFields {
+		if kept == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Reload apply the settings of newCon that can change while indexing: clean and watcher intervals,
+// log level, admin users and endpoints of the chains. It returns the names of other settings that differ, they need a restart.
+func (con *Configuration) Reload(newCon *Configuration) []string {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+	con.CleanInterval = newCon.CleanInterval
+	con.WatcherInterval = newCon.WatcherInterval
+	con.LogLevel = newCon.LogLevel
+	con.AdminUsers = newCon.AdminUsers
+	restart := []string{}
+	if sameChains(con.Chains, newCon.Chains) {
+		con.Chains = newCon.Chains
+	} else {
+		restart = append(restart, "Chains")
+	}
+	settings := []struct {
+		name     string
+		old, new interface{}
+	}{
+		{"BlockTTL", con.BlockTTL, newCon.BlockTTL},
+		{"PollInterval", con.PollInterval, newCon.PollInterval},
+		{"ProbeInterval", con.ProbeInterval, newCon.ProbeInterval},
+		{"ProgressInterval", con.ProgressInterval, newCon.ProgressInterval},
+		{"GapInterval", con.GapInterval, newCon.GapInterval},
+		{"OOSThreshold", con.OOSThreshold, newCon.OOSThreshold},
+		{"Port", con.Port, newCon.Port},
+		{"NumBatch", con.NumBatch, newCon.NumBatch},
+		{"ChunkSize", con.ChunkSize, newCon.ChunkSize},
+		{"FetchBatchSize", con.FetchBatchSize, newCon.FetchBatchSize},
+		{"Quorum", con.Quorum, newCon.Quorum},
+		{"SenderMode", con.SenderMode, newCon.SenderMode},
+		{"Backend", con.Backend, newCon.Backend},
+		{"DbPath", con.DbPath, newCon.DbPath},
+		{"BackupDir", con.BackupDir, newCon.BackupDir},
+		{"CORSOrigins", strings.Join(con.CORSOrigins, ","), strings.Join(newCon.CORSOrigins, ",")},
+		{"RateLimit", con.RateLimit, newCon.RateLimit},
+		{"RateBurst", con.RateBurst, newCon.RateBurst},
+		{"APIKeyMode", con.APIKeyMode, newCon.APIKeyMode},
+		{"QueryBudget", con.QueryBudget, newCon.QueryBudget},
+		{"QueryTimeout", con.QueryTimeout, newCon.QueryTimeout},
+		{"CacheSize", con.CacheSize, newCon.CacheSize},
+		{"ExtraFields", strings.Join(con.ExtraFields, ","), strings.Join(newCon.ExtraFields, ",")},
+	}
+	for _, setting := range settings {
+		if setting.old != setting.new {
+			restart = append(restart, setting.name)
+		}
+	}
+	return restart
+}
+
+// sameChains whether chains have the same ids and genesis blocks in the same order, only their endpoints differ
+func sameChains(chains []ChainConfig, newChains []ChainConfig) bool {
+	if len(chains) != len(newChains) {
+		return false
+	}
+	for i := range chains {
+		if chains[i].ID != newChains[i].ID || chains[i].Genesis != newChains[i].Genesis {
+			return false
+		}
+	}
+	return true
 }
 
 var config *Configuration
 var once sync.Once
 
+// reloadMutex guards the settings that can change on reload
+var reloadMutex sync.RWMutex
+
 // GetConfig Singleton
 func GetConfig() *Configuration {
 	once.Do(func() {
@@ -34,3 +220,11 @@ func GetConfig() *Configuration {
 	})
 	return config
 }
+
+// SetConfig replace the settings of the singleton with the ones of con in one step
+func SetConfig(con *Configuration) {
+	current := GetConfig()
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+	*current = *con
+}
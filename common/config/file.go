@@ -0,0 +1,92 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// File settings of a YAML config file, a setting that is not in the file is nil.
+// Durations are strings like "30s", "5m" or "4h".
+type File struct {
+	IPC              []string       `yaml:"ipc"`
+	Genesis          *int64         `yaml:"genesis"`
+	Chains           []FileChain    `yaml:"chains"`
+	DbPath           *string        `yaml:"db"`
+	Backend          *string        `yaml:"backend"`
+	BackupDir        *string        `yaml:"backupDir"`
+	Port             *int           `yaml:"port"`
+	NumBatch         *int           `yaml:"batchWorkers"`
+	ChunkSize        *int64         `yaml:"chunkSize"`
+	FetchBatchSize   *int           `yaml:"fetchBatchSize"`
+	Quorum           *int           `yaml:"quorum"`
+	SenderMode       *string        `yaml:"sender"`
+	CleanInterval    *time.Duration `yaml:"cleanInterval"`
+	BlockTTL         *time.Duration `yaml:"blockTTL"`
+	WatcherInterval  *time.Duration `yaml:"watcherInterval"`
+	PollInterval     *time.Duration `yaml:"pollInterval"`
+	ProbeInterval    *time.Duration `yaml:"probeInterval"`
+	ProgressInterval *time.Duration `yaml:"progressInterval"`
+	GapInterval      *time.Duration `yaml:"gapInterval"`
+	OOSThreshold     *time.Duration `yaml:"oosThreshold"`
+	LogLevel         *string        `yaml:"logLevel"`
+	Admin            *FileAdmin     `yaml:"admin"`
+	CORSOrigins      []string       `yaml:"corsOrigins"`
+	RateLimit        *FileRateLimit `yaml:"rateLimit"`
+	APIKeyMode       *string        `yaml:"apiKeys"`
+	QueryBudget      *int           `yaml:"queryBudget"`
+	QueryTimeout     *time.Duration `yaml:"queryTimeout"`
+	CacheSize        *int           `yaml:"cacheSize"`
+	ExtraFields      []string       `yaml:"extras"`
+}
+
+// FileChain a chain of the config file
+type FileChain struct {
+	ID        string   `yaml:"id"`
+	Genesis   int64    `yaml:"genesis"`
+	Endpoints []string `yaml:"endpoints"`
+}
+
+// FileAdmin users of the admin api, user and password is an operator with a plain password
+type FileAdmin struct {
+	User     string      `yaml:"user"`
+	Password string      `yaml:"password"`
+	Users    []AdminUser `yaml:"users"`
+}
+
+// FileRateLimit rate limit of the public api per client
+type FileRateLimit struct {
+	RequestsPerSecond float64 `yaml:"requestsPerSecond"`
+	Burst             int     `yaml:"burst"`
+}
+
+// LoadFile read a config file, unknown settings and values of the wrong type are errors with their line numbers
+func LoadFile(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	file := &File{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(file); err != nil && err != io.EOF {
+		return nil, errors.New("config file " + path + ": " + err.Error())
+	}
+	return file, nil
+}
+
+// ChainConfigs chains of the file, nil if it has none
+func (file *File) ChainConfigs() []ChainConfig {
+	if len(file.Chains) == 0 {
+		return nil
+	}
+	chains := []ChainConfig{}
+	for _, chain := range file.Chains {
+		chains = append(chains, ChainConfig{ID: chain.ID, IPCs: chain.Endpoints, Genesis: chain.Genesis})
+	}
+	return chains
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "indexer.yaml")
+	assert.Nil(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestLoadFile(t *testing.T) {
+	path := writeFile(t, `
+db: /data/indexer
+port: 3001
+watcherInterval: 2m
+chains:
+  - id: "1"
+    endpoints: [/geth.ipc, "http://127.0.0.1:8545"]
+  - id: goerli
+    genesis: 100
+    endpoints: ["ws://127.0.0.1:8546"]
+admin:
+  user: admin
+  password: secret
+  users:
+    - name: alice
+      passwordHash: $2a$04$abcdefghijklmnopqrstuu5Z4yRJf2cCxEuyy7BwnJ8W7ybbFDu7.
+      role: operator
+    - name: ci
+      tokenHash: f0d3c267f5921ebd8187b1b67ac2954892a888034fc69b8876111d59960a9fba
+      role: readonly
+corsOrigins: ["*"]
+rateLimit:
+  requestsPerSecond: 5
+  burst: 10
+`)
+	file, err := LoadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "/data/indexer", *file.DbPath)
+	assert.Equal(t, 3001, *file.Port)
+	assert.Equal(t, 2*time.Minute, *file.WatcherInterval)
+	assert.Nil(t, file.CleanInterval)
+	assert.Equal(t, []ChainConfig{
+		{ID: "1", IPCs: []string{"/geth.ipc", "http://127.0.0.1:8545"}},
+		{ID: "goerli", IPCs: []string{"ws://127.0.0.1:8546"}, Genesis: 100},
+	}, file.ChainConfigs())
+	assert.Equal(t, "secret", file.Admin.Password)
+	assert.Equal(t, []AdminUser{
+		{Name: "alice", PasswordHash: "$2a$04$abcdefghijklmnopqrstuu5Z4yRJf2cCxEuyy7BwnJ8W7ybbFDu7.", Role: RoleOperator},
+		{Name: "ci", TokenHash: "f0d3c267f5921ebd8187b1b67ac2954892a888034fc69b8876111d59960a9fba", Role: RoleReadOnly},
+	}, file.Admin.Users)
+	assert.Equal(t, []string{"*"}, file.CORSOrigins)
+	assert.Equal(t, 5.0, file.RateLimit.RequestsPerSecond)
+
+	file, err = LoadFile(writeFile(t, ""))
+	assert.Nil(t, err)
+	assert.Nil(t, file.ChainConfigs())
+
+	// unknown settings and wrong types have line numbers
+	_, err = LoadFile(writeFile(t, "port: 3001\nwatcher: 2m\n"))
+	assert.Contains(t, err.Error(), "line 2: field watcher not found")
+	_, err = LoadFile(writeFile(t, "port: abc\n"))
+	assert.Contains(t, err.Error(), "line 1")
+	_, err = LoadFile(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.NotNil(t, err)
+}
+
+func TestReload(t *testing.T) {
+	chains := []ChainConfig{{ID: "1", IPCs: []string{"ipc1"}}}
+	con := &Configuration{CleanInterval: time.Minute, WatcherInterval: time.Minute, LogLevel: "info", Port: 3000, Chains: chains}
+	newCon := &Configuration{CleanInterval: time.Hour, WatcherInterval: 2 * time.Hour, LogLevel: "debug", Port: 3000,
+		Chains: []ChainConfig{{ID: "1", IPCs: []string{"ipc2", "ipc1"}}}}
+	assert.Equal(t, []string{}, con.Reload(newCon))
+	assert.Equal(t, time.Hour, con.GetCleanInterval())
+	assert.Equal(t, 2*time.Hour, con.GetWatcherInterval())
+	assert.Equal(t, "debug", con.GetLogLevel())
+	assert.Equal(t, []string{"ipc2", "ipc1"}, con.GetChains()[0].IPCs)
+
+	// admin users are applied
+	users := []AdminUser{{Name: "ci", TokenHash: HashToken("token"), Role: RoleReadOnly}}
+	newCon.AdminUsers = users
+	assert.Equal(t, []string{}, con.Reload(newCon))
+	assert.Equal(t, users, con.GetAdminUsers())
+
+	// other settings are not applied
+	newCon = &Configuration{CleanInterval: time.Hour, WatcherInterval: 2 * time.Hour, LogLevel: "debug", Port: 3001,
+		Chains: []ChainConfig{{ID: "1", IPCs: []string{"ipc1"}}, {ID: "5", IPCs: []string{"ipc5"}}}}
+	assert.Equal(t, []string{"Chains", "Port"}, con.Reload(newCon))
+	assert.Equal(t, 3000, con.Port)
+	assert.Equal(t, 1, len(con.GetChains()))
+}
+
+func TestSetConfig(t *testing.T) {
+	defer SetConfig(&Configuration{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			GetConfig().GetChains()
+			GetConfig().GetLogLevel()
+		}
+	}()
+	chains := []ChainConfig{{ID: "1", IPCs: []string{"ipc1"}}}
+	for i := 0; i < 100; i++ {
+		SetConfig(&Configuration{LogLevel: "info", Chains: chains})
+		GetConfig().Reload(&Configuration{LogLevel: "debug", Chains: chains})
+	}
+	<-done
+	assert.Equal(t, "debug", GetConfig().GetLogLevel())
+	assert.Equal(t, chains, GetConfig().GetChains())
+}
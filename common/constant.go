@@ -5,9 +5,9 @@ const (
 	AddressZero = "0x0000000000000000000000000000000000000000"
 	// DefaultIpc the default ipc path
 	DefaultIpc = "/home/blockform/.ethereum/geth.ipc"
-	// DefaultDbPath default database path, a folder then prefix
+	// DefaultDbPath default database path, databases of older versions are at this path with suffixes "_address", "_block" and "_batch"
 	DefaultDbPath = "/home/blockform/account-indexer-db/geth_indexer_leveldb"
-	// NumMaxTransaction if number of transaction is more than this, just return +10000 to the client
+	// NumMaxTransaction if address counters are not built and number of transaction is more than this, just return +10000 to the client
 	NumMaxTransaction = 10000
 	// DefaultCleanInterval In minute
 	DefaultCleanInterval = 5
@@ -15,10 +15,46 @@ const (
 	DefaultBlockTTL = 4
 	// DefaultWatcherInterval in minute
 	DefaultWatcherInterval = 5
+	// DefaultProgressInterval in minute
+	DefaultProgressInterval = 1
+	// DefaultGapInterval in minute
+	DefaultGapInterval = 5
+	// DefaultPollInterval in second
+	DefaultPollInterval = 5
+	// DefaultProbeInterval in second
+	DefaultProbeInterval = 15
 	// DefaultOOSThreshold in second
 	DefaultOOSThreshold = 300
 	// DefaultHTTPPort default http port
 	DefaultHTTPPort = 3000
-	// DefaultNumBatch default number of init batch
+	// DefaultNumBatch default number of batch workers
 	DefaultNumBatch = 8
+	// DefaultChunkSize default number of blocks in a batch chunk
+	DefaultChunkSize = 100000
+	// DefaultFetchBatchSize default number of blocks in a json-rpc batch request
+	DefaultFetchBatchSize = 10
+	// DefaultQuorum quorum mode is disabled by default
+	DefaultQuorum = 0
+	// DefaultSenderMode get sender of transactions from geth node by default
+	DefaultSenderMode = "rpc"
+	// DefaultBackend storage backend of the database
+	DefaultBackend = "leveldb"
+	// DefaultChainID id of the chain of --ipc, its key spaces are the ones of single chain databases
+	DefaultChainID = "default"
+	// DefaultGenesis Ethereum mainnet has genesis block as 0
+	DefaultGenesis = 0
+	// DefaultLogLevel default log level
+	DefaultLogLevel = "info"
+	// DefaultRateLimit rate limit of the public api is disabled by default
+	DefaultRateLimit = 0
+	// DefaultRateBurst default number of requests a client can do at once
+	DefaultRateBurst = 20
+	// DefaultAPIKeyMode api keys of the public api are optional by default
+	DefaultAPIKeyMode = "optional"
+	// DefaultQueryBudget max number of address records an account query reads
+	DefaultQueryBudget = 100000
+	// DefaultQueryTimeout in second
+	DefaultQueryTimeout = 5
+	// DefaultCacheSize max number of account query results and of transaction extras cached per chain
+	DefaultCacheSize = 10000
 )
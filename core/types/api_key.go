@@ -0,0 +1,22 @@
+package types
+
+import (
+	"fmt"
+)
+
+// APIKey a key of a client of the public api, only the sha256 of the key is stored
+type APIKey struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Hash string `json:"hash"`
+	// RateLimit requests per second of the key, 0 for the rate limit of the config
+	RateLimit float64 `json:"rateLimit"`
+	// RateBurst requests the key can do at once, 0 for the burst of the config
+	RateBurst int   `json:"rateBurst"`
+	Disabled  bool  `json:"disabled"`
+	CreatedAt int64 `json:"createdAt"`
+}
+
+func (key APIKey) String() string {
+	return fmt.Sprintf("ID %v, Name %v, RateLimit %v, RateBurst %v, Disabled %v", key.ID, key.Name, key.RateLimit, key.RateBurst, key.Disabled)
+}
@@ -0,0 +1,17 @@
+package types
+
+import (
+	"time"
+)
+
+// BackupManifest describes the records of a backup tarball of the index
+type BackupManifest struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Backend       string `json:"backend"`
+	// LastBlocks latest block of every chain by chain id, chains without blocks are left out
+	LastBlocks map[string]string `json:"lastBlocks"`
+	NumRecords int64             `json:"numRecords"`
+	// Checksum hex sha256 of all records
+	Checksum  string    `json:"checksum"`
+	CreatedAt time.Time `json:"createdAt"`
+}
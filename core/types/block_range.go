@@ -0,0 +1,15 @@
+package types
+
+import (
+	"fmt"
+)
+
+// BlockRange contiguous blocks from From to To (inclusive)
+type BlockRange struct {
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+}
+
+func (br BlockRange) String() string {
+	return fmt.Sprintf("From %v, To %v", br.From, br.To)
+}
@@ -14,13 +14,29 @@ type TransactionDetail struct {
 	To     string
 	TxHash string
 	Value  *big.Int
+	// Extra fields of the transaction kept in the database, nil if none is kept
+	Extra *TransactionExtra
+	// RecordType RecordTransaction or the type of a pseudo-transaction, TxHash is the block hash then
+	RecordType uint8
 }
 
-// TransactionExtra additional data to query geth node on the fly, this is not store in indexer DB
+// TransactionExtra additional data of a transaction, queried from geth node on the fly or kept in the
+// indexer DB for the fields of --extras. Fields that are not kept are empty
 type TransactionExtra struct {
-	Data     []byte
-	Gas      uint64
-	GasPrice *big.Int
+	Data []byte `json:"data,omitempty"`
+	Gas  uint64 `json:"gas,omitempty"`
+	// GasPrice max fee per gas of EIP-1559 transactions, see EffectiveGasPrice for the price paid
+	GasPrice *big.Int `json:"gasPrice,omitempty"`
+	// Type 0 for legacy transactions, 1 for EIP-2930, 2 for EIP-1559 and 3 for EIP-4844 transactions
+	Type  uint8  `json:"type,omitempty"`
+	Nonce uint64 `json:"nonce,omitempty"`
+	// MaxFeePerGas and MaxPriorityFeePerGas of transactions of type 2 and above, nil for others
+	MaxFeePerGas         *big.Int `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas *big.Int `json:"maxPriorityFeePerGas,omitempty"`
+	// EffectiveGasPrice price paid per gas: base fee plus priority fee of EIP-1559 transactions, gas price of others
+	EffectiveGasPrice *big.Int `json:"effectiveGasPrice,omitempty"`
+	// GasUsed gas used by the transaction, from its receipt
+	GasUsed uint64 `json:"gasUsed,omitempty"`
 }
 
 // BLockDetail data received from blockchain
@@ -0,0 +1,45 @@
+package types
+
+import (
+	"time"
+)
+
+// EndpointStatus health of a geth endpoint according to the last probes
+type EndpointStatus struct {
+	Endpoint  string
+	Transport string
+	// LatestBlock -1 if it's never probed successfully
+	LatestBlock int64
+	// PeerCount -1 if the endpoint does not support net_peerCount
+	PeerCount int64
+	Latency   time.Duration
+	LastProbe time.Time
+	LastError string
+	// Failures number of consecutive failed probes
+	Failures int
+	// Successes number of consecutive probes that found the endpoint healthy
+	Successes int
+	Score     float64
+	Current   bool
+}
+
+// IsHealthy whether the endpoint can be used
+func (es EndpointStatus) IsHealthy() bool {
+	return es.Score > 0
+}
+
+// Vote block hash and number of transactions returned by an endpoint in quorum mode
+type Vote struct {
+	Endpoint string
+	Hash     string
+	NumTx    int
+	// Error the endpoint could not return the block
+	Error string
+}
+
+// Disagreement endpoints that did not agree on a block in quorum mode
+type Disagreement struct {
+	BlockNumber int64
+	Time        time.Time
+	Votes       []Vote
+}
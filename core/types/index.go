@@ -19,6 +19,31 @@ type AddressIndex struct {
 	Time   *big.Int `json:"time"`
 	// BlockNumber   *big.Int `json:"blockNumber"`
 	CoupleAddress string `json:"coupleAddress"`
+	// RecordType RecordTransaction or the type of a pseudo-transaction
+	RecordType uint8 `json:"recordType,omitempty"`
+}
+
+// Types of address records, records that are not RecordTransaction are pseudo-transactions: balance changes
+// of an address that are not transactions, their TxHash is the hash of their block (zero for genesis allocations)
+const (
+	RecordTransaction uint8 = iota
+	// RecordBlockReward static reward (without fees) of the miner of a proof of work block, including uncle inclusion rewards
+	RecordBlockReward
+	// RecordUncleReward reward of the miner of an uncle of a proof of work block
+	RecordUncleReward
+	// RecordWithdrawal withdrawal from the beacon chain
+	RecordWithdrawal
+	// RecordGenesis allocation of the genesis block, imported from a genesis file
+	RecordGenesis
+)
+
+// RecordTypeNames names of record types in the api
+var RecordTypeNames = map[uint8]string{
+	RecordTransaction: "transaction",
+	RecordBlockReward: "blockReward",
+	RecordUncleReward: "uncleReward",
+	RecordWithdrawal:  "withdrawal",
+	RecordGenesis:     "genesis",
 }
 
 // AddressSequence In same block, 1 address can stay in multiple transactions, especially the "to"
@@ -0,0 +1,14 @@
+package types
+
+import "time"
+
+// ProgressReport overall progress of all batches
+type ProgressReport struct {
+	TotalBlocks int64
+	DoneBlocks  int64
+	Percent     float64
+	// BlocksPerSecond speed for each sliding window
+	BlocksPerSecond map[time.Duration]float64
+	// ETA is 0 if there is no speed yet
+	ETA time.Duration
+}
@@ -0,0 +1,53 @@
+package types
+
+import (
+	"time"
+)
+
+const (
+	// RecordMissing a record of the chain is not in the address database
+	RecordMissing = "missing"
+	// RecordExtra a record of the address database is not in the chain
+	RecordExtra = "extra"
+	// RecordMismatched a record of the address database differs from the chain
+	RecordMismatched = "mismatched"
+)
+
+// VerifyIssue a record of the address database that differs from the chain
+type VerifyIssue struct {
+	Kind        string `json:"kind"`
+	BlockNumber int64  `json:"blockNumber"`
+	Address     string `json:"address"`
+	Sequence    uint8  `json:"sequence"`
+	// Expected record of the chain, nil for an extra record
+	Expected *AddressIndex `json:"expected"`
+	// Found record of the address database, nil for a missing record
+	Found *AddressIndex `json:"found"`
+}
+
+// VerifyReport result of verifying a block range of the address database against the chain
+type VerifyReport struct {
+	Running bool  `json:"running"`
+	From    int64 `json:"from"`
+	To      int64 `json:"to"`
+	Repair  bool  `json:"repair"`
+	// Current last verified block
+	Current    int64 `json:"current"`
+	NumBlocks  int64 `json:"numBlocks"`
+	NumRecords int64 `json:"numRecords"`
+	Missing    int64 `json:"missing"`
+	Extra      int64 `json:"extra"`
+	Mismatched int64 `json:"mismatched"`
+	// Repaired number of blocks whose records are repaired
+	Repaired int64 `json:"repaired"`
+	// Issues the first issues found, the counts above include all of them
+	Issues     []VerifyIssue `json:"issues"`
+	Error      string        `json:"error"`
+	StartedAt  time.Time     `json:"startedAt"`
+	FinishedAt time.Time     `json:"finishedAt"`
+}
+
+// NumIssues total number of missing, extra and mismatched records
+func (report VerifyReport) NumIssues() int64 {
+	return report.Missing + report.Extra + report.Mismatched
+}
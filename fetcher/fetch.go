@@ -2,9 +2,14 @@ package fetcher
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"math/big"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/WeTrustPlatform/account-indexer/common/config"
 	"github.com/WeTrustPlatform/account-indexer/core/types"
 	"github.com/WeTrustPlatform/account-indexer/service"
 	ethereum "github.com/ethereum/go-ethereum"
@@ -13,10 +18,14 @@ import (
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	gethtypes "github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
 	log "github.com/sirupsen/logrus"
 )
 
-//EthClient the Client of geth
+// probeTimeout an endpoint that does not answer in time is considered unhealthy
+const probeTimeout = 5 * time.Second
+
+// EthClient the Client of geth
 type EthClient interface {
 	SubscribeNewHead(ctx context.Context, ch chan<- *gethtypes.Header) (ethereum.Subscription, error)
 	BlockByNumber(ctx context.Context, number *big.Int) (*gethtypes.Block, error)
@@ -24,138 +33,211 @@ type EthClient interface {
 	HeaderByNumber(ctx context.Context, number *big.Int) (*gethtypes.Header, error)
 	TransactionReceipt(ctx context.Context, txHash common.Hash) (*gethtypes.Receipt, error)
 	TransactionByHash(ctx context.Context, hash common.Hash) (*gethtypes.Transaction, bool, error)
+	ChainID(ctx context.Context) (*big.Int, error)
 	Close()
 }
 
 // Fetch the interface to interact with blockchain
 type Fetch interface {
-	RealtimeFetch(ch chan<- *types.BLockDetail)
+	RealtimeFetch(ctx context.Context, ch chan<- *types.BLockDetail)
 	FetchABlock(blockNumber *big.Int) (*types.BLockDetail, error)
 	GetLatestBlock() (*big.Int, error)
-	TransactionByHash(txHash string) (*types.TransactionExtra, error)
+	// TransactionByHash additional data of a transaction, withReceipt also gets the gas used and effective gas price from its receipt
+	TransactionByHash(txHash string, withReceipt bool) (*types.TransactionExtra, error)
 }
 
 // ChainFetch the real implementation
 type ChainFetch struct {
 	Client             EthClient
+	RPC                RPCClient
 	blockHeaderChannel chan *gethtypes.Header
 	ethSub             ethereum.Subscription
+	transport          string
+	endpoint           string
+	peers              map[string]RPCClient
+	peersMutex         sync.Mutex
+	chainIDOnce        sync.Once
+	chainID            *big.Int
+	// ipcManager endpoints of the chain of this fetcher, the global one if nil
+	ipcManager *service.IpcManager
 }
 
-// NewChainFetch new ChainFetch instance
+// NewChainFetch new ChainFetch instance of the global ipc manager
 func NewChainFetch() (*ChainFetch, error) {
-	ipcPath := service.GetIpcManager().GetIPC()
-	client, err := ethclient.Dial(ipcPath)
+	return NewChainFetchOf(service.GetIpcManager())
+}
+
+// NewChainFetchOf new ChainFetch instance connected to the current ipc of ipcManager
+func NewChainFetchOf(ipcManager *service.IpcManager) (*ChainFetch, error) {
+	ipcPath := ipcManager.GetIPC()
+	transport, rpcClient, err := dial(ipcPath)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"ipc":   ipcPath,
 			"error": err.Error(),
 		}).Error("ChainFetch: Cannot dial")
-		switchIPC()
+		go ipcManager.ForceChangeIPC()
 		return nil, err
 	}
-	fetcher := &ChainFetch{Client: client}
+	fetcher := &ChainFetch{Client: ethclient.NewClient(rpcClient), RPC: rpcClient, transport: transport, endpoint: ipcPath, ipcManager: ipcManager}
 	fetcher.blockHeaderChannel = nil
 	return fetcher, err
 }
 
-// IpcUpdated no need to implement IpcSubscriber interface
-// Let indexer update me
-func (cf *ChainFetch) IpcUpdated() {
-	// finish any ongoing go-routines of this fetcher
-	if cf.ethSub != nil {
-		cf.ethSub.Unsubscribe()
+// dial connect to an endpoint with the transport of its url scheme
+func dial(endpoint string) (string, *rpc.Client, error) {
+	transport, err := service.GetTransport(endpoint)
+	if err != nil {
+		return "", nil, err
 	}
-	log.Info("ChainFetch: Unsubscribed the old ipc, wait for 30s")
-	time.Sleep(30 * time.Second)
-	log.Info("ChainFetch: 30s passed, closing blockHeaderChannel")
-	// writer should be the one to close the channel?
-	if cf.blockHeaderChannel != nil {
-		// This should finish the RealtimeFetch for loop
-		close(cf.blockHeaderChannel)
+	ctx := context.Background()
+	var rpcClient *rpc.Client
+	switch transport {
+	case service.TransportHTTP:
+		rpcClient, err = rpc.DialHTTP(endpoint)
+	case service.TransportWS:
+		rpcClient, err = rpc.DialWebsocket(ctx, endpoint, "")
+	default:
+		rpcClient, err = rpc.DialIPC(ctx, strings.TrimPrefix(endpoint, "ipc://"))
 	}
-	cf.Client.Close()
+	return transport, rpcClient, err
 }
 
-// RealtimeFetch fetch data from blockchain
-func (cf *ChainFetch) RealtimeFetch(ch chan<- *types.BLockDetail) {
-	// don't subscribe ever, let indexer do it
-	ctx := context.Background()
-	cf.blockHeaderChannel = make(chan *gethtypes.Header)
-	ethSub, err := cf.Client.SubscribeNewHead(ctx, cf.blockHeaderChannel)
+// ProbeEndpoint get latest block and peer count of an endpoint, peer count is -1 if the endpoint does not support it
+func ProbeEndpoint(endpoint string) (int64, int64, error) {
+	_, rpcClient, err := dial(endpoint)
+	if err != nil {
+		return -1, -1, err
+	}
+	defer rpcClient.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+	client := ethclient.NewClient(rpcClient)
+	latestBlock, err := client.BlockNumber(ctx)
 	if err != nil {
-		log.WithField("ipc", service.GetIpcManager().GetIPC()).Error("ChainFetch: Cannot do newHead subscribe to this ipc")
-		switchIPC()
-		return
+		return -1, -1, err
+	}
+	peerCount := int64(-1)
+	// public http endpoints usually don't expose net_peerCount
+	if count, err := client.PeerCount(ctx); err == nil {
+		peerCount = int64(count)
 	}
-	cf.ethSub = ethSub
+	return int64(latestBlock), peerCount, nil
+}
+
+// Close close all connections of this fetcher, it must not be used after that
+func (cf *ChainFetch) Close() {
+	if cf.Client != nil {
+		cf.Client.Close()
+	}
+	cf.closePeers()
+}
+
+// RealtimeFetch fetch new blocks from blockchain until ctx is cancelled or the subscription fails, ch is closed at the end
+func (cf *ChainFetch) RealtimeFetch(ctx context.Context, ch chan<- *types.BLockDetail) {
+	defer close(ch)
+	// a buffer so the subscription is not blocked while a block is fetched
+	cf.blockHeaderChannel = make(chan *gethtypes.Header, 16)
+	if cf.transport == service.TransportHTTP {
+		cf.ethSub = cf.pollNewHead()
+	} else {
+		ethSub, err := cf.Client.SubscribeNewHead(ctx, cf.blockHeaderChannel)
+		if errors.Is(err, rpc.ErrNotificationsUnsupported) {
+			ethSub = cf.pollNewHead()
+		} else if err != nil {
+			log.WithField("ipc", cf.ipcs().GetIPC()).Error("ChainFetch: Cannot do newHead subscribe to this ipc")
+			cf.switchIPC()
+			return
+		}
+		cf.ethSub = ethSub
+	}
+	defer cf.ethSub.Unsubscribe()
 
 	log.Info("ChainFetch: RealtimeFetch Waiting for new block hearders...")
 	for {
-		receivedHeader, ok := <-cf.blockHeaderChannel
-		if !ok {
-			// switched ipc
-			log.Info("ChainFetch: Stopping SubscribeNewHead, ipc is switched?")
-			close(ch)
-			break
+		var receivedHeader *gethtypes.Header
+		select {
+		case <-ctx.Done():
+			log.Info("ChainFetch: Stopping RealtimeFetch, context is cancelled")
+			return
+		case err := <-cf.ethSub.Err():
+			log.WithField("error", fmt.Sprint(err)).Error("ChainFetch: RealtimeFetch subscription failed")
+			cf.switchIPC()
+			return
+		case receivedHeader = <-cf.blockHeaderChannel:
 		}
 		blockNumber := receivedHeader.Number
-		blockDetail, err := cf.FetchABlock(blockNumber)
+		blockDetail, err := cf.fetchABlock(ctx, blockNumber)
 		if err == nil {
-			ch <- blockDetail
+			select {
+			case ch <- blockDetail:
+			case <-ctx.Done():
+				return
+			}
+		} else if err == ErrNoQuorum {
+			// not a problem of the current ipc, the block is reported in disagreements
+			log.WithField("blockNumber", blockNumber.String()).Warn("ChainFetch: RealtimeFetch skip block without quorum")
 		} else {
 			// Finish the Realtime process, someone will switch the IPC
 			log.WithField("blockNumber", blockNumber.String()).Info("ChainFetch: RealtimeFetch Cannot get block detail")
-			close(ch)
-			break
+			return
 		}
 	}
-	log.Info("ChainFetch: Stopped RealtimeFetch")
+}
+
+// pollNewHead poll latest header instead of subscribing to newHead
+func (cf *ChainFetch) pollNewHead() ethereum.Subscription {
+	interval := config.GetConfig().PollInterval
+	log.WithFields(log.Fields{
+		"ipc":      cf.ipcs().GetIPC(),
+		"interval": interval,
+	}).Info("ChainFetch: Subscription is not supported, polling new headers")
+	return newHeadPoller(cf.Client, interval, cf.blockHeaderChannel)
 }
 
 // FetchABlock fetch a block by block number
 func (cf *ChainFetch) FetchABlock(blockNumber *big.Int) (*types.BLockDetail, error) {
-	ctx := context.Background()
+	return cf.fetchABlock(context.Background(), blockNumber)
+}
+
+// fetchABlock FetchABlock until ctx is done, the ipc is not switched for errors of a done ctx
+func (cf *ChainFetch) fetchABlock(ctx context.Context, blockNumber *big.Int) (*types.BLockDetail, error) {
 	aBlock, err := cf.Client.BlockByNumber(ctx, blockNumber)
 	if err != nil {
+		if ctx.Err() != nil {
+			return &types.BLockDetail{}, ctx.Err()
+		}
 		log.WithField("error", err.Error()).Error("ChainFetch: FetchABlock BlockByNumber returns error")
-		switchIPC()
+		cf.switchIPC()
+		return &types.BLockDetail{}, err
+	}
+	senders, err := cf.getSenders(ctx, aBlock)
+	if err != nil {
 		return &types.BLockDetail{}, err
 	}
 	transactions := []types.TransactionDetail{}
+	keepsGasUsed := config.GetConfig().KeepsExtra(config.ExtraGasUsed)
 	if len(aBlock.Transactions()) > 0 {
 		for index, tx := range aBlock.Transactions() {
-			sender, err := cf.Client.TransactionSender(ctx, tx, aBlock.Hash(), uint(index))
-			if err != nil {
-				log.Error("ChainFetch: FetchABlock TransactionSender returns error " + err.Error())
-				switchIPC()
-				return &types.BLockDetail{}, err
-			}
-			// Some transactions have nil To, for example Contract creation
-			to := ""
-			if tx.To() != nil {
-				to = tx.To().String()
-			}
-			transaction := types.TransactionDetail{
-				From:   sender.String(),
-				To:     to,
-				TxHash: tx.Hash().String(),
-				Value:  tx.Value(),
-			}
-			transactions = append(transactions, transaction)
+			sender := senders[index]
 			// Index transactions that create contract too
-			if tx.To() == nil && (tx.Value() == nil || tx.Value().Int64() == 0) {
-				txRecp, err := cf.Client.TransactionReceipt(ctx, tx.Hash())
+			var contract *common.Address
+			var txRecp *gethtypes.Receipt
+			if isContractCreation(tx) || keepsGasUsed {
+				txRecp, err = cf.Client.TransactionReceipt(ctx, tx.Hash())
 				if err == nil {
-					if txRecp != nil {
-						transaction := types.TransactionDetail{
-							From:   "",
-							To:     txRecp.ContractAddress.String(),
-							TxHash: tx.Hash().String(),
-							Value:  tx.Value(),
-						}
-						transactions = append(transactions, transaction)
+					if txRecp != nil && isContractCreation(tx) {
+						contract = &txRecp.ContractAddress
 					}
+				} else if ctx.Err() != nil {
+					return &types.BLockDetail{}, ctx.Err()
+				} else if keepsGasUsed {
+					log.WithFields(log.Fields{
+						"txHash": tx.Hash().String(),
+						"error":  err.Error(),
+					}).Error("ChainFetch: FetchABlock cannot get receipt for gas used of transaction")
+					cf.switchIPC()
+					return &types.BLockDetail{}, err
 				} else {
 					log.WithFields(log.Fields{
 						"txHash": tx.Hash().String(),
@@ -167,8 +249,16 @@ func (cf *ChainFetch) FetchABlock(blockNumber *big.Int) (*types.BLockDetail, err
 					// return &types.BLockDetail{}, err
 				}
 			}
+			details := transactionDetails(tx, sender, contract)
+			transactions = append(transactions, withExtra(details, keptExtra(tx, aBlock.BaseFee(), txRecp))...)
 		}
 	}
+	blockHash := aBlock.Hash().String()
+	transactions = append(transactions, rewardDetails(chainConfig(cf.getChainID()), blockHash, aBlock.Header(), aBlock.Uncles())...)
+	transactions = append(transactions, withdrawalDetails(blockHash, aBlock.Withdrawals())...)
+	if err := cf.verify(ctx, []*blockSummary{summarize(aBlock.Number().Int64(), aBlock.Hash(), aBlock.Transactions())}); err != nil {
+		return &types.BLockDetail{}, err
+	}
 	blockDetail := types.BLockDetail{
 		BlockNumber:  aBlock.Number(),
 		Time:         new(big.Int).SetUint64(aBlock.Time()),
@@ -177,8 +267,109 @@ func (cf *ChainFetch) FetchABlock(blockNumber *big.Int) (*types.BLockDetail, err
 	return &blockDetail, nil
 }
 
+// isContractCreation transaction that creates a contract without value, the contract is indexed as a separate record
+func isContractCreation(tx *gethtypes.Transaction) bool {
+	return tx.To() == nil && (tx.Value() == nil || tx.Value().Int64() == 0)
+}
+
+// transactionDetails transform a transaction to index data, contract is the address created by the transaction if any
+func transactionDetails(tx *gethtypes.Transaction, sender common.Address, contract *common.Address) []types.TransactionDetail {
+	// Some transactions have nil To, for example Contract creation
+	to := ""
+	if tx.To() != nil {
+		to = tx.To().String()
+	}
+	result := []types.TransactionDetail{
+		types.TransactionDetail{
+			From:   sender.String(),
+			To:     to,
+			TxHash: tx.Hash().String(),
+			Value:  tx.Value(),
+		},
+	}
+	if contract != nil {
+		result = append(result, types.TransactionDetail{
+			From:   "",
+			To:     contract.String(),
+			TxHash: tx.Hash().String(),
+			Value:  tx.Value(),
+		})
+	}
+	return result
+}
+
+// withExtra set extra to details of a transaction
+func withExtra(details []types.TransactionDetail, extra *types.TransactionExtra) []types.TransactionDetail {
+	for i := range details {
+		details[i].Extra = extra
+	}
+	return details
+}
+
+// keptExtra the fields of tx kept in the database, nil if none is kept
+func keptExtra(tx *gethtypes.Transaction, baseFee *big.Int, receipt *gethtypes.Receipt) *types.TransactionExtra {
+	con := config.GetConfig()
+	if len(con.ExtraFields) == 0 {
+		return nil
+	}
+	all := transactionExtra(tx, baseFee, receipt)
+	extra := &types.TransactionExtra{}
+	for _, field := range con.ExtraFields {
+		switch field {
+		case config.ExtraData:
+			extra.Data = all.Data
+		case config.ExtraGas:
+			extra.Gas = all.Gas
+		case config.ExtraGasPrice:
+			extra.GasPrice = all.GasPrice
+		case config.ExtraType:
+			extra.Type = all.Type
+		case config.ExtraNonce:
+			extra.Nonce = all.Nonce
+		case config.ExtraMaxFeePerGas:
+			extra.MaxFeePerGas = all.MaxFeePerGas
+		case config.ExtraMaxPriorityFeePerGas:
+			extra.MaxPriorityFeePerGas = all.MaxPriorityFeePerGas
+		case config.ExtraEffectiveGasPrice:
+			extra.EffectiveGasPrice = all.EffectiveGasPrice
+		case config.ExtraGasUsed:
+			extra.GasUsed = all.GasUsed
+		}
+	}
+	return extra
+}
+
+// transactionExtra additional data of tx, baseFee is the base fee of its block (nil before London) and
+// receipt its receipt if it's known
+func transactionExtra(tx *gethtypes.Transaction, baseFee *big.Int, receipt *gethtypes.Receipt) *types.TransactionExtra {
+	extra := &types.TransactionExtra{
+		Data:     tx.Data(),
+		Gas:      tx.Gas(),
+		GasPrice: tx.GasPrice(),
+		Type:     tx.Type(),
+		Nonce:    tx.Nonce(),
+	}
+	isDynamicFee := tx.Type() >= gethtypes.DynamicFeeTxType
+	if isDynamicFee {
+		extra.MaxFeePerGas = tx.GasFeeCap()
+		extra.MaxPriorityFeePerGas = tx.GasTipCap()
+	}
+	switch {
+	case receipt != nil && receipt.EffectiveGasPrice != nil:
+		extra.EffectiveGasPrice = receipt.EffectiveGasPrice
+	case !isDynamicFee:
+		extra.EffectiveGasPrice = tx.GasPrice()
+	case baseFee != nil:
+		extra.EffectiveGasPrice = new(big.Int).Add(baseFee, tx.EffectiveGasTipValue(baseFee))
+	}
+	if receipt != nil {
+		extra.GasUsed = receipt.GasUsed
+	}
+	return extra
+}
+
 // TransactionByHash query geth node to get addtional data of tx
-func (cf *ChainFetch) TransactionByHash(txHash string) (*types.TransactionExtra, error) {
+func (cf *ChainFetch) TransactionByHash(txHash string, withReceipt bool) (*types.TransactionExtra, error) {
 	ctx := context.Background()
 	byteArr, err := hexutil.Decode(txHash)
 	hash := gethcommon.BytesToHash(byteArr)
@@ -189,11 +380,14 @@ func (cf *ChainFetch) TransactionByHash(txHash string) (*types.TransactionExtra,
 	if err != nil {
 		return nil, err
 	}
-	return &types.TransactionExtra{
-		Data:     tx.Data(),
-		Gas:      tx.Gas(),
-		GasPrice: tx.GasPrice(),
-	}, nil
+	var receipt *gethtypes.Receipt
+	if withReceipt {
+		receipt, err = cf.Client.TransactionReceipt(ctx, hash)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return transactionExtra(tx, nil, receipt), nil
 }
 
 // GetLatestBlock get latest known block by geth node
@@ -202,13 +396,21 @@ func (cf *ChainFetch) GetLatestBlock() (*big.Int, error) {
 	// nil means latest known header according to ethclient doc
 	header, err := cf.Client.HeaderByNumber(ctx, nil)
 	if err != nil {
-		switchIPC()
+		cf.switchIPC()
 		return big.NewInt(-1), err
 	}
 	blockNumber := header.Number
 	return blockNumber, nil
 }
 
-func switchIPC() {
-	go service.GetIpcManager().ForceChangeIPC()
+func (cf *ChainFetch) switchIPC() {
+	go cf.ipcs().ForceChangeIPC()
+}
+
+// ipcs the ipc manager of the chain of this fetcher
+func (cf *ChainFetch) ipcs() *service.IpcManager {
+	if cf.ipcManager == nil {
+		return service.GetIpcManager()
+	}
+	return cf.ipcManager
 }
@@ -6,11 +6,13 @@ import (
 	"testing"
 	"time"
 
+	"github.com/WeTrustPlatform/account-indexer/common/config"
 	"github.com/WeTrustPlatform/account-indexer/core/types"
 	ethereum "github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	gethCommon "github.com/ethereum/go-ethereum/common"
 	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -33,11 +35,16 @@ var transactions = []*gethtypes.Transaction{
 }
 
 func (mec MockEthClient) SubscribeNewHead(ctx context.Context, ch chan<- *gethtypes.Header) (ethereum.Subscription, error) {
-	go func() {
-		time.Sleep(time.Second * 2)
-		ch <- header
-	}()
-	return nil, nil
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		select {
+		case <-time.After(time.Second * 2):
+			ch <- header
+		case <-quit:
+			return nil
+		}
+		<-quit
+		return nil
+	}), nil
 }
 
 func (mec MockEthClient) BlockByNumber(ctx context.Context, number *big.Int) (*gethtypes.Block, error) {
@@ -61,6 +68,10 @@ func (mec MockEthClient) TransactionByHash(ctx context.Context, hash common.Hash
 	return &gethtypes.Transaction{}, false, nil
 }
 
+func (mec MockEthClient) ChainID(ctx context.Context) (*big.Int, error) {
+	return big.NewInt(1), nil
+}
+
 func (mec MockEthClient) Close() {
 
 }
@@ -70,7 +81,7 @@ func TestFetchData(t *testing.T) {
 		Client: MockEthClient{},
 	}
 	indexerChannel := make(chan *types.BLockDetail)
-	go fetcher.RealtimeFetch(indexerChannel)
+	go fetcher.RealtimeFetch(context.Background(), indexerChannel)
 	// time.Sleep(time.Second * 1)
 	blockDetail := <-indexerChannel
 	assert.Equal(t, header.Number.Uint64(), blockDetail.BlockNumber.Uint64())
@@ -78,3 +89,55 @@ func TestFetchData(t *testing.T) {
 	assert.Equal(t, from.String(), transaction.From)
 	assert.Equal(t, to.String(), transaction.To)
 }
+
+func TestFetchABlockExtras(t *testing.T) {
+	fetcher := ChainFetch{
+		Client: MockEthClient{},
+	}
+	blockDetail, err := fetcher.FetchABlock(header.Number)
+	assert.Nil(t, err)
+	assert.Nil(t, blockDetail.Transactions[0].Extra)
+
+	config.GetConfig().ExtraFields = []string{config.ExtraGas, config.ExtraGasPrice}
+	defer func() { config.GetConfig().ExtraFields = nil }()
+	blockDetail, err = fetcher.FetchABlock(header.Number)
+	assert.Nil(t, err)
+	assert.Equal(t, &types.TransactionExtra{Gas: 21000, GasPrice: big.NewInt(100)}, blockDetail.Transactions[0].Extra)
+}
+
+func TestTransactionExtra(t *testing.T) {
+	legacy := gethtypes.NewTransaction(uint64(7), to, amount, uint64(21000), big.NewInt(100), []byte{1})
+	extra := transactionExtra(legacy, big.NewInt(40), nil)
+	assert.Equal(t, &types.TransactionExtra{Data: []byte{1}, Gas: 21000, GasPrice: big.NewInt(100), Nonce: 7, EffectiveGasPrice: big.NewInt(100)}, extra)
+
+	dynamicFee := gethtypes.NewTx(&gethtypes.DynamicFeeTx{Nonce: 8, GasTipCap: big.NewInt(2), GasFeeCap: big.NewInt(50), Gas: 30000, To: &to, Value: amount})
+	extra = transactionExtra(dynamicFee, big.NewInt(40), nil)
+	assert.Equal(t, uint8(gethtypes.DynamicFeeTxType), extra.Type)
+	assert.Equal(t, uint64(8), extra.Nonce)
+	assert.Equal(t, big.NewInt(50), extra.MaxFeePerGas)
+	assert.Equal(t, big.NewInt(2), extra.MaxPriorityFeePerGas)
+	assert.Equal(t, big.NewInt(42), extra.EffectiveGasPrice)
+	// the priority fee is capped by the max fee
+	assert.Equal(t, big.NewInt(50), transactionExtra(dynamicFee, big.NewInt(49), nil).EffectiveGasPrice)
+	// unknown without base fee or receipt
+	assert.Nil(t, transactionExtra(dynamicFee, nil, nil).EffectiveGasPrice)
+	extra = transactionExtra(dynamicFee, nil, &gethtypes.Receipt{GasUsed: 21000, EffectiveGasPrice: big.NewInt(45)})
+	assert.Equal(t, big.NewInt(45), extra.EffectiveGasPrice)
+	assert.Equal(t, uint64(21000), extra.GasUsed)
+
+	config.GetConfig().ExtraFields = []string{config.ExtraType, config.ExtraEffectiveGasPrice}
+	defer func() { config.GetConfig().ExtraFields = nil }()
+	assert.Equal(t, &types.TransactionExtra{Type: gethtypes.DynamicFeeTxType, EffectiveGasPrice: big.NewInt(42)}, keptExtra(dynamicFee, big.NewInt(40), nil))
+}
+
+func TestRealtimeFetchCancel(t *testing.T) {
+	fetcher := ChainFetch{
+		Client: MockEthClient{},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	indexerChannel := make(chan *types.BLockDetail)
+	go fetcher.RealtimeFetch(ctx, indexerChannel)
+	cancel()
+	_, ok := <-indexerChannel
+	assert.False(t, ok, "channel should be closed after cancel")
+}
@@ -0,0 +1,329 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+
+	"github.com/WeTrustPlatform/account-indexer/common/config"
+	"github.com/WeTrustPlatform/account-indexer/core/types"
+	ethereum "github.com/ethereum/go-ethereum"
+	gethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	log "github.com/sirupsen/logrus"
+)
+
+// PipelineDepth number of fetched batches waiting to be decoded
+const PipelineDepth = 4
+
+// RPCClient the json-rpc client of geth, used to send batch requests
+type RPCClient interface {
+	BatchCallContext(ctx context.Context, b []rpc.BatchElem) error
+}
+
+// rpcBlock the fields of eth_getBlockByNumber that we need
+type rpcBlock struct {
+	Hash         gethcommon.Hash       `json:"hash"`
+	Number       *hexutil.Big          `json:"number"`
+	Time         hexutil.Uint64        `json:"timestamp"`
+	BaseFee      *hexutil.Big          `json:"baseFeePerGas"`
+	Miner        gethcommon.Address    `json:"miner"`
+	Difficulty   *hexutil.Big          `json:"difficulty"`
+	Uncles       []gethcommon.Hash     `json:"uncles"`
+	Withdrawals  gethtypes.Withdrawals `json:"withdrawals"`
+	Transactions []rpcTransaction      `json:"transactions"`
+}
+
+// rpcUncle the fields of eth_getUncleByBlockHashAndIndex that we need
+type rpcUncle struct {
+	Number *hexutil.Big       `json:"number"`
+	Miner  gethcommon.Address `json:"miner"`
+}
+
+// uncleRef an uncle of a block
+type uncleRef struct {
+	blockHash gethcommon.Hash
+	index     int
+}
+
+type rpcTransaction struct {
+	tx *gethtypes.Transaction
+	// from the sender returned by the node, nil if it's missing
+	from *gethcommon.Address
+}
+
+// UnmarshalJSON the transaction of eth_getBlockByNumber
+func (tx *rpcTransaction) UnmarshalJSON(msg []byte) error {
+	if err := json.Unmarshal(msg, &tx.tx); err != nil {
+		return err
+	}
+	var sender struct {
+		From *gethcommon.Address `json:"from"`
+	}
+	if err := json.Unmarshal(msg, &sender); err != nil {
+		return err
+	}
+	tx.from = sender.From
+	return nil
+}
+
+// rpcReceipt the fields of eth_getTransactionReceipt that we need
+type rpcReceipt struct {
+	ContractAddress   *gethcommon.Address `json:"contractAddress"`
+	GasUsed           hexutil.Uint64      `json:"gasUsed"`
+	EffectiveGasPrice *hexutil.Big        `json:"effectiveGasPrice"`
+}
+
+// fetchedBatch blocks fetched in a batch request, receipts of their contract creation transactions
+// (of all transactions if gas used is kept, see --extras) and headers of their uncles by block hash
+type fetchedBatch struct {
+	blocks   []*rpcBlock
+	receipts map[gethcommon.Hash]*rpcReceipt
+	uncles   map[gethcommon.Hash][]*gethtypes.Header
+}
+
+// uncleRefs uncles of the blocks, their miners get a reward
+func (fb *fetchedBatch) uncleRefs() []uncleRef {
+	result := []uncleRef{}
+	for _, block := range fb.blocks {
+		for i := range block.Uncles {
+			result = append(result, uncleRef{blockHash: block.Hash, index: i})
+		}
+	}
+	return result
+}
+
+// receiptTxs hashes of transactions that need a receipt to get the created contract or the gas used
+func (fb *fetchedBatch) receiptTxs() []gethcommon.Hash {
+	keepsGasUsed := config.GetConfig().KeepsExtra(config.ExtraGasUsed)
+	result := []gethcommon.Hash{}
+	for _, block := range fb.blocks {
+		for _, rpcTx := range block.Transactions {
+			if keepsGasUsed || isContractCreation(rpcTx.tx) {
+				result = append(result, rpcTx.tx.Hash())
+			}
+		}
+	}
+	return result
+}
+
+// FetchRange fetch blocks from "from" to "to" (inclusive) in order and send them to ch, ch is closed at the end.
+// Blocks are fetched with batch requests, the receipts and uncles of a batch are requested together with the blocks of
+// the next batch, so a batch of blocks costs a single round trip. Decoding and sender recovery run concurrently
+// with the next request. Blocks that are already fetched are still sent after ctx is cancelled, so they can be stored.
+func (cf *ChainFetch) FetchRange(ctx context.Context, from *big.Int, to *big.Int, ch chan<- *types.BLockDetail) error {
+	defer close(ch)
+	quit := make(chan struct{})
+	defer close(quit)
+	fetched := make(chan *fetchedBatch, PipelineDepth)
+	fetchErr := make(chan error, 1)
+	go func() {
+		fetchErr <- cf.fetchBatches(ctx, from, to, fetched, quit)
+	}()
+	for batch := range fetched {
+		summaries := []*blockSummary{}
+		for _, block := range batch.blocks {
+			txs := make([]*gethtypes.Transaction, len(block.Transactions))
+			for i, rpcTx := range block.Transactions {
+				txs[i] = rpcTx.tx
+			}
+			summaries = append(summaries, summarize(block.Number.ToInt().Int64(), block.Hash, txs))
+		}
+		if err := cf.verify(ctx, summaries); err != nil {
+			return err
+		}
+		for _, block := range batch.blocks {
+			blockDetail, err := cf.decodeBlock(block, batch.receipts, batch.uncles)
+			if err != nil {
+				return err
+			}
+			ch <- blockDetail
+		}
+	}
+	return <-fetchErr
+}
+
+func (cf *ChainFetch) fetchBatches(ctx context.Context, from *big.Int, to *big.Int, out chan<- *fetchedBatch, quit <-chan struct{}) error {
+	defer close(out)
+	batchSize := config.GetConfig().FetchBatchSize
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	next := from.Int64()
+	var prev *fetchedBatch
+	for {
+		blockNumbers := []int64{}
+		for n := next; n <= to.Int64() && len(blockNumbers) < batchSize; n++ {
+			blockNumbers = append(blockNumbers, n)
+		}
+		next += int64(len(blockNumbers))
+		if len(blockNumbers) == 0 && prev == nil {
+			return nil
+		}
+		txHashes := []gethcommon.Hash{}
+		uncles := []uncleRef{}
+		if prev != nil {
+			txHashes = prev.receiptTxs()
+			uncles = prev.uncleRefs()
+		}
+		blocks, receipts, uncleHeaders, err := cf.batchCall(ctx, blockNumbers, txHashes, uncles)
+		if err != nil {
+			return err
+		}
+		if prev != nil {
+			prev.receipts = receipts
+			prev.uncles = uncleHeaders
+			select {
+			case out <- prev:
+			case <-quit:
+				return nil
+			}
+		}
+		if len(blockNumbers) == 0 {
+			return nil
+		}
+		prev = &fetchedBatch{blocks: blocks}
+	}
+}
+
+// batchCall get blocks, receipts and uncles in a single batch request
+func (cf *ChainFetch) batchCall(ctx context.Context, blockNumbers []int64, txHashes []gethcommon.Hash, uncles []uncleRef) ([]*rpcBlock, map[gethcommon.Hash]*rpcReceipt, map[gethcommon.Hash][]*gethtypes.Header, error) {
+	blocks := make([]*rpcBlock, len(blockNumbers))
+	receipts := make([]*rpcReceipt, len(txHashes))
+	rpcUncles := make([]*rpcUncle, len(uncles))
+	elems := []rpc.BatchElem{}
+	for i, blockNumber := range blockNumbers {
+		elems = append(elems, rpc.BatchElem{
+			Method: "eth_getBlockByNumber",
+			Args:   []interface{}{hexutil.EncodeBig(big.NewInt(blockNumber)), true},
+			Result: &blocks[i],
+		})
+	}
+	for i, txHash := range txHashes {
+		elems = append(elems, rpc.BatchElem{
+			Method: "eth_getTransactionReceipt",
+			Args:   []interface{}{txHash},
+			Result: &receipts[i],
+		})
+	}
+	for i, uncle := range uncles {
+		elems = append(elems, rpc.BatchElem{
+			Method: "eth_getUncleByBlockHashAndIndex",
+			Args:   []interface{}{uncle.blockHash, hexutil.Uint(uncle.index)},
+			Result: &rpcUncles[i],
+		})
+	}
+	receiptMap := map[gethcommon.Hash]*rpcReceipt{}
+	uncleMap := map[gethcommon.Hash][]*gethtypes.Header{}
+	if len(elems) == 0 {
+		return blocks, receiptMap, uncleMap, nil
+	}
+	err := cf.RPC.BatchCallContext(ctx, elems)
+	if ctx.Err() != nil {
+		// stopped, not a problem of the ipc
+		return nil, nil, nil, ctx.Err()
+	}
+	if err != nil {
+		log.WithField("error", err.Error()).Error("ChainFetch: batchCall returns error")
+		cf.switchIPC()
+		return nil, nil, nil, err
+	}
+	for i, blockNumber := range blockNumbers {
+		if elems[i].Error != nil {
+			log.WithFields(log.Fields{
+				"blockNumber": blockNumber,
+				"error":       elems[i].Error.Error(),
+			}).Error("ChainFetch: batchCall cannot get block")
+			cf.switchIPC()
+			return nil, nil, nil, elems[i].Error
+		}
+		if blocks[i] == nil {
+			return nil, nil, nil, ethereum.NotFound
+		}
+	}
+	keepsGasUsed := config.GetConfig().KeepsExtra(config.ExtraGasUsed)
+	for i, txHash := range txHashes {
+		elem := elems[len(blockNumbers)+i]
+		if (elem.Error != nil || receipts[i] == nil) && keepsGasUsed {
+			log.WithField("txHash", txHash.String()).Error("ChainFetch: batchCall cannot get receipt for gas used of transaction")
+			cf.switchIPC()
+			return nil, nil, nil, ethereum.NotFound
+		}
+		if elem.Error != nil || receipts[i] == nil {
+			// https://github.com/WeTrustPlatform/account-indexer/issues/18
+			log.WithField("txHash", txHash.String()).Warn("ChainFetch: batchCall cannot get receipt for transaction")
+			continue
+		}
+		receiptMap[txHash] = receipts[i]
+	}
+	for i, uncle := range uncles {
+		elem := elems[len(blockNumbers)+len(txHashes)+i]
+		if elem.Error != nil || rpcUncles[i] == nil {
+			log.WithFields(log.Fields{
+				"blockHash": uncle.blockHash.String(),
+				"index":     uncle.index,
+			}).Error("ChainFetch: batchCall cannot get uncle")
+			cf.switchIPC()
+			return nil, nil, nil, ethereum.NotFound
+		}
+		uncleMap[uncle.blockHash] = append(uncleMap[uncle.blockHash], &gethtypes.Header{Number: rpcUncles[i].Number.ToInt(), Coinbase: rpcUncles[i].Miner})
+	}
+	return blocks, receiptMap, uncleMap, nil
+}
+
+// blockSenders senders of the transactions of a block, recovered locally with --sender local or the senders
+// returned by the node with the block otherwise, so no request is needed
+func (cf *ChainFetch) blockSenders(block *rpcBlock, txs []*gethtypes.Transaction) ([]gethcommon.Address, error) {
+	if config.GetConfig().SenderMode == SenderModeLocal {
+		return RecoverSenders(cf.getChainID(), txs)
+	}
+	senders := make([]gethcommon.Address, len(block.Transactions))
+	for i, rpcTx := range block.Transactions {
+		if rpcTx.from == nil {
+			return nil, errors.New("no sender for transaction " + rpcTx.tx.Hash().String())
+		}
+		senders[i] = *rpcTx.from
+	}
+	return senders, nil
+}
+
+// decodeBlock get senders of transactions (see blockSenders) and transform to BLockDetail
+func (cf *ChainFetch) decodeBlock(block *rpcBlock, receipts map[gethcommon.Hash]*rpcReceipt, uncles map[gethcommon.Hash][]*gethtypes.Header) (*types.BLockDetail, error) {
+	txs := make([]*gethtypes.Transaction, len(block.Transactions))
+	for i, rpcTx := range block.Transactions {
+		txs[i] = rpcTx.tx
+	}
+	senders, err := cf.blockSenders(block, txs)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"blockNumber": block.Number.ToInt().String(),
+			"error":       err.Error(),
+		}).Error("ChainFetch: decodeBlock cannot get sender")
+		return nil, err
+	}
+	transactions := []types.TransactionDetail{}
+	for i, tx := range txs {
+		sender := senders[i]
+		var contract *gethcommon.Address
+		var txRecp *gethtypes.Receipt
+		if receipt, ok := receipts[tx.Hash()]; ok {
+			if isContractCreation(tx) {
+				contract = receipt.ContractAddress
+			}
+			txRecp = &gethtypes.Receipt{GasUsed: uint64(receipt.GasUsed), EffectiveGasPrice: receipt.EffectiveGasPrice.ToInt()}
+		}
+		details := transactionDetails(tx, sender, contract)
+		transactions = append(transactions, withExtra(details, keptExtra(tx, block.BaseFee.ToInt(), txRecp))...)
+	}
+	header := &gethtypes.Header{Number: block.Number.ToInt(), Coinbase: block.Miner, Difficulty: block.Difficulty.ToInt()}
+	transactions = append(transactions, rewardDetails(chainConfig(cf.getChainID()), block.Hash.String(), header, uncles[block.Hash])...)
+	transactions = append(transactions, withdrawalDetails(block.Hash.String(), block.Withdrawals)...)
+	return &types.BLockDetail{
+		BlockNumber:  block.Number.ToInt(),
+		Time:         new(big.Int).SetUint64(uint64(block.Time)),
+		Transactions: transactions,
+	}, nil
+}
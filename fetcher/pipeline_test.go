@@ -0,0 +1,259 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/WeTrustPlatform/account-indexer/common/config"
+	"github.com/WeTrustPlatform/account-indexer/core/types"
+	gethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/assert"
+)
+
+var contractAddress = gethcommon.BytesToAddress([]byte("contract"))
+
+type MockRPCClient struct {
+	mutex    sync.Mutex
+	blocks   map[uint64][]*gethtypes.Transaction
+	numCalls int
+	// method name => number of requests
+	numRequests map[string]int
+	// proofOfWork blocks have a miner, a difficulty and an uncle
+	proofOfWork bool
+	// withdrawals blocks have a withdrawal
+	withdrawals bool
+	// from the sender returned for all transactions if it's set, the signer otherwise
+	from *gethcommon.Address
+}
+
+// rpcTxs transactions of eth_getBlockByNumber with their sender
+func (mrc *MockRPCClient) rpcTxs(txs []*gethtypes.Transaction) []map[string]interface{} {
+	result := []map[string]interface{}{}
+	for _, tx := range txs {
+		data, _ := json.Marshal(tx)
+		rpcTx := map[string]interface{}{}
+		_ = json.Unmarshal(data, &rpcTx)
+		from, _ := gethtypes.Sender(gethtypes.LatestSignerForChainID(tx.ChainId()), tx)
+		if mrc.from != nil {
+			from = *mrc.from
+		}
+		rpcTx["from"] = from
+		result = append(result, rpcTx)
+	}
+	return result
+}
+
+var miner = gethcommon.BytesToAddress([]byte("miner"))
+var uncleMiner = gethcommon.BytesToAddress([]byte("uncle miner"))
+var validator = gethcommon.BytesToAddress([]byte("validator"))
+
+func (mrc *MockRPCClient) BatchCallContext(ctx context.Context, b []rpc.BatchElem) error {
+	mrc.mutex.Lock()
+	defer mrc.mutex.Unlock()
+	mrc.numCalls++
+	for i := range b {
+		mrc.numRequests[b[i].Method]++
+		var result interface{}
+		switch b[i].Method {
+		case "eth_getBlockByNumber":
+			blockNumber, _ := hexutil.DecodeUint64(b[i].Args[0].(string))
+			txs, ok := mrc.blocks[blockNumber]
+			if ok {
+				block := map[string]interface{}{
+					"hash":         gethcommon.BigToHash(big.NewInt(int64(blockNumber))),
+					"number":       hexutil.Uint64(blockNumber),
+					"timestamp":    hexutil.Uint64(1546848896 + blockNumber),
+					"transactions": mrc.rpcTxs(txs),
+					"difficulty":   hexutil.Uint64(0),
+				}
+				if mrc.proofOfWork {
+					block["miner"] = miner
+					block["difficulty"] = hexutil.Uint64(1)
+					block["uncles"] = []gethcommon.Hash{gethcommon.BigToHash(big.NewInt(-1))}
+				}
+				if mrc.withdrawals {
+					block["withdrawals"] = gethtypes.Withdrawals{{Index: blockNumber, Address: validator, Amount: 32}}
+				}
+				result = block
+			}
+		case "eth_getUncleByBlockHashAndIndex":
+			blockNumber := b[i].Args[0].(gethcommon.Hash).Big().Uint64()
+			result = map[string]interface{}{"number": hexutil.Uint64(blockNumber - 1), "miner": uncleMiner}
+		case "eth_getTransactionReceipt":
+			result = map[string]interface{}{"contractAddress": contractAddress, "gasUsed": hexutil.Uint64(21000)}
+		}
+		data, _ := json.Marshal(result)
+		b[i].Error = json.Unmarshal(data, b[i].Result)
+	}
+	return nil
+}
+
+func newSignedTransactions(t *testing.T, n int) (gethcommon.Address, []*gethtypes.Transaction) {
+	key, err := crypto.GenerateKey()
+	assert.Nil(t, err)
+	signer := gethtypes.NewEIP155Signer(big.NewInt(1))
+	txs := []*gethtypes.Transaction{}
+	for i := 0; i < n; i++ {
+		var tx *gethtypes.Transaction
+		if i%2 == 0 {
+			tx = gethtypes.NewTransaction(uint64(i), to, amount, uint64(21000), big.NewInt(100), nil)
+		} else {
+			tx = gethtypes.NewContractCreation(uint64(i), big.NewInt(0), uint64(100000), big.NewInt(100), []byte{1})
+		}
+		signedTx, err := gethtypes.SignTx(tx, signer, key)
+		assert.Nil(t, err)
+		txs = append(txs, signedTx)
+	}
+	return crypto.PubkeyToAddress(key.PublicKey), txs
+}
+
+func TestFetchRange(t *testing.T) {
+	config.GetConfig().FetchBatchSize = 3
+	sender, txs := newSignedTransactions(t, 2)
+	mockRPC := &MockRPCClient{blocks: map[uint64][]*gethtypes.Transaction{}, numRequests: map[string]int{}}
+	for i := uint64(100); i < 110; i++ {
+		mockRPC.blocks[i] = txs
+	}
+	fetcher := ChainFetch{RPC: mockRPC}
+	ch := make(chan *types.BLockDetail)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- fetcher.FetchRange(context.Background(), big.NewInt(100), big.NewInt(109), ch)
+	}()
+	blockNumber := int64(100)
+	for blockDetail := range ch {
+		assert.Equal(t, blockNumber, blockDetail.BlockNumber.Int64())
+		assert.Equal(t, int64(1546848896)+blockNumber, blockDetail.Time.Int64())
+		// the contract creation is indexed as 2 records
+		assert.Equal(t, 3, len(blockDetail.Transactions))
+		assert.Equal(t, sender.String(), blockDetail.Transactions[0].From)
+		assert.Equal(t, to.String(), blockDetail.Transactions[0].To)
+		assert.Equal(t, sender.String(), blockDetail.Transactions[1].From)
+		assert.Equal(t, "", blockDetail.Transactions[1].To)
+		assert.Equal(t, "", blockDetail.Transactions[2].From)
+		assert.Equal(t, contractAddress.String(), blockDetail.Transactions[2].To)
+		blockNumber++
+	}
+	assert.Nil(t, <-errChan)
+	assert.Equal(t, int64(110), blockNumber)
+	// 4 batches of blocks, receipts of the last batch are requested separately
+	assert.Equal(t, 5, mockRPC.numCalls)
+	assert.Equal(t, 10, mockRPC.numRequests["eth_getBlockByNumber"])
+	assert.Equal(t, 10, mockRPC.numRequests["eth_getTransactionReceipt"])
+}
+
+func TestFetchRangeExtras(t *testing.T) {
+	config.GetConfig().FetchBatchSize = 2
+	config.GetConfig().ExtraFields = []string{config.ExtraNonce, config.ExtraGasUsed}
+	defer func() { config.GetConfig().ExtraFields = nil }()
+	_, txs := newSignedTransactions(t, 2)
+	mockRPC := &MockRPCClient{blocks: map[uint64][]*gethtypes.Transaction{1: txs, 2: txs}, numRequests: map[string]int{}}
+	fetcher := ChainFetch{RPC: mockRPC}
+	ch := make(chan *types.BLockDetail)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- fetcher.FetchRange(context.Background(), big.NewInt(1), big.NewInt(2), ch)
+	}()
+	for blockDetail := range ch {
+		assert.Equal(t, &types.TransactionExtra{GasUsed: 21000}, blockDetail.Transactions[0].Extra)
+		// both records of the contract creation have its extras
+		assert.Equal(t, &types.TransactionExtra{Nonce: 1, GasUsed: 21000}, blockDetail.Transactions[1].Extra)
+		assert.Equal(t, &types.TransactionExtra{Nonce: 1, GasUsed: 21000}, blockDetail.Transactions[2].Extra)
+		assert.Equal(t, contractAddress.String(), blockDetail.Transactions[2].To)
+	}
+	assert.Nil(t, <-errChan)
+	// receipts of all transactions are requested for the gas used
+	assert.Equal(t, 4, mockRPC.numRequests["eth_getTransactionReceipt"])
+}
+
+func TestFetchRangeRewards(t *testing.T) {
+	config.GetConfig().FetchBatchSize = 2
+	mockRPC := &MockRPCClient{blocks: map[uint64][]*gethtypes.Transaction{10: nil, 11: nil, 12: nil}, numRequests: map[string]int{}, proofOfWork: true}
+	fetcher := &ChainFetch{RPC: mockRPC}
+	fetcher.chainIDOnce.Do(func() { fetcher.chainID = big.NewInt(1) })
+	ch := make(chan *types.BLockDetail)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- fetcher.FetchRange(context.Background(), big.NewInt(10), big.NewInt(12), ch)
+	}()
+	count := 0
+	for blockDetail := range ch {
+		assert.Equal(t, 2, len(blockDetail.Transactions))
+		// 5 ether + 5/32 for the uncle
+		assert.Equal(t, types.TransactionDetail{To: miner.String(), TxHash: gethcommon.BigToHash(blockDetail.BlockNumber).String(),
+			Value: big.NewInt(5156250000000000000), RecordType: types.RecordBlockReward}, blockDetail.Transactions[0])
+		// 7/8 of 5 ether for an uncle of the previous block
+		assert.Equal(t, uncleMiner.String(), blockDetail.Transactions[1].To)
+		assert.Equal(t, big.NewInt(4375000000000000000), blockDetail.Transactions[1].Value)
+		assert.Equal(t, types.RecordUncleReward, blockDetail.Transactions[1].RecordType)
+		count++
+	}
+	assert.Nil(t, <-errChan)
+	assert.Equal(t, 3, count)
+	assert.Equal(t, 3, mockRPC.numRequests["eth_getUncleByBlockHashAndIndex"])
+
+	// withdrawals of proof of stake blocks
+	mockRPC = &MockRPCClient{blocks: map[uint64][]*gethtypes.Transaction{20: nil}, numRequests: map[string]int{}, withdrawals: true}
+	fetcher = &ChainFetch{RPC: mockRPC}
+	fetcher.chainIDOnce.Do(func() { fetcher.chainID = big.NewInt(1) })
+	ch = make(chan *types.BLockDetail)
+	go func() {
+		errChan <- fetcher.FetchRange(context.Background(), big.NewInt(20), big.NewInt(20), ch)
+	}()
+	blockDetail := <-ch
+	assert.Equal(t, []types.TransactionDetail{{To: validator.String(), TxHash: gethcommon.BigToHash(big.NewInt(20)).String(),
+		Value: big.NewInt(32000000000), RecordType: types.RecordWithdrawal}}, blockDetail.Transactions)
+	for range ch {
+	}
+	assert.Nil(t, <-errChan)
+}
+
+func TestFetchRangeNotFound(t *testing.T) {
+	config.GetConfig().FetchBatchSize = 2
+	mockRPC := &MockRPCClient{blocks: map[uint64][]*gethtypes.Transaction{1: nil, 2: nil}, numRequests: map[string]int{}}
+	fetcher := ChainFetch{RPC: mockRPC}
+	ch := make(chan *types.BLockDetail)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- fetcher.FetchRange(context.Background(), big.NewInt(1), big.NewInt(5), ch)
+	}()
+	count := 0
+	for range ch {
+		count++
+	}
+	assert.NotNil(t, <-errChan)
+	assert.Equal(t, 0, count)
+}
+
+func TestFetchRangeSenderMode(t *testing.T) {
+	defer func() { config.GetConfig().SenderMode = SenderModeRPC }()
+	config.GetConfig().FetchBatchSize = 3
+	sender, txs := newSignedTransactions(t, 1)
+	nodeSender := gethcommon.BytesToAddress([]byte("node sender"))
+	fetchSender := func(senderMode string, from *gethcommon.Address) (string, error) {
+		config.GetConfig().SenderMode = senderMode
+		mockRPC := &MockRPCClient{blocks: map[uint64][]*gethtypes.Transaction{100: txs}, numRequests: map[string]int{}, from: from}
+		fetcher := ChainFetch{RPC: mockRPC}
+		ch := make(chan *types.BLockDetail, 1)
+		err := fetcher.FetchRange(context.Background(), big.NewInt(100), big.NewInt(100), ch)
+		for blockDetail := range ch {
+			return blockDetail.Transactions[0].From, err
+		}
+		return "", err
+	}
+	// the sender returned by the node
+	from, err := fetchSender(SenderModeRPC, &nodeSender)
+	assert.Nil(t, err)
+	assert.Equal(t, nodeSender.String(), from)
+	// recovered from the signature
+	from, err = fetchSender(SenderModeLocal, &nodeSender)
+	assert.Nil(t, err)
+	assert.Equal(t, sender.String(), from)
+}
@@ -0,0 +1,92 @@
+package fetcher
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"time"
+
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// headPoller poll latest header of endpoints that do not support subscription (plain http json-rpc).
+// It implements ethereum.Subscription so RealtimeFetch handles it the same way as a newHead subscription.
+type headPoller struct {
+	client   EthClient
+	interval time.Duration
+	ch       chan<- *gethtypes.Header
+	quit     chan struct{}
+	// ctx cancelled by Unsubscribe, so a request to a hung endpoint does not block it
+	ctx     context.Context
+	cancel  context.CancelFunc
+	errChan chan error
+	once    sync.Once
+	wg      sync.WaitGroup
+}
+
+// newHeadPoller start polling, every new block number is sent to ch in order
+func newHeadPoller(client EthClient, interval time.Duration, ch chan<- *gethtypes.Header) *headPoller {
+	ctx, cancel := context.WithCancel(context.Background())
+	hp := &headPoller{
+		client:   client,
+		interval: interval,
+		ch:       ch,
+		quit:     make(chan struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
+		errChan:  make(chan error),
+	}
+	hp.wg.Add(1)
+	go hp.loop()
+	return hp
+}
+
+func (hp *headPoller) loop() {
+	defer hp.wg.Done()
+	ticker := time.NewTicker(hp.interval)
+	defer ticker.Stop()
+	var last *big.Int
+	for {
+		ctx, cancel := context.WithTimeout(hp.ctx, probeTimeout)
+		header, err := hp.client.HeaderByNumber(ctx, nil)
+		cancel()
+		if err != nil {
+			// retry on next tick, watcher takes care of a node that stays unavailable
+			log.WithField("error", err.Error()).Warn("ChainFetch: headPoller cannot get latest header")
+		} else {
+			from := header.Number
+			if last != nil {
+				from = new(big.Int).Add(last, big.NewInt(1))
+			}
+			for n := from; n.Cmp(header.Number) <= 0; n = new(big.Int).Add(n, big.NewInt(1)) {
+				select {
+				case hp.ch <- &gethtypes.Header{Number: n}:
+					last = n
+				case <-hp.quit:
+					return
+				}
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-hp.quit:
+			return
+		}
+	}
+}
+
+// Unsubscribe stop polling, no header is sent after it returns
+func (hp *headPoller) Unsubscribe() {
+	hp.once.Do(func() {
+		close(hp.quit)
+		hp.cancel()
+		hp.wg.Wait()
+		close(hp.errChan)
+	})
+}
+
+// Err the error channel of ethereum.Subscription, polling errors are retried so it's only closed on Unsubscribe
+func (hp *headPoller) Err() <-chan error {
+	return hp.errChan
+}
@@ -0,0 +1,76 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// PollEthClient the latest block increases by 2 on every call, every third call fails
+type PollEthClient struct {
+	MockEthClient
+	numCalls *int64
+}
+
+func (pec PollEthClient) HeaderByNumber(ctx context.Context, number *big.Int) (*gethtypes.Header, error) {
+	n := atomic.AddInt64(pec.numCalls, 1)
+	if n%3 == 0 {
+		return nil, errors.New("connection refused")
+	}
+	return &gethtypes.Header{Number: big.NewInt(100 + 2*n)}, nil
+}
+
+func TestHeadPoller(t *testing.T) {
+	ch := make(chan *gethtypes.Header)
+	poller := newHeadPoller(PollEthClient{numCalls: new(int64)}, time.Millisecond, ch)
+	// starts from the latest block, then no block is skipped
+	expected := int64(102)
+	for i := 0; i < 20; i++ {
+		header := <-ch
+		assert.Equal(t, expected, header.Number.Int64())
+		expected++
+	}
+	poller.Unsubscribe()
+	_, ok := <-poller.Err()
+	assert.False(t, ok)
+	// no header after Unsubscribe
+	select {
+	case header := <-ch:
+		t.Errorf("Should not receive header %v", header.Number)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+// HungEthClient never answers, until ctx is done
+type HungEthClient struct {
+	MockEthClient
+	started chan struct{}
+}
+
+func (hec HungEthClient) HeaderByNumber(ctx context.Context, number *big.Int) (*gethtypes.Header, error) {
+	close(hec.started)
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestHeadPollerUnsubscribeHung(t *testing.T) {
+	client := HungEthClient{started: make(chan struct{})}
+	poller := newHeadPoller(client, time.Hour, make(chan *gethtypes.Header))
+	<-client.started
+	done := make(chan struct{})
+	go func() {
+		poller.Unsubscribe()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Unsubscribe should cancel the request to a hung endpoint")
+	}
+}
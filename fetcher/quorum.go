@@ -0,0 +1,237 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/WeTrustPlatform/account-indexer/common/config"
+	"github.com/WeTrustPlatform/account-indexer/core/types"
+	gethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	log "github.com/sirupsen/logrus"
+)
+
+// QuorumRetries times to ask other endpoints again for blocks they don't have yet
+const QuorumRetries = 3
+
+// QuorumRetryDelay delay before asking other endpoints again
+var QuorumRetryDelay = time.Second
+
+// ErrNoQuorum not enough endpoints agree on a block
+var ErrNoQuorum = errors.New("endpoints do not agree on block")
+
+// blockSummary what endpoints have to agree on
+type blockSummary struct {
+	Number   int64
+	Hash     gethcommon.Hash
+	TxHashes []gethcommon.Hash
+}
+
+func summarize(number int64, hash gethcommon.Hash, txs []*gethtypes.Transaction) *blockSummary {
+	txHashes := make([]gethcommon.Hash, len(txs))
+	for i, tx := range txs {
+		txHashes[i] = tx.Hash()
+	}
+	return &blockSummary{Number: number, Hash: hash, TxHashes: txHashes}
+}
+
+func (bs *blockSummary) equal(other *blockSummary) bool {
+	if bs.Hash != other.Hash || len(bs.TxHashes) != len(other.TxHashes) {
+		return false
+	}
+	for i, txHash := range bs.TxHashes {
+		if txHash != other.TxHashes[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// rpcBlockHashes eth_getBlockByNumber without full transactions
+type rpcBlockHashes struct {
+	Hash         gethcommon.Hash   `json:"hash"`
+	Transactions []gethcommon.Hash `json:"transactions"`
+}
+
+// verify blocks fetched from the current endpoint against other endpoints, nil if quorum mode is disabled
+// or config.Quorum endpoints (including the current one) agree on every block. It stops with the error of ctx
+// when ctx is done, blocks are not reported as disagreements then
+func (cf *ChainFetch) verify(ctx context.Context, summaries []*blockSummary) error {
+	quorum := config.GetConfig().Quorum
+	if quorum < 2 || len(summaries) == 0 {
+		return nil
+	}
+	// latest vote of every endpoint on every block, in the order endpoints are asked
+	votes := make([][]types.Vote, len(summaries))
+	numAgree := make([]int, len(summaries))
+	for i, summary := range summaries {
+		votes[i] = []types.Vote{{Endpoint: cf.endpoint, Hash: summary.Hash.String(), NumTx: len(summary.TxHashes)}}
+		numAgree[i] = 1
+	}
+	pending := func() []int {
+		result := []int{}
+		for i := range summaries {
+			if numAgree[i] < quorum {
+				result = append(result, i)
+			}
+		}
+		return result
+	}
+	for attempt := 0; attempt <= QuorumRetries && len(pending()) > 0; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(QuorumRetryDelay):
+			}
+		}
+		for _, endpoint := range cf.peerEndpoints() {
+			indexes := []int{}
+			for _, i := range pending() {
+				if !hasVoted(votes[i], endpoint) {
+					indexes = append(indexes, i)
+				}
+			}
+			if len(indexes) == 0 {
+				continue
+			}
+			results, err := cf.peerBlocks(ctx, endpoint, summaries, indexes)
+			for j, i := range indexes {
+				vote := types.Vote{Endpoint: endpoint}
+				if err != nil {
+					vote.Error = err.Error()
+				} else if results[j] == nil {
+					// the endpoint is behind
+					vote.Error = "block not found"
+				} else {
+					vote.Hash = results[j].Hash.String()
+					vote.NumTx = len(results[j].TxHashes)
+					if results[j].equal(summaries[i]) {
+						numAgree[i]++
+					}
+				}
+				votes[i] = setVote(votes[i], vote)
+			}
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	noQuorum := pending()
+	for _, i := range noQuorum {
+		cf.ipcs().AddDisagreement(types.Disagreement{BlockNumber: summaries[i].Number, Time: time.Now(), Votes: votes[i]})
+		log.WithFields(log.Fields{
+			"blockNumber": summaries[i].Number,
+			"quorum":      quorum,
+			"agree":       numAgree[i],
+			"votes":       votes[i],
+		}).Error("ChainFetch: endpoints do not agree on block")
+	}
+	if len(noQuorum) > 0 {
+		return ErrNoQuorum
+	}
+	return nil
+}
+
+// hasVoted whether the endpoint returned the block, endpoints that returned an error are asked again
+func hasVoted(votes []types.Vote, endpoint string) bool {
+	for _, vote := range votes {
+		if vote.Endpoint == endpoint && vote.Error == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// setVote add the vote or replace the previous vote of the same endpoint
+func setVote(votes []types.Vote, vote types.Vote) []types.Vote {
+	for i := range votes {
+		if votes[i].Endpoint == vote.Endpoint {
+			votes[i] = vote
+			return votes
+		}
+	}
+	return append(votes, vote)
+}
+
+// peerEndpoints other configured endpoints, the healthiest first
+func (cf *ChainFetch) peerEndpoints() []string {
+	statuses := cf.ipcs().GetEndpointStatuses()
+	sort.SliceStable(statuses, func(i, j int) bool {
+		return statuses[i].Score > statuses[j].Score
+	})
+	result := []string{}
+	for _, status := range statuses {
+		if status.Endpoint != cf.endpoint {
+			result = append(result, status.Endpoint)
+		}
+	}
+	return result
+}
+
+// peerBlocks get summaries[indexes] from another endpoint in a batch request, nil for blocks the endpoint does not have
+func (cf *ChainFetch) peerBlocks(ctx context.Context, endpoint string, summaries []*blockSummary, indexes []int) ([]*blockSummary, error) {
+	client, err := cf.peerClient(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	blocks := make([]*rpcBlockHashes, len(indexes))
+	elems := make([]rpc.BatchElem, len(indexes))
+	for j, i := range indexes {
+		elems[j] = rpc.BatchElem{
+			Method: "eth_getBlockByNumber",
+			Args:   []interface{}{hexutil.EncodeBig(big.NewInt(summaries[i].Number)), false},
+			Result: &blocks[j],
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	if err := client.BatchCallContext(ctx, elems); err != nil {
+		return nil, err
+	}
+	results := make([]*blockSummary, len(indexes))
+	for j, i := range indexes {
+		if elems[j].Error != nil {
+			return nil, elems[j].Error
+		}
+		if blocks[j] != nil {
+			results[j] = &blockSummary{Number: summaries[i].Number, Hash: blocks[j].Hash, TxHashes: blocks[j].Transactions}
+		}
+	}
+	return results, nil
+}
+
+// peerClient connection to another endpoint, it's dialed once per fetcher
+func (cf *ChainFetch) peerClient(endpoint string) (RPCClient, error) {
+	cf.peersMutex.Lock()
+	defer cf.peersMutex.Unlock()
+	if client, ok := cf.peers[endpoint]; ok {
+		return client, nil
+	}
+	_, client, err := dial(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if cf.peers == nil {
+		cf.peers = map[string]RPCClient{}
+	}
+	cf.peers[endpoint] = client
+	return client, nil
+}
+
+// closePeers close connections to other endpoints
+func (cf *ChainFetch) closePeers() {
+	cf.peersMutex.Lock()
+	defer cf.peersMutex.Unlock()
+	for _, client := range cf.peers {
+		if closer, ok := client.(interface{ Close() }); ok {
+			closer.Close()
+		}
+	}
+	cf.peers = nil
+}
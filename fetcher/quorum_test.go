@@ -0,0 +1,133 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/WeTrustPlatform/account-indexer/common/config"
+	"github.com/WeTrustPlatform/account-indexer/core/types"
+	"github.com/WeTrustPlatform/account-indexer/service"
+	gethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/assert"
+)
+
+// PeerRPCClient answers eth_getBlockByNumber without full transactions
+type PeerRPCClient struct {
+	blocks map[uint64]*rpcBlockHashes
+}
+
+func (prc *PeerRPCClient) BatchCallContext(ctx context.Context, b []rpc.BatchElem) error {
+	for i := range b {
+		blockNumber, _ := hexutil.DecodeUint64(b[i].Args[0].(string))
+		data, _ := json.Marshal(prc.blocks[blockNumber])
+		b[i].Error = json.Unmarshal(data, b[i].Result)
+	}
+	return nil
+}
+
+func newQuorumFetch(t *testing.T, quorum int, peers map[string]RPCClient) *ChainFetch {
+	config.GetConfig().Quorum = quorum
+	QuorumRetryDelay = time.Millisecond
+	endpoints := []string{"ipc1"}
+	for endpoint := range peers {
+		endpoints = append(endpoints, endpoint)
+	}
+	ipcManager := service.NewIpcManager()
+	assert.Nil(t, ipcManager.SetIPC(endpoints))
+	return &ChainFetch{endpoint: "ipc1", peers: peers, ipcManager: ipcManager}
+}
+
+func TestVerify(t *testing.T) {
+	defer func() { config.GetConfig().Quorum = 0 }()
+	txHash := gethcommon.BytesToHash([]byte("tx"))
+	summary := &blockSummary{Number: 10, Hash: gethcommon.BytesToHash([]byte("block10")), TxHashes: []gethcommon.Hash{txHash}}
+	agree := &PeerRPCClient{blocks: map[uint64]*rpcBlockHashes{10: {Hash: summary.Hash, Transactions: summary.TxHashes}}}
+	differ := &PeerRPCClient{blocks: map[uint64]*rpcBlockHashes{10: {Hash: summary.Hash}}}
+	behind := &PeerRPCClient{blocks: map[uint64]*rpcBlockHashes{}}
+
+	fetcher := newQuorumFetch(t, 2, map[string]RPCClient{"ipc2": differ, "ipc3": agree})
+	assert.Nil(t, fetcher.verify(context.Background(), []*blockSummary{summary}))
+
+	assert.Equal(t, 0, len(fetcher.ipcs().GetDisagreements()))
+	fetcher = newQuorumFetch(t, 3, map[string]RPCClient{"ipc2": differ, "ipc3": agree})
+	assert.Equal(t, ErrNoQuorum, fetcher.verify(context.Background(), []*blockSummary{summary}))
+	disagreements := fetcher.ipcs().GetDisagreements()
+	assert.Equal(t, 1, len(disagreements))
+	assert.Equal(t, int64(10), disagreements[0].BlockNumber)
+	assert.Equal(t, 3, len(disagreements[0].Votes))
+	for _, vote := range disagreements[0].Votes {
+		assert.Equal(t, summary.Hash.String(), vote.Hash)
+		if vote.Endpoint == "ipc2" {
+			assert.Equal(t, 0, vote.NumTx)
+		} else {
+			assert.Equal(t, 1, vote.NumTx)
+		}
+	}
+
+	// the other endpoint does not have the block yet
+	fetcher = newQuorumFetch(t, 2, map[string]RPCClient{"ipc2": behind})
+	assert.Equal(t, ErrNoQuorum, fetcher.verify(context.Background(), []*blockSummary{summary}))
+	assert.Equal(t, "block not found", fetcher.ipcs().GetDisagreements()[0].Votes[1].Error)
+	// disagreements are kept per chain
+	assert.Equal(t, 0, len(service.GetIpcManager().GetDisagreements()))
+
+	// quorum mode is disabled
+	config.GetConfig().Quorum = 0
+	assert.Nil(t, fetcher.verify(context.Background(), []*blockSummary{summary}))
+}
+
+func TestFetchRangeQuorum(t *testing.T) {
+	defer func() { config.GetConfig().Quorum = 0 }()
+	config.GetConfig().FetchBatchSize = 3
+	_, txs := newSignedTransactions(t, 2)
+	mockRPC := &MockRPCClient{blocks: map[uint64][]*gethtypes.Transaction{}, numRequests: map[string]int{}}
+	peer := &PeerRPCClient{blocks: map[uint64]*rpcBlockHashes{}}
+	for i := uint64(100); i < 105; i++ {
+		mockRPC.blocks[i] = txs
+		peer.blocks[i] = &rpcBlockHashes{Hash: gethcommon.BigToHash(big.NewInt(int64(i))), Transactions: []gethcommon.Hash{txs[0].Hash(), txs[1].Hash()}}
+	}
+	// the other endpoint has a different block 104
+	peer.blocks[104].Transactions = nil
+	fetcher := newQuorumFetch(t, 2, map[string]RPCClient{"ipc2": peer})
+	fetcher.RPC = mockRPC
+	ch := make(chan *types.BLockDetail)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- fetcher.FetchRange(context.Background(), big.NewInt(100), big.NewInt(104), ch)
+	}()
+	blocks := []int64{}
+	for blockDetail := range ch {
+		blocks = append(blocks, blockDetail.BlockNumber.Int64())
+	}
+	assert.Equal(t, ErrNoQuorum, <-errChan)
+	// only the batch that endpoints agree on is stored
+	assert.Equal(t, []int64{100, 101, 102}, blocks)
+}
+
+// SlowRPCClient answers a batch request when ctx is done
+type SlowRPCClient struct{}
+
+func (src *SlowRPCClient) BatchCallContext(ctx context.Context, b []rpc.BatchElem) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestVerifyCancelled(t *testing.T) {
+	defer func() { config.GetConfig().Quorum = 0 }()
+	summary := &blockSummary{Number: 10, Hash: gethcommon.BytesToHash([]byte("block10"))}
+	fetcher := newQuorumFetch(t, 2, map[string]RPCClient{"ipc2": &SlowRPCClient{}})
+	QuorumRetryDelay = time.Hour
+	defer func() { QuorumRetryDelay = time.Millisecond }()
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	start := time.Now()
+	assert.Equal(t, context.Canceled, fetcher.verify(ctx, []*blockSummary{summary}))
+	assert.True(t, time.Since(start) < probeTimeout, "verify should stop when ctx is cancelled")
+	assert.Equal(t, 0, len(fetcher.ipcs().GetDisagreements()))
+}
@@ -0,0 +1,88 @@
+package fetcher
+
+import (
+	"math/big"
+
+	"github.com/WeTrustPlatform/account-indexer/core/types"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Static rewards of proof of work blocks in wei, see the ethash consensus engine of geth
+var (
+	frontierBlockReward       = big.NewInt(5e+18)
+	byzantiumBlockReward      = big.NewInt(3e+18)
+	constantinopleBlockReward = big.NewInt(2e+18)
+)
+
+// chainConfigs fork schedules of known chains by chain id, blocks rewards of other chains are not indexed
+var chainConfigs = map[uint64]*params.ChainConfig{
+	params.MainnetChainConfig.ChainID.Uint64(): params.MainnetChainConfig,
+	params.GoerliChainConfig.ChainID.Uint64():  params.GoerliChainConfig,
+	params.SepoliaChainConfig.ChainID.Uint64(): params.SepoliaChainConfig,
+	params.HoleskyChainConfig.ChainID.Uint64(): params.HoleskyChainConfig,
+}
+
+// chainConfig fork schedule of a chain, nil if it's unknown
+func chainConfig(chainID *big.Int) *params.ChainConfig {
+	if chainID == nil {
+		return nil
+	}
+	return chainConfigs[chainID.Uint64()]
+}
+
+// rewardDetails pseudo-transactions of the static rewards of the miner of a block and of the miners of its uncles,
+// only number, coinbase and difficulty of headers are used. Only proof of work blocks of an ethash chain have
+// rewards, fees are not included. The genesis block has no reward
+func rewardDetails(config *params.ChainConfig, blockHash string, header *gethtypes.Header, uncles []*gethtypes.Header) []types.TransactionDetail {
+	if config == nil || config.Ethash == nil || header.Difficulty == nil || header.Difficulty.Sign() == 0 || header.Number.Sign() == 0 {
+		return nil
+	}
+	blockReward := frontierBlockReward
+	if config.IsByzantium(header.Number) {
+		blockReward = byzantiumBlockReward
+	}
+	if config.IsConstantinople(header.Number) {
+		blockReward = constantinopleBlockReward
+	}
+	minerReward := new(big.Int).Set(blockReward)
+	result := []types.TransactionDetail{}
+	for _, uncle := range uncles {
+		// (uncle number + 8 - block number) * reward / 8 to the uncle miner, reward / 32 to the block miner
+		uncleReward := new(big.Int).Add(uncle.Number, big.NewInt(8))
+		uncleReward.Sub(uncleReward, header.Number)
+		uncleReward.Mul(uncleReward, blockReward)
+		uncleReward.Div(uncleReward, big.NewInt(8))
+		result = append(result, types.TransactionDetail{
+			To:         uncle.Coinbase.String(),
+			TxHash:     blockHash,
+			Value:      uncleReward,
+			RecordType: types.RecordUncleReward,
+		})
+		minerReward.Add(minerReward, new(big.Int).Div(blockReward, big.NewInt(32)))
+	}
+	return append([]types.TransactionDetail{{
+		To:         header.Coinbase.String(),
+		TxHash:     blockHash,
+		Value:      minerReward,
+		RecordType: types.RecordBlockReward,
+	}}, result...)
+}
+
+// gweiToWei withdrawal amounts are in gwei
+var gweiToWei = big.NewInt(1e9)
+
+// withdrawalDetails pseudo-transactions of the beacon chain withdrawals of a block
+func withdrawalDetails(blockHash string, withdrawals gethtypes.Withdrawals) []types.TransactionDetail {
+	result := []types.TransactionDetail{}
+	for _, withdrawal := range withdrawals {
+		amount := new(big.Int).SetUint64(withdrawal.Amount)
+		result = append(result, types.TransactionDetail{
+			To:         withdrawal.Address.String(),
+			TxHash:     blockHash,
+			Value:      amount.Mul(amount, gweiToWei),
+			RecordType: types.RecordWithdrawal,
+		})
+	}
+	return result
+}
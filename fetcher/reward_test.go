@@ -0,0 +1,54 @@
+package fetcher
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/WeTrustPlatform/account-indexer/core/types"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRewardDetails(t *testing.T) {
+	reward := func(blockNumber int64, difficulty int64, uncleNumbers ...int64) []types.TransactionDetail {
+		header := &gethtypes.Header{Number: big.NewInt(blockNumber), Coinbase: miner, Difficulty: big.NewInt(difficulty)}
+		uncles := []*gethtypes.Header{}
+		for _, number := range uncleNumbers {
+			uncles = append(uncles, &gethtypes.Header{Number: big.NewInt(number), Coinbase: uncleMiner})
+		}
+		return rewardDetails(chainConfig(big.NewInt(1)), "0xblock", header, uncles)
+	}
+	ether := func(n int64, d int64) *big.Int {
+		return new(big.Int).Div(new(big.Int).Mul(big.NewInt(n), big.NewInt(1e18)), big.NewInt(d))
+	}
+	// frontier
+	assert.Equal(t, []types.TransactionDetail{{To: miner.String(), TxHash: "0xblock", Value: ether(5, 1), RecordType: types.RecordBlockReward}}, reward(1000, 1))
+	// byzantium with 2 uncles, 1 and 2 blocks old
+	rewards := reward(4370000, 1, 4369999, 4369998)
+	assert.Equal(t, 3, len(rewards))
+	assert.Equal(t, ether(3*34, 32), rewards[0].Value)
+	assert.Equal(t, ether(3*7, 8), rewards[1].Value)
+	assert.Equal(t, ether(3*6, 8), rewards[2].Value)
+	assert.Equal(t, types.RecordUncleReward, rewards[2].RecordType)
+	// constantinople
+	assert.Equal(t, ether(2, 1), reward(7280000, 1)[0].Value)
+	// genesis
+	assert.Nil(t, reward(0, 17179869184))
+	// proof of stake
+	assert.Nil(t, reward(15537394, 0))
+	// unknown and proof of authority chains
+	assert.Nil(t, rewardDetails(chainConfig(big.NewInt(1337)), "0xblock", &gethtypes.Header{Number: big.NewInt(1), Difficulty: big.NewInt(1)}, nil))
+	assert.Nil(t, rewardDetails(chainConfig(nil), "0xblock", &gethtypes.Header{Number: big.NewInt(1), Difficulty: big.NewInt(1)}, nil))
+	assert.Nil(t, rewardDetails(params.GoerliChainConfig, "0xblock", &gethtypes.Header{Number: big.NewInt(1), Difficulty: big.NewInt(2)}, nil))
+}
+
+func TestWithdrawalDetails(t *testing.T) {
+	withdrawals := gethtypes.Withdrawals{{Index: 1, Address: validator, Amount: 1}, {Index: 2, Address: miner, Amount: 32000000000}}
+	details := withdrawalDetails("0xblock", withdrawals)
+	assert.Equal(t, []types.TransactionDetail{
+		{To: validator.String(), TxHash: "0xblock", Value: big.NewInt(1000000000), RecordType: types.RecordWithdrawal},
+		{To: miner.String(), TxHash: "0xblock", Value: new(big.Int).Mul(big.NewInt(32), big.NewInt(1e18)), RecordType: types.RecordWithdrawal},
+	}, details)
+	assert.Equal(t, []types.TransactionDetail{}, withdrawalDetails("0xblock", nil))
+}
@@ -0,0 +1,120 @@
+package fetcher
+
+import (
+	"context"
+	"math/big"
+	"runtime"
+	"sync"
+
+	"github.com/WeTrustPlatform/account-indexer/common/config"
+	gethcommon "github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// SenderModeRPC get sender of transactions from geth node
+	SenderModeRPC = "rpc"
+	// SenderModeLocal recover sender of transactions from their signatures
+	SenderModeLocal = "local"
+	// minParallelTxs blocks with fewer transactions are recovered in the calling goroutine
+	minParallelTxs = 16
+)
+
+// RecoverSenders recover senders of transactions from their signatures using all CPU cores.
+// chainID can be nil if it's not known, the chain id of each transaction is used instead.
+func RecoverSenders(chainID *big.Int, txs []*gethtypes.Transaction) ([]gethcommon.Address, error) {
+	senders := make([]gethcommon.Address, len(txs))
+	numWorker := runtime.NumCPU()
+	if len(txs) < minParallelTxs || numWorker <= 1 {
+		return senders, recoverSenders(chainID, txs, senders)
+	}
+	size := (len(txs) + numWorker - 1) / numWorker
+	errs := make([]error, numWorker)
+	wg := sync.WaitGroup{}
+	for i := 0; i < numWorker && i*size < len(txs); i++ {
+		from := i * size
+		to := from + size
+		if to > len(txs) {
+			to = len(txs)
+		}
+		wg.Add(1)
+		go func(i int, from int, to int) {
+			defer wg.Done()
+			errs[i] = recoverSenders(chainID, txs[from:to], senders[from:to])
+		}(i, from, to)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return senders, nil
+}
+
+func recoverSenders(chainID *big.Int, txs []*gethtypes.Transaction, senders []gethcommon.Address) error {
+	var latestSigner gethtypes.Signer
+	if chainID != nil {
+		latestSigner = gethtypes.LatestSignerForChainID(chainID)
+	}
+	for i, tx := range txs {
+		signer := latestSigner
+		if !tx.Protected() {
+			// legacy transaction before EIP-155, Frontier signer accepts high s-value before Homestead too
+			signer = gethtypes.FrontierSigner{}
+		} else if signer == nil {
+			signer = gethtypes.LatestSignerForChainID(tx.ChainId())
+		}
+		sender, err := gethtypes.Sender(signer, tx)
+		if err != nil {
+			return err
+		}
+		senders[i] = sender
+	}
+	return nil
+}
+
+// getSenders get senders of all transactions in a block, from geth node or recovered locally depending on config
+func (cf *ChainFetch) getSenders(ctx context.Context, block *gethtypes.Block) ([]gethcommon.Address, error) {
+	if config.GetConfig().SenderMode == SenderModeLocal {
+		senders, err := RecoverSenders(cf.getChainID(), block.Transactions())
+		if err != nil {
+			log.WithFields(log.Fields{
+				"blockNumber": block.Number().String(),
+				"error":       err.Error(),
+			}).Error("ChainFetch: getSenders cannot recover sender")
+		}
+		return senders, err
+	}
+	senders := make([]gethcommon.Address, len(block.Transactions()))
+	for index, tx := range block.Transactions() {
+		sender, err := cf.Client.TransactionSender(ctx, tx, block.Hash(), uint(index))
+		if err != nil && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			log.Error("ChainFetch: FetchABlock TransactionSender returns error " + err.Error())
+			cf.switchIPC()
+			return nil, err
+		}
+		senders[index] = sender
+	}
+	return senders, nil
+}
+
+// getChainID get chain id from geth node once, nil if the node does not support eth_chainId
+func (cf *ChainFetch) getChainID() *big.Int {
+	cf.chainIDOnce.Do(func() {
+		if cf.Client == nil {
+			return
+		}
+		chainID, err := cf.Client.ChainID(context.Background())
+		if err != nil {
+			log.WithField("error", err.Error()).Warn("ChainFetch: cannot get chain id, use chain id of transactions")
+			return
+		}
+		cf.chainID = chainID
+	})
+	return cf.chainID
+}
@@ -0,0 +1,132 @@
+package fetcher
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/WeTrustPlatform/account-indexer/common/config"
+	gethcommon "github.com/ethereum/go-ethereum/common"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+// rpcLatency simulated round trip of a TransactionSender call that misses the cache
+const rpcLatency = 100 * time.Microsecond
+
+// SenderEthClient returns a block of signed transactions, TransactionSender recovers the sender after a delay
+type SenderEthClient struct {
+	MockEthClient
+	block *gethtypes.Block
+}
+
+func (sec SenderEthClient) BlockByNumber(ctx context.Context, number *big.Int) (*gethtypes.Block, error) {
+	return sec.block, nil
+}
+
+func (sec SenderEthClient) TransactionSender(ctx context.Context, tx *gethtypes.Transaction, block gethcommon.Hash, index uint) (gethcommon.Address, error) {
+	time.Sleep(rpcLatency)
+	return gethtypes.Sender(gethtypes.LatestSignerForChainID(big.NewInt(1)), tx)
+}
+
+// newTypedTransactions n signed transactions of all types: pre-EIP155, EIP-155, EIP-2930 and EIP-1559
+func newTypedTransactions(t testing.TB, key *ecdsa.PrivateKey, n int) []*gethtypes.Transaction {
+	chainID := big.NewInt(1)
+	txs := []*gethtypes.Transaction{}
+	for i := 0; i < n; i++ {
+		nonce := uint64(i)
+		var tx *gethtypes.Transaction
+		var signer gethtypes.Signer
+		switch i % 4 {
+		case 0:
+			tx = gethtypes.NewTransaction(nonce, to, amount, uint64(21000), big.NewInt(100), nil)
+			signer = gethtypes.HomesteadSigner{}
+		case 1:
+			tx = gethtypes.NewTransaction(nonce, to, amount, uint64(21000), big.NewInt(100), nil)
+			signer = gethtypes.NewEIP155Signer(chainID)
+		case 2:
+			tx = gethtypes.NewTx(&gethtypes.AccessListTx{ChainID: chainID, Nonce: nonce, GasPrice: big.NewInt(100), Gas: 21000, To: &to, Value: amount})
+			signer = gethtypes.NewEIP2930Signer(chainID)
+		default:
+			tx = gethtypes.NewTx(&gethtypes.DynamicFeeTx{ChainID: chainID, Nonce: nonce, GasTipCap: big.NewInt(1), GasFeeCap: big.NewInt(100), Gas: 21000, To: &to, Value: amount})
+			signer = gethtypes.NewLondonSigner(chainID)
+		}
+		signedTx, err := gethtypes.SignTx(tx, signer, key)
+		assert.Nil(t, err)
+		txs = append(txs, signedTx)
+	}
+	return txs
+}
+
+func TestRecoverSenders(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	assert.Nil(t, err)
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	// enough transactions to recover in parallel
+	txs := newTypedTransactions(t, key, 4*minParallelTxs)
+	for _, chainID := range []*big.Int{big.NewInt(1), nil} {
+		senders, err := RecoverSenders(chainID, txs)
+		assert.Nil(t, err)
+		assert.Equal(t, len(txs), len(senders))
+		for _, recovered := range senders {
+			assert.Equal(t, sender, recovered)
+		}
+	}
+	// transactions of another chain
+	_, err = RecoverSenders(big.NewInt(3), txs)
+	assert.NotNil(t, err)
+}
+
+func TestFetchABlockLocalSender(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	assert.Nil(t, err)
+	txs := newTypedTransactions(t, key, 8)
+	block := gethtypes.NewBlockWithHeader(header).WithBody(txs, nil)
+	fetcher := ChainFetch{Client: SenderEthClient{block: block}}
+	config.GetConfig().SenderMode = SenderModeLocal
+	defer func() { config.GetConfig().SenderMode = SenderModeRPC }()
+	blockDetail, err := fetcher.FetchABlock(header.Number)
+	assert.Nil(t, err)
+	assert.Equal(t, 8, len(blockDetail.Transactions))
+	for _, tx := range blockDetail.Transactions {
+		assert.Equal(t, crypto.PubkeyToAddress(key.PublicKey).String(), tx.From)
+	}
+}
+
+func benchmarkSender(b *testing.B, senderMode string) {
+	key, err := crypto.GenerateKey()
+	assert.Nil(b, err)
+	block := gethtypes.NewBlockWithHeader(header).WithBody(newTypedTransactions(b, key, 200), nil)
+	fetcher := ChainFetch{Client: SenderEthClient{block: block}}
+	config.GetConfig().SenderMode = senderMode
+	defer func() { config.GetConfig().SenderMode = SenderModeRPC }()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// a new block every time, otherwise the sender is cached in transactions
+		block = gethtypes.NewBlockWithHeader(header).WithBody(newCopies(block.Transactions()), nil)
+		_, err := fetcher.getSenders(context.Background(), block)
+		assert.Nil(b, err)
+	}
+}
+
+// newCopies copy transactions without the cached sender
+func newCopies(txs []*gethtypes.Transaction) []*gethtypes.Transaction {
+	result := make([]*gethtypes.Transaction, len(txs))
+	for i, tx := range txs {
+		data, _ := tx.MarshalBinary()
+		result[i] = new(gethtypes.Transaction)
+		result[i].UnmarshalBinary(data)
+	}
+	return result
+}
+
+func BenchmarkSenderRPC(b *testing.B) {
+	benchmarkSender(b, SenderModeRPC)
+}
+
+func BenchmarkSenderLocal(b *testing.B) {
+	benchmarkSender(b, SenderModeLocal)
+}
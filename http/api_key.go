@@ -0,0 +1,214 @@
+package http
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/WeTrustPlatform/account-indexer/common/config"
+	"github.com/WeTrustPlatform/account-indexer/core/types"
+	httpTypes "github.com/WeTrustPlatform/account-indexer/http/types"
+	"github.com/WeTrustPlatform/account-indexer/repository"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// APIKeyHeader header of the api key of a public api request, it's not accepted in the query so keys stay out of access logs
+	APIKeyHeader = "X-API-Key"
+	// apiKeyContextKey key of the api key of a request in the gin context
+	apiKeyContextKey = "apiKey"
+)
+
+// apiKeys the keys of the public api, they are cached by hash and saved in the repository
+type apiKeys struct {
+	mutex  sync.RWMutex
+	repo   repository.APIKeyRepo
+	byHash map[string]types.APIKey
+}
+
+func newAPIKeys(repo repository.APIKeyRepo) *apiKeys {
+	keys := &apiKeys{repo: repo}
+	keys.load()
+	return keys
+}
+
+// load read all keys of the repository into the cache
+func (keys *apiKeys) load() {
+	byHash := map[string]types.APIKey{}
+	for _, key := range keys.repo.GetAPIKeys() {
+		byHash[key.Hash] = key
+	}
+	keys.mutex.Lock()
+	defer keys.mutex.Unlock()
+	keys.byHash = byHash
+}
+
+// lookup the enabled key of a plain api key
+func (keys *apiKeys) lookup(plain string) (types.APIKey, bool) {
+	hash := config.HashToken(plain)
+	keys.mutex.RLock()
+	defer keys.mutex.RUnlock()
+	key, ok := keys.byHash[hash]
+	return key, ok && !key.Disabled
+}
+
+// create save a new key, it returns the key and its plain value that is not stored
+func (keys *apiKeys) create(name string, rate float64, burst int) (types.APIKey, string, error) {
+	plain, hash, err := NewToken()
+	if err != nil {
+		return types.APIKey{}, "", err
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return types.APIKey{}, "", err
+	}
+	key := types.APIKey{
+		ID:        hex.EncodeToString(id),
+		Name:      name,
+		Hash:      hash,
+		RateLimit: rate,
+		RateBurst: burst,
+		CreatedAt: time.Now().Unix(),
+	}
+	if err := keys.repo.SaveAPIKey(key); err != nil {
+		return key, "", err
+	}
+	keys.load()
+	return key, plain, nil
+}
+
+// update save a changed key
+func (keys *apiKeys) update(key types.APIKey) error {
+	if err := keys.repo.SaveAPIKey(key); err != nil {
+		return err
+	}
+	keys.load()
+	return nil
+}
+
+// delete remove a key
+func (keys *apiKeys) delete(id string) error {
+	if err := keys.repo.DeleteAPIKey(id); err != nil {
+		return err
+	}
+	keys.load()
+	return nil
+}
+
+// middleware authenticate the api key of a request of a route group, the key is in the gin context for the rate limiter.
+// Requests with an unknown or disabled key get 401, requests without key get 401 if keys are required
+func (keys *apiKeys) middleware(required bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		plain := c.GetHeader(APIKeyHeader)
+		if plain == "" {
+			if required {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"msg": "api key is required, set header " + APIKeyHeader})
+				return
+			}
+			c.Next()
+			return
+		}
+		key, ok := keys.lookup(plain)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"msg": "invalid api key"})
+			return
+		}
+		c.Set(apiKeyContextKey, key)
+		c.Next()
+	}
+}
+
+func (server *Server) getAPIKeys(c *gin.Context) {
+	response := []httpTypes.EIAPIKey{}
+	for _, key := range server.apiKeys.repo.GetAPIKeys() {
+		response = append(response, httpTypes.APIKeyToEIAPIKey(key))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// createAPIKey create a key with query params name, rate and burst, the plain key is only in this response
+func (server *Server) createAPIKey(c *gin.Context) {
+	name := c.Query("name")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "name is required"})
+		return
+	}
+	key := types.APIKey{}
+	if !setAPIKeyLimits(c, &key) {
+		return
+	}
+	key, plain, err := server.apiKeys.create(name, key.RateLimit, key.RateBurst)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"msg": err.Error()})
+		return
+	}
+	log.WithField("key", key).Info("Server: created api key")
+	response := httpTypes.APIKeyToEIAPIKey(key)
+	response.Key = plain
+	c.JSON(http.StatusOK, response)
+}
+
+// updateAPIKey change rate, burst or disabled of a key with query params
+func (server *Server) updateAPIKey(c *gin.Context) {
+	key, err := server.apiKeys.repo.GetAPIKey(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"msg": err.Error()})
+		return
+	}
+	if !setAPIKeyLimits(c, &key) {
+		return
+	}
+	if disabledStr, ok := c.GetQuery("disabled"); ok {
+		disabled, err := strconv.ParseBool(disabledStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"msg": "invalid disabled " + disabledStr})
+			return
+		}
+		key.Disabled = disabled
+	}
+	if err := server.apiKeys.update(key); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"msg": err.Error()})
+		return
+	}
+	log.WithField("key", key).Info("Server: updated api key")
+	c.JSON(http.StatusOK, httpTypes.APIKeyToEIAPIKey(key))
+}
+
+func (server *Server) deleteAPIKey(c *gin.Context) {
+	key, err := server.apiKeys.repo.GetAPIKey(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"msg": err.Error()})
+		return
+	}
+	if err := server.apiKeys.delete(key.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"msg": err.Error()})
+		return
+	}
+	log.WithField("key", key).Info("Server: deleted api key")
+	c.JSON(http.StatusOK, httpTypes.APIKeyToEIAPIKey(key))
+}
+
+// setAPIKeyLimits set rate and burst of key from query params, false after a 400 response if they are invalid
+func setAPIKeyLimits(c *gin.Context, key *types.APIKey) bool {
+	if rateStr, ok := c.GetQuery("rate"); ok {
+		rate, err := strconv.ParseFloat(rateStr, 64)
+		if err != nil || rate < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"msg": "invalid rate " + rateStr})
+			return false
+		}
+		key.RateLimit = rate
+	}
+	if burstStr, ok := c.GetQuery("burst"); ok {
+		burst, err := strconv.Atoi(burstStr)
+		if err != nil || burst < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"msg": "invalid burst " + burstStr})
+			return false
+		}
+		key.RateBurst = burst
+	}
+	return true
+}
@@ -0,0 +1,86 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/WeTrustPlatform/account-indexer/repository/keyvalue"
+	"github.com/WeTrustPlatform/account-indexer/repository/keyvalue/dao"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/syndtr/goleveldb/leveldb/comparer"
+	"github.com/syndtr/goleveldb/leveldb/memdb"
+)
+
+func TestAPIKeys(t *testing.T) {
+	db := memdb.New(comparer.DefaultComparer, 0)
+	keys := newAPIKeys(keyvalue.NewKVAPIKeyRepo(dao.NewPrefixMemDbDAO(db, keyvalue.APIKeySpace)))
+	partner, plain, err := keys.create("partner", 1, 2)
+	assert.Nil(t, err)
+	_, otherPlain, err := keys.create("other", 0, 0)
+	assert.Nil(t, err)
+
+	now := time.Unix(1000, 0)
+	limiter := newRateLimiter(1, 1)
+	limiter.now = func() time.Time { return now }
+	gin.SetMode(gin.TestMode)
+	newRouter := func(required bool) *gin.Engine {
+		router := gin.New()
+		router.GET("/api/v1/accounts", keys.middleware(required), limiter.middleware(), func(c *gin.Context) {
+			c.String(http.StatusOK, "ok")
+		})
+		return router
+	}
+	do := func(router *gin.Engine, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/accounts", nil)
+		if key != "" {
+			req.Header.Set(APIKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	router := newRouter(false)
+	// a key has its own limit
+	w := do(router, plain)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, "1", w.Header().Get("X-RateLimit-Reset"))
+	assert.Equal(t, http.StatusOK, do(router, plain).Code)
+	w = do(router, plain)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	// requests with a key are limited by ip too so rotating keys doesn't get around the limit
+	assert.Equal(t, http.StatusTooManyRequests, do(router, otherPlain).Code)
+	assert.Equal(t, http.StatusTooManyRequests, do(router, "").Code)
+	// a key without limits has the limit of the config, requests without key are limited by ip
+	now = now.Add(time.Hour)
+	assert.Equal(t, http.StatusOK, do(router, otherPlain).Code)
+	assert.Equal(t, http.StatusTooManyRequests, do(router, otherPlain).Code)
+	now = now.Add(time.Hour)
+	assert.Equal(t, http.StatusOK, do(router, "").Code)
+	assert.Equal(t, http.StatusTooManyRequests, do(router, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, do(router, "unknown").Code)
+
+	// keys can be required
+	router = newRouter(true)
+	now = now.Add(time.Hour)
+	assert.Equal(t, http.StatusUnauthorized, do(router, "").Code)
+	assert.Equal(t, http.StatusOK, do(router, plain).Code)
+	// a key in the query would end up in access logs
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/accounts?apiKey="+otherPlain, nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// disabled and deleted keys are rejected
+	partner.Disabled = true
+	assert.Nil(t, keys.update(partner))
+	assert.Equal(t, http.StatusUnauthorized, do(router, plain).Code)
+	assert.Nil(t, keys.delete(partner.ID))
+	assert.Equal(t, 1, len(keys.repo.GetAPIKeys()))
+	assert.Equal(t, http.StatusUnauthorized, do(router, plain).Code)
+}
@@ -0,0 +1,108 @@
+package http
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/WeTrustPlatform/account-indexer/common/config"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// adminUserKey key of the authenticated admin user in the gin context
+const adminUserKey = "adminUser"
+
+// NewToken a random api token and its hash for tokenHash of the config file
+func NewToken() (string, string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", "", err
+	}
+	token := hex.EncodeToString(bytes)
+	return token, config.HashToken(token), nil
+}
+
+// HashPassword bcrypt hash of a password for passwordHash of the config file
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// authenticate the admin user of a bearer token or of basic auth credentials of req, nil if there is none
+func authenticate(users []config.AdminUser, req *http.Request) *config.AdminUser {
+	if auth := req.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		hash := []byte(config.HashToken(strings.TrimPrefix(auth, "Bearer ")))
+		for i := range users {
+			if users[i].TokenHash != "" && subtle.ConstantTimeCompare(hash, []byte(strings.ToLower(users[i].TokenHash))) == 1 {
+				return &users[i]
+			}
+		}
+		return nil
+	}
+	name, password, ok := req.BasicAuth()
+	if !ok {
+		return nil
+	}
+	for i := range users {
+		if users[i].Name != name {
+			continue
+		}
+		if users[i].Password != "" && subtle.ConstantTimeCompare([]byte(password), []byte(users[i].Password)) == 1 {
+			return &users[i]
+		}
+		if users[i].PasswordHash != "" && bcrypt.CompareHashAndPassword([]byte(users[i].PasswordHash), []byte(password)) == nil {
+			return &users[i]
+		}
+		return nil
+	}
+	return nil
+}
+
+// adminAuth authenticate requests of the admin api with the users of getUsers, read-only users can only do GET requests.
+// Every request is audited: changes and denied requests at info and warn level, reads at debug level
+func adminAuth(getUsers func() []config.AdminUser) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := authenticate(getUsers(), c.Request)
+		switch {
+		case user == nil:
+			c.Header("WWW-Authenticate", `Basic realm="Authorization Required"`)
+			c.AbortWithStatus(http.StatusUnauthorized)
+		case !user.CanWrite() && c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead:
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"msg": "role " + user.Role + " cannot " + c.Request.Method + " admin routes"})
+		default:
+			c.Set(adminUserKey, user)
+			c.Next()
+		}
+		audit(c, user)
+	}
+}
+
+// audit log an admin request with its user and response status
+func audit(c *gin.Context, user *config.AdminUser) {
+	fields := log.Fields{
+		"method": c.Request.Method,
+		"path":   c.Request.URL.Path,
+		"query":  c.Request.URL.RawQuery,
+		"status": c.Writer.Status(),
+		"client": c.ClientIP(),
+	}
+	if user != nil {
+		fields["user"] = user.Name
+		fields["role"] = user.Role
+	} else if name, _, ok := c.Request.BasicAuth(); ok {
+		fields["user"] = name
+	}
+	entry := log.WithFields(fields)
+	switch {
+	case c.Writer.Status() == http.StatusUnauthorized || c.Writer.Status() == http.StatusForbidden:
+		entry.Warn("Audit: Denied admin request")
+	case c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead:
+		entry.Info("Audit: Admin action")
+	default:
+		entry.Debug("Audit: Admin read")
+	}
+}
@@ -0,0 +1,73 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/WeTrustPlatform/account-indexer/common/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAdminAuth(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("alice-secret"), bcrypt.MinCost)
+	assert.Nil(t, err)
+	token, tokenHash, err := NewToken()
+	assert.Nil(t, err)
+	users := []config.AdminUser{
+		{Name: "admin", Password: "secret", Role: config.RoleOperator},
+		{Name: "alice", PasswordHash: string(hash), Role: config.RoleOperator},
+		{Name: "ci", TokenHash: tokenHash, Role: config.RoleReadOnly},
+	}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	admin := router.Group("/admin", adminAuth(func() []config.AdminUser { return users }))
+	admin.GET("/blocks/:blockNumber", func(c *gin.Context) {
+		c.String(http.StatusOK, c.MustGet(adminUserKey).(*config.AdminUser).Name)
+	})
+	admin.POST("/blocks/:blockNumber", func(c *gin.Context) {
+		c.String(http.StatusOK, "rerun")
+	})
+
+	do := func(method string, setAuth func(req *http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/admin/blocks/1", nil)
+		setAuth(req)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	basic := func(name, password string) func(req *http.Request) {
+		return func(req *http.Request) { req.SetBasicAuth(name, password) }
+	}
+	bearer := func(token string) func(req *http.Request) {
+		return func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+token) }
+	}
+
+	w := do(http.MethodGet, basic("admin", "secret"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "admin", w.Body.String())
+	w = do(http.MethodGet, basic("alice", "alice-secret"))
+	assert.Equal(t, "alice", w.Body.String())
+	w = do(http.MethodGet, bearer(token))
+	assert.Equal(t, "ci", w.Body.String())
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, basic("alice", "alice-secret")).Code)
+
+	// read-only users cannot change the indexer
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, bearer(token)).Code)
+
+	for _, setAuth := range []func(req *http.Request){
+		func(req *http.Request) {},
+		basic("admin", ""),
+		basic("", ""),
+		basic("alice", "secret"),
+		basic("ci", ""),
+		bearer(""),
+		bearer(tokenHash),
+	} {
+		w = do(http.MethodGet, setAuth)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+	}
+}
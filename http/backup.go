@@ -0,0 +1,90 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/WeTrustPlatform/account-indexer/core/types"
+	httpTypes "github.com/WeTrustPlatform/account-indexer/http/types"
+	"github.com/WeTrustPlatform/account-indexer/repository/keyvalue"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// backupJob online backup of the database, only one backup runs at a time
+type backupJob struct {
+	mutex  sync.Mutex
+	status httpTypes.EIBackup
+}
+
+// start backup db to a new file in dir until ctx is done, false if a backup is running. jobs is done when the backup finishes
+func (job *backupJob) start(ctx context.Context, jobs *sync.WaitGroup, db *keyvalue.DB, dir string) (string, bool) {
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+	if job.status.Running {
+		return job.status.File, false
+	}
+	startedAt := time.Now().UTC()
+	file := filepath.Join(dir, fmt.Sprintf("account-indexer-%v.tar.gz", startedAt.Format("20060102T150405.000Z")))
+	job.status = httpTypes.EIBackup{Running: true, File: file, StartedAt: startedAt}
+	jobs.Add(1)
+	go func() {
+		defer jobs.Done()
+		job.run(ctx, db, dir, file)
+	}()
+	return file, true
+}
+
+func (job *backupJob) run(ctx context.Context, db *keyvalue.DB, dir string, file string) {
+	log.WithField("file", file).Info("Backup: Started")
+	manifest, err := backupTo(ctx, db, dir, file)
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+	job.status.Running = false
+	job.status.FinishedAt = time.Now().UTC()
+	if err != nil {
+		job.status.Error = err.Error()
+		log.WithFields(log.Fields{
+			"file":  file,
+			"error": err.Error(),
+		}).Error("Backup: Failed")
+		return
+	}
+	job.status.Manifest = &manifest
+	log.WithFields(log.Fields{
+		"file":       file,
+		"lastBlocks": manifest.LastBlocks,
+		"numRecords": manifest.NumRecords,
+	}).Info("Backup: Finished")
+}
+
+func backupTo(ctx context.Context, db *keyvalue.DB, dir string, file string) (types.BackupManifest, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return types.BackupManifest{}, err
+	}
+	return db.BackupFile(ctx, file)
+}
+
+func (job *backupJob) getStatus() httpTypes.EIBackup {
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+	return job.status
+}
+
+func (server *Server) startBackup(c *gin.Context) {
+	file, ok := server.backup.start(server.ctx, server.jobs, server.db, server.backupDir)
+	if !ok {
+		c.JSON(http.StatusConflict, gin.H{"msg": "backup to " + file + " is running"})
+		return
+	}
+	c.JSON(http.StatusAccepted, server.backup.getStatus())
+}
+
+func (server *Server) getBackup(c *gin.Context) {
+	c.JSON(http.StatusOK, server.backup.getStatus())
+}
@@ -0,0 +1,243 @@
+package http
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/WeTrustPlatform/account-indexer/common"
+	"github.com/WeTrustPlatform/account-indexer/common/config"
+	"github.com/WeTrustPlatform/account-indexer/core/types"
+	gethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// CacheStats metrics of a cache returned by the admin api
+type CacheStats struct {
+	Size          int     `json:"size"`
+	Capacity      int     `json:"capacity"`
+	Hits          uint64  `json:"hits"`
+	Misses        uint64  `json:"misses"`
+	HitRate       float64 `json:"hitRate"`
+	Evictions     uint64  `json:"evictions"`
+	Invalidations uint64  `json:"invalidations"`
+}
+
+// cacheEntry a cached value, address is the address it's invalidated with, empty if it's never invalidated
+type cacheEntry struct {
+	key     string
+	address string
+	value   interface{}
+}
+
+// lruCache least recently used cache, entries of an address are removed when the address is invalidated.
+// A value loaded while its address is invalidated is not cached, it may be stale
+type lruCache struct {
+	mutex     sync.Mutex
+	capacity  int
+	entries   *list.List
+	byKey     map[string]*list.Element
+	byAddress map[string]map[*list.Element]bool
+	// seq incremented by every invalidation, invalidated the seq of the last invalidation of addresses
+	// invalidated while values are loading, loads that started before floor are not cached
+	seq         uint64
+	floor       uint64
+	loading     int
+	invalidated map[string]uint64
+	stats       CacheStats
+}
+
+func newLRUCache(capacity int) *lruCache {
+	return &lruCache{
+		capacity:    capacity,
+		entries:     list.New(),
+		byKey:       map[string]*list.Element{},
+		byAddress:   map[string]map[*list.Element]bool{},
+		invalidated: map[string]uint64{},
+		stats:       CacheStats{Capacity: capacity},
+	}
+}
+
+// getOrLoad the value of key, load is called on a miss and its value is cached if it returns true
+func (cache *lruCache) getOrLoad(key string, address string, load func() (interface{}, bool)) interface{} {
+	if cache.capacity <= 0 {
+		value, _ := load()
+		return value
+	}
+	cache.mutex.Lock()
+	if element, ok := cache.byKey[key]; ok {
+		cache.stats.Hits++
+		cache.entries.MoveToFront(element)
+		cache.mutex.Unlock()
+		return element.Value.(*cacheEntry).value
+	}
+	cache.stats.Misses++
+	start := cache.seq
+	cache.loading++
+	cache.mutex.Unlock()
+
+	value, ok := load()
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.loading--
+	if ok && start >= cache.floor && cache.invalidated[address] <= start {
+		cache.add(&cacheEntry{key: key, address: address, value: value})
+	}
+	if cache.loading == 0 && len(cache.invalidated) > 0 {
+		cache.invalidated = map[string]uint64{}
+	}
+	return value
+}
+
+func (cache *lruCache) add(entry *cacheEntry) {
+	if element, ok := cache.byKey[entry.key]; ok {
+		cache.remove(element)
+	}
+	element := cache.entries.PushFront(entry)
+	cache.byKey[entry.key] = element
+	if entry.address != "" {
+		if cache.byAddress[entry.address] == nil {
+			cache.byAddress[entry.address] = map[*list.Element]bool{}
+		}
+		cache.byAddress[entry.address][element] = true
+	}
+	for cache.entries.Len() > cache.capacity {
+		cache.remove(cache.entries.Back())
+		cache.stats.Evictions++
+	}
+}
+
+func (cache *lruCache) remove(element *list.Element) {
+	entry := cache.entries.Remove(element).(*cacheEntry)
+	delete(cache.byKey, entry.key)
+	if elements, ok := cache.byAddress[entry.address]; ok {
+		delete(elements, element)
+		if len(elements) == 0 {
+			delete(cache.byAddress, entry.address)
+		}
+	}
+}
+
+// invalidate remove entries of addresses
+func (cache *lruCache) invalidate(addresses []string) {
+	if cache.capacity <= 0 {
+		return
+	}
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.seq++
+	for _, address := range addresses {
+		if cache.loading > 0 {
+			cache.invalidated[address] = cache.seq
+		}
+		for element := range cache.byAddress[address] {
+			cache.remove(element)
+			cache.stats.Invalidations++
+		}
+	}
+	// don't track more addresses than entries, loads in flight are not cached instead
+	if len(cache.invalidated) > cache.capacity {
+		cache.floor = cache.seq
+		cache.invalidated = map[string]uint64{}
+	}
+}
+
+// getStats metrics of the cache
+func (cache *lruCache) getStats() CacheStats {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	stats := cache.stats
+	stats.Size = cache.entries.Len()
+	if lookups := stats.Hits + stats.Misses; lookups > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(lookups)
+	}
+	return stats
+}
+
+// accountResult a cached result of an account query
+type accountResult struct {
+	total   int
+	indexes []types.AddressIndex
+}
+
+// cacheAddress the address of the account param the cache invalidates entries with, empty if the query
+// is not for a single address and can't be cached
+func cacheAddress(account string) string {
+	address, err := hexutil.Decode(account)
+	if err != nil || len(address) != gethcommon.AddressLength {
+		return ""
+	}
+	return hexutil.Encode(address)
+}
+
+// findTransactions FindTransactions of the index repo of the chain, exact results are cached
+func (chain *chainAPI) findTransactions(ctx context.Context, account string, rows int, start int, fromTime time.Time, toTime time.Time) (int, bool, []types.AddressIndex) {
+	budget := config.GetConfig().QueryBudget
+	address := cacheAddress(account)
+	if address == "" {
+		return chain.indexRepo.FindTransactions(ctx, account, rows, start, fromTime, toTime, budget)
+	}
+	approximate := false
+	key := fmt.Sprintf("find/%v/%v/%v/%v/%v", address, rows, start, fromTime.Unix(), toTime.Unix())
+	result := chain.accountCache.getOrLoad(key, address, func() (interface{}, bool) {
+		var result accountResult
+		result.total, approximate, result.indexes = chain.indexRepo.FindTransactions(ctx, account, rows, start, fromTime, toTime, budget)
+		return result, !approximate
+	}).(accountResult)
+	return result.total, approximate, result.indexes
+}
+
+// countTransactions CountTransactions of the index repo of the chain, exact totals are cached
+func (chain *chainAPI) countTransactions(ctx context.Context, account string, fromTime time.Time, toTime time.Time) (int, bool) {
+	budget := config.GetConfig().QueryBudget
+	address := cacheAddress(account)
+	if address == "" {
+		return chain.indexRepo.CountTransactions(ctx, account, fromTime, toTime, budget)
+	}
+	approximate := false
+	key := fmt.Sprintf("count/%v/%v/%v", address, fromTime.Unix(), toTime.Unix())
+	total := chain.accountCache.getOrLoad(key, address, func() (interface{}, bool) {
+		var total int
+		total, approximate = chain.indexRepo.CountTransactions(ctx, account, fromTime, toTime, budget)
+		return total, !approximate
+	}).(int)
+	return total, approximate
+}
+
+// transactionExtra fields of a transaction, from the database if they are all kept (see --extras) and the
+// transaction is indexed with them, from the node otherwise
+func (chain *chainAPI) transactionExtra(txHash string, fields []string) (*types.TransactionExtra, error) {
+	keepsAll := true
+	for _, field := range fields {
+		keepsAll = keepsAll && config.GetConfig().KeepsExtra(field)
+	}
+	if keepsAll {
+		if extra := chain.indexRepo.GetTransactionExtra(txHash); extra != nil {
+			return extra, nil
+		}
+	}
+	withReceipt := common.Contains(fields, config.ExtraGasUsed) || common.Contains(fields, config.ExtraEffectiveGasPrice)
+	return chain.transactionByHash(txHash, withReceipt)
+}
+
+// transactionByHash TransactionByHash of the fetcher of the chain, transactions found are cached.
+// They are never invalidated: the fields of a transaction hash don't change, a reorged transaction
+// is no more returned by account queries once their results are invalidated. Only gas used and
+// effective gas price of the receipt may change if the transaction is mined again, they are cached
+// only as long as the transaction stays in the cache
+func (chain *chainAPI) transactionByHash(txHash string, withReceipt bool) (*types.TransactionExtra, error) {
+	var err error
+	key := txHash
+	if withReceipt {
+		key += "/receipt"
+	}
+	extra := chain.extraCache.getOrLoad(key, "", func() (interface{}, bool) {
+		var extra *types.TransactionExtra
+		extra, err = chain.fetcher.TransactionByHash(txHash, withReceipt)
+		return extra, err == nil
+	}).(*types.TransactionExtra)
+	return extra, err
+}
@@ -0,0 +1,59 @@
+package http
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRUCache(t *testing.T) {
+	cache := newLRUCache(2)
+	loads := 0
+	get := func(key string, address string) interface{} {
+		return cache.getOrLoad(key, address, func() (interface{}, bool) {
+			loads++
+			return key, true
+		})
+	}
+	assert.Equal(t, "a1", get("a1", "a"))
+	assert.Equal(t, "a1", get("a1", "a"))
+	assert.Equal(t, "b1", get("b1", "b"))
+	assert.Equal(t, 2, loads)
+	// a1 is the most recently used, b1 is evicted
+	get("a1", "a")
+	get("a2", "a")
+	get("b1", "b")
+	assert.Equal(t, 4, loads)
+
+	// entries of an invalidated address are loaded again, others are kept
+	cache.invalidate([]string{"b"})
+	get("a2", "a")
+	get("b1", "b")
+	assert.Equal(t, 5, loads)
+
+	stats := cache.getStats()
+	assert.Equal(t, CacheStats{Size: 2, Capacity: 2, Hits: 3, Misses: 5, HitRate: 3.0 / 8, Evictions: 2, Invalidations: 1}, stats)
+}
+
+func TestLRUCacheInvalidatedWhileLoading(t *testing.T) {
+	cache := newLRUCache(10)
+	// a value loaded while its address is written may be stale, it's not cached
+	cache.getOrLoad("a1", "a", func() (interface{}, bool) {
+		cache.invalidate([]string{"a"})
+		return "stale", true
+	})
+	assert.Equal(t, "fresh", cache.getOrLoad("a1", "a", func() (interface{}, bool) {
+		return "fresh", true
+	}))
+	// values of other addresses are cached
+	cache.getOrLoad("b1", "b", func() (interface{}, bool) {
+		cache.invalidate([]string{"c"})
+		return "b1", true
+	})
+	assert.Equal(t, 2, cache.getStats().Size)
+	// values that are not complete are not cached
+	cache.getOrLoad("c1", "c", func() (interface{}, bool) {
+		return "partial", false
+	})
+	assert.Equal(t, 2, cache.getStats().Size)
+}
@@ -0,0 +1,103 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/WeTrustPlatform/account-indexer/common/config"
+	"github.com/WeTrustPlatform/account-indexer/fetcher"
+	"github.com/WeTrustPlatform/account-indexer/indexer"
+	"github.com/WeTrustPlatform/account-indexer/repository"
+	"github.com/WeTrustPlatform/account-indexer/service"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// chainAPI the repositories, indexer and fetcher of a chain the api reads from
+type chainAPI struct {
+	id        string
+	indexRepo repository.IndexRepo
+	batchRepo repository.BatchRepo
+	indexer   *indexer.Indexer
+	fetcher   fetcher.Fetch
+	verifier  *indexer.Verifier
+	// accountCache results of account queries, entries of an address are invalidated when its records are written
+	accountCache *lruCache
+	// extraCache transaction extras by hash
+	extraCache *lruCache
+}
+
+func newChainAPI(idx *indexer.Indexer) *chainAPI {
+	chain := &chainAPI{
+		id:           idx.ChainID,
+		indexRepo:    idx.IndexRepo,
+		batchRepo:    idx.BatchRepo,
+		indexer:      idx,
+		verifier:     indexer.NewVerifier(idx),
+		accountCache: newLRUCache(config.GetConfig().CacheSize),
+		extraCache:   newLRUCache(config.GetConfig().CacheSize),
+	}
+	idx.IndexRepo.OnAddressesChanged(chain.accountCache.invalidate)
+	var sub service.IpcSubscriber = chain
+	idx.IpcManager.Subscribe(&sub)
+	// Don't care the error, if there is error then IPCUpdate will call
+	fetcher, err := fetcher.NewChainFetchOf(idx.IpcManager)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"chain": chain.id,
+			"error": err.Error(),
+		}).Error("Server: cannot create fetcher")
+	} else {
+		chain.fetcher = fetcher
+	}
+	return chain
+}
+
+// IpcUpdated implements IpcSubscriber interface
+func (chain *chainAPI) IpcUpdated(ipcPath string) {
+	// Don't care the error, if there is error then IPCUpdate will call
+	fetcher, err := fetcher.NewChainFetchOf(chain.indexer.IpcManager)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"chain": chain.id,
+			"error": err.Error(),
+		}).Error("Server - IPCUpdated: cannot create net fetcher")
+		return
+	}
+	log.WithField("chain", chain.id).Info("Server - IPCUpdated: update to new IPC successfully")
+	chain.fetcher = fetcher
+}
+
+// Name implements IpcSubscriber interface
+func (chain *chainAPI) Name() string {
+	return "Server " + chain.id
+}
+
+// onChain a gin handler calling handler with the chain of the "chainId" path param, the default chain
+// if the route has no such param
+func (server *Server) onChain(handler func(chain *chainAPI, c *gin.Context)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chainID := c.Param("chainId")
+		if chainID == "" {
+			chainID = server.defaultChain
+		}
+		chain, ok := server.chains[chainID]
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"msg": "unknown chain " + chainID})
+			return
+		}
+		handler(chain, c)
+	}
+}
+
+// CacheMetrics metrics of the caches of a chain
+type CacheMetrics struct {
+	Accounts     CacheStats `json:"accounts"`
+	Transactions CacheStats `json:"transactions"`
+}
+
+func (server *Server) getCache(chain *chainAPI, c *gin.Context) {
+	c.JSON(http.StatusOK, CacheMetrics{
+		Accounts:     chain.accountCache.getStats(),
+		Transactions: chain.extraCache.getStats(),
+	})
+}
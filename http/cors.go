@@ -0,0 +1,38 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/WeTrustPlatform/account-indexer/common"
+	"github.com/gin-gonic/gin"
+)
+
+// corsMiddleware allow browsers of origins to call the public api, "*" allows all origins.
+// It's a router middleware so preflight requests of routes without OPTIONS handler get an answer.
+func corsMiddleware(origins []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" || !strings.HasPrefix(c.Request.URL.Path, "/api/") {
+			c.Next()
+			return
+		}
+		if common.Contains(origins, "*") {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else if common.Contains(origins, origin) {
+			c.Header("Access-Control-Allow-Origin", origin)
+			c.Header("Vary", "Origin")
+		} else {
+			c.Next()
+			return
+		}
+		if c.Request.Method == http.MethodOptions {
+			c.Header("Access-Control-Allow-Methods", "GET, OPTIONS")
+			c.Header("Access-Control-Allow-Headers", c.GetHeader("Access-Control-Request-Headers"))
+			c.Header("Access-Control-Max-Age", "86400")
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,161 @@
+package http
+
+import (
+	"container/list"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/WeTrustPlatform/account-indexer/core/types"
+	"github.com/gin-gonic/gin"
+)
+
+// maxBuckets buckets of the least recently seen clients are dropped above this number of clients
+const maxBuckets = 10000
+
+// rateLimiter a token bucket per client of the public api, a client gets rate tokens per second up to burst.
+// Clients are api keys with their own limits and ips with the limits of the config
+type rateLimiter struct {
+	mutex sync.Mutex
+	rate  float64
+	burst int
+	// buckets by client, the most recently used first in lru
+	buckets map[string]*list.Element
+	lru     *list.List
+	now     func() time.Time
+}
+
+type tokenBucket struct {
+	client string
+	tokens float64
+	last   time.Time
+	rate   float64
+	burst  float64
+}
+
+// bucketLimit a client and its limits
+type bucketLimit struct {
+	client string
+	rate   float64
+	burst  int
+}
+
+// rateStatus the bucket of a client after a request
+type rateStatus struct {
+	allowed   bool
+	remaining int
+	// wait time to the next token if the request is not allowed
+	wait time.Duration
+	// reset time until the bucket is full
+	reset time.Duration
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{rate: rate, burst: burst, buckets: map[string]*list.Element{}, lru: list.New(), now: time.Now}
+}
+
+// allow take a token of client with the limits of the config, false and the time to wait for the next token if there is none
+func (rl *rateLimiter) allow(client string) (bool, time.Duration) {
+	status := rl.take(bucketLimit{client: client, rate: rl.rate, burst: rl.burst})
+	return status.allowed, status.wait
+}
+
+// take a token of every client of limits, a request is allowed only if they all have one and then they are all
+// charged. The status is the one of the most limited client
+func (rl *rateLimiter) take(limits ...bucketLimit) rateStatus {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	now := rl.now()
+	buckets := make([]*tokenBucket, len(limits))
+	allowed := true
+	for i, limit := range limits {
+		buckets[i] = rl.refill(limit, now)
+		allowed = allowed && buckets[i].tokens >= 1
+	}
+	status := rateStatus{allowed: allowed, remaining: math.MaxInt32}
+	for _, bucket := range buckets {
+		if allowed {
+			bucket.tokens--
+		} else if wait := time.Duration((1 - bucket.tokens) / bucket.rate * float64(time.Second)); wait > status.wait {
+			status.wait = wait
+		}
+		if remaining := int(bucket.tokens); remaining < status.remaining {
+			status.remaining = remaining
+		}
+		if reset := time.Duration((bucket.burst - bucket.tokens) / bucket.rate * float64(time.Second)); reset > status.reset {
+			status.reset = reset
+		}
+	}
+	return status
+}
+
+// refill the bucket of a client with the tokens since it was last used, the least recently used buckets are dropped
+// above maxBuckets clients, a dropped client gets a full bucket again. mutex should be held
+func (rl *rateLimiter) refill(limit bucketLimit, now time.Time) *tokenBucket {
+	element, ok := rl.buckets[limit.client]
+	if ok {
+		rl.lru.MoveToFront(element)
+	} else {
+		element = rl.lru.PushFront(&tokenBucket{client: limit.client, tokens: float64(limit.burst), last: now})
+		rl.buckets[limit.client] = element
+		for rl.lru.Len() > maxBuckets {
+			delete(rl.buckets, rl.lru.Remove(rl.lru.Back()).(*tokenBucket).client)
+		}
+	}
+	bucket := element.Value.(*tokenBucket)
+	// limits of a key can change
+	bucket.rate = limit.rate
+	bucket.burst = float64(limit.burst)
+	bucket.tokens = math.Min(bucket.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*limit.rate)
+	bucket.last = now
+	return bucket
+}
+
+// middleware limit requests of the client ip and of the api key set by apiKeys.middleware, a request needs a token
+// of both so rotating keys doesn't get around the limit of an ip. The ip of a key gets the limits of the key if
+// they are higher than the ones of the config.
+// Responses have quota headers X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset (seconds until the quota is full),
+// clients without tokens get 429 with header Retry-After
+func (rl *rateLimiter) middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ipLimit := bucketLimit{client: "ip:" + c.ClientIP(), rate: rl.rate, burst: rl.burst}
+		limits := []bucketLimit{ipLimit}
+		if value, ok := c.Get(apiKeyContextKey); ok {
+			key := value.(types.APIKey)
+			keyLimit := bucketLimit{client: "key:" + key.ID, rate: rl.rate, burst: rl.burst}
+			if key.RateLimit > 0 {
+				keyLimit.rate = key.RateLimit
+			}
+			if key.RateBurst > 0 {
+				keyLimit.burst = key.RateBurst
+			}
+			ipLimit.rate = math.Max(ipLimit.rate, keyLimit.rate)
+			if keyLimit.burst > ipLimit.burst {
+				ipLimit.burst = keyLimit.burst
+			}
+			limits = []bucketLimit{keyLimit, ipLimit}
+		}
+		// the first client has the lowest limits
+		if limits[0].rate <= 0 {
+			c.Next()
+			return
+		}
+		for i := range limits {
+			if limits[i].burst < 1 {
+				limits[i].burst = 1
+			}
+		}
+		status := rl.take(limits...)
+		c.Header("X-RateLimit-Limit", strconv.Itoa(limits[0].burst))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(status.remaining))
+		c.Header("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(status.reset.Seconds()))))
+		if !status.allowed {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(status.wait.Seconds()))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"msg": "rate limit exceeded"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,63 @@
+package http
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Unix(1000, 0)
+	rl := newRateLimiter(2, 3)
+	rl.now = func() time.Time { return now }
+	for i := 0; i < 3; i++ {
+		ok, _ := rl.allow("a")
+		assert.True(t, ok)
+	}
+	ok, wait := rl.allow("a")
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, wait)
+	// other clients have their own bucket
+	ok, _ = rl.allow("b")
+	assert.True(t, ok)
+
+	now = now.Add(500 * time.Millisecond)
+	ok, _ = rl.allow("a")
+	assert.True(t, ok)
+	ok, _ = rl.allow("a")
+	assert.False(t, ok)
+	// tokens do not go above burst
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		ok, _ = rl.allow("a")
+		assert.True(t, ok)
+	}
+	ok, _ = rl.allow("a")
+	assert.False(t, ok)
+
+	// a request takes a token of every client or of none
+	status := rl.take(bucketLimit{client: "c", rate: 2, burst: 1}, bucketLimit{client: "a", rate: 2, burst: 3})
+	assert.False(t, status.allowed)
+	assert.Equal(t, 500*time.Millisecond, status.wait)
+	ok, _ = rl.allow("c")
+	assert.True(t, ok)
+}
+
+func TestRateLimiterEviction(t *testing.T) {
+	rl := newRateLimiter(1, 1)
+	for i := 0; i < maxBuckets; i++ {
+		rl.allow(strconv.Itoa(i))
+	}
+	// the first client is used again so the second one is the least recently used
+	ok, _ := rl.allow("0")
+	assert.False(t, ok)
+	rl.allow("new")
+	assert.Equal(t, maxBuckets, len(rl.buckets))
+	assert.Equal(t, maxBuckets, rl.lru.Len())
+	_, ok = rl.buckets["1"]
+	assert.False(t, ok)
+	ok, _ = rl.allow("0")
+	assert.False(t, ok)
+}
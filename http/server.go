@@ -1,24 +1,24 @@
 package http
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math/big"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/WeTrustPlatform/account-indexer/common"
 	"github.com/WeTrustPlatform/account-indexer/common/config"
-	"github.com/WeTrustPlatform/account-indexer/fetcher"
+	"github.com/WeTrustPlatform/account-indexer/core/types"
 	log "github.com/sirupsen/logrus"
 
 	httpTypes "github.com/WeTrustPlatform/account-indexer/http/types"
 	"github.com/WeTrustPlatform/account-indexer/indexer"
-	"github.com/WeTrustPlatform/account-indexer/repository"
-	"github.com/WeTrustPlatform/account-indexer/service"
+	"github.com/WeTrustPlatform/account-indexer/repository/keyvalue"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/gin-gonic/gin"
 )
@@ -26,117 +26,143 @@ import (
 const (
 	// DefaultRows Default row for paging
 	DefaultRows = 10
-	// AdminUserName Username for http admin api
+	// ShutdownTimeout time for in-flight requests to finish on shutdown
+	ShutdownTimeout = 10 * time.Second
+	// AdminUserName env var of the username for http admin api, it overrides the config file
 	AdminUserName = "INDEXER_USER_NAME"
-	// AdminPassword Password for http admin api
+	// AdminPassword env var of the password for http admin api, it overrides the config file
 	AdminPassword = "INDEXER_PASSWORD"
 )
 
 // Server http server
 type Server struct {
-	indexRepo repository.IndexRepo
-	batchRepo repository.BatchRepo
-	indexer   indexer.Indexer
-	fetcher   fetcher.Fetch
+	// chains the chains by id, routes without chain id are on the default chain
+	chains       map[string]*chainAPI
+	chainIDs     []string
+	defaultChain string
+	db           *keyvalue.DB
+	backupDir    string
+	backup       *backupJob
+	apiKeys      *apiKeys
+	// ctx the lifetime of the server, admin jobs are stopped when it's cancelled
+	ctx context.Context
+	// jobs admin jobs running in the background, Start waits for them before it returns
+	jobs *sync.WaitGroup
 }
 
-// NewServer Rest API
-func NewServer(idx indexer.Indexer) Server {
-
-	indexRepo := idx.IndexRepo
-	batchRepo := idx.BatchRepo
-
-	server := Server{indexRepo: indexRepo, batchRepo: batchRepo, indexer: idx}
-	var sub service.IpcSubscriber = &server
-	service.GetIpcManager().Subscribe(&sub)
-	// Don't care the error, if there is error then IPCUpdate will call
-	fetcher, err := fetcher.NewChainFetch()
-	if err != nil {
-		log.WithField("error", err.Error).Error("Server: cannot create fetcher")
-	} else {
-		server.fetcher = fetcher
+// NewServer Rest API of the chains of indexers, the first one is the default chain.
+// db is the database of the indexers for online backups and api keys
+func NewServer(indexers []*indexer.Indexer, db *keyvalue.DB) Server {
+	server := Server{chains: map[string]*chainAPI{}, db: db, backup: &backupJob{}, apiKeys: newAPIKeys(db.APIKeyRepo()), jobs: &sync.WaitGroup{}}
+	for _, idx := range indexers {
+		server.chains[idx.ChainID] = newChainAPI(idx)
+		server.chainIDs = append(server.chainIDs, idx.ChainID)
 	}
-	return server
-}
-
-// IpcUpdated implements IpcSubscriber interface
-func (server *Server) IpcUpdated(ipcPath string) {
-	// Don't care the error, if there is error then IPCUpdate will call
-	fetcher, err := fetcher.NewChainFetch()
-	if err != nil {
-		log.WithField("error", err.Error).Error("Server - IPCUpdated: cannot create net fetcher")
-		return
+	server.defaultChain = server.chainIDs[0]
+	server.backupDir = config.GetConfig().BackupDir
+	if server.backupDir == "" {
+		server.backupDir = config.GetConfig().DbPath + "_backups"
 	}
-	log.Info("Server - IPCUpdated: update to new IPC successfully")
-	server.fetcher = fetcher
-}
-
-// Name implements IpcSubscriber interface
-func (server *Server) Name() string {
-	return "Server"
+	return server
 }
 
-// Start start http server
-func (server *Server) Start() {
+// Start start http server, it returns after ctx is cancelled and in-flight requests and admin jobs are done
+func (server *Server) Start(ctx context.Context) {
+	server.ctx = ctx
 	router := gin.Default()
+	if origins := config.GetConfig().CORSOrigins; len(origins) > 0 {
+		router.Use(corsMiddleware(origins))
+	}
 	api := router.Group("/api")
-	{
-		api.GET("v1/accounts/:accountNumber", server.getTransactionsByAccount)
-		api.GET("v1/accounts/:accountNumber/total", server.getTotalByAccount)
+	limiter := newRateLimiter(config.GetConfig().RateLimit, config.GetConfig().RateBurst)
+	accounts := api.Group("", server.apiKeys.middleware(config.GetConfig().APIKeyMode == config.APIKeyRequired), limiter.middleware())
+	for _, prefix := range []string{"v1", "v1/chains/:chainId"} {
+		accounts.GET(prefix+"/accounts/:accountNumber", server.onChain(server.getTransactionsByAccount))
+		accounts.GET(prefix+"/accounts/:accountNumber/total", server.onChain(server.getTotalByAccount))
 	}
 
-	admin := router.Group("/admin", gin.BasicAuth(gin.Accounts{
-		os.Getenv(AdminUserName): os.Getenv(AdminPassword),
-	}))
+	admin := router.Group("/admin", adminAuth(config.GetConfig().GetAdminUsers))
+	for _, prefix := range []string{"", "/chains/:chainId"} {
+		chainAdmin := admin.Group(prefix)
+		chainAdmin.GET("/batches/status", server.onChain(server.getBatchStatus))
+		chainAdmin.GET("/batches/progress", server.onChain(server.getBatchProgress))
+		chainAdmin.GET("/batches/workers", server.onChain(server.getWorkers))
+		chainAdmin.POST("/batches/workers/:numWorker", server.onChain(server.setWorkers))
+		// chainAdmin.POST("/batch/restart", server.restartBatch)
+		chainAdmin.GET("/blocks/:blockNumber", server.onChain(server.getBlock))
+		chainAdmin.POST("/blocks/:blockNumber", server.onChain(server.rerunBlock))
+		chainAdmin.GET("/blocks", server.onChain(server.getBlock))
+		chainAdmin.GET("/endpoints", server.onChain(server.getEndpoints))
+		chainAdmin.GET("/quorum", server.onChain(server.getQuorum))
+		chainAdmin.GET("/gaps", server.onChain(server.getGaps))
+		chainAdmin.GET("/verify", server.onChain(server.getVerify))
+		chainAdmin.POST("/verify", server.onChain(server.startVerify))
+		chainAdmin.GET("/cache", server.onChain(server.getCache))
+	}
 	{
-		admin.GET("/batches/status", server.getBatchStatus)
-		// admin.POST("/batch/restart", server.restartBatch)
-		admin.GET("/blocks/:blockNumber", server.getBlock)
-		admin.POST("/blocks/:blockNumber", server.rerunBlock)
-		admin.GET("/blocks", server.getBlock)
+		admin.GET("/chains", server.getChains)
 		admin.GET("/config", server.getConfig)
 		admin.GET("/version", server.getVersion)
+		admin.GET("/backup", server.getBackup)
+		admin.POST("/backup", server.startBackup)
+		admin.GET("/apikeys", server.getAPIKeys)
+		admin.POST("/apikeys", server.createAPIKey)
+		admin.POST("/apikeys/:id", server.updateAPIKey)
+		admin.DELETE("/apikeys/:id", server.deleteAPIKey)
 	}
 	// Listen for port 3000 on localhost(127.0.0.1)
 	// Admin needs to setup a reversed proxy and forward to http://127.0.0.1:3000
-	err := router.Run(fmt.Sprintf("127.0.0.1:%v", config.GetConfig().Port))
-	if err == nil {
-		log.WithField("port", config.GetConfig().Port).Info("Server: Started server successfully")
-	} else {
+	httpServer := &http.Server{
+		Addr:    fmt.Sprintf("127.0.0.1:%v", config.GetConfig().Port),
+		Handler: router,
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- httpServer.ListenAndServe()
+	}()
+	log.WithField("port", config.GetConfig().Port).Info("Server: Started server successfully")
+	select {
+	case err := <-serveErr:
 		panic(errors.New("Server: Cannot start http server. Error: " + err.Error()))
+	case <-ctx.Done():
 	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		log.WithField("error", err.Error()).Error("Server: Cannot shutdown http server gracefully")
+	}
+	log.Info("Server: Waiting for admin jobs")
+	server.jobs.Wait()
+	log.Info("Server: Stopped")
 }
 
-func (server *Server) getTransactionsByAccount(c *gin.Context) {
+func (server *Server) getTransactionsByAccount(chain *chainAPI, c *gin.Context) {
 	account, fromTime, toTime, err := getAccountParam(c)
 	if err != nil {
 		return
 	}
 	flParam := c.Query("fl")
 	addlFields := strings.Split(flParam, ",")
-	needTxData := common.Contains(addlFields, "data")
-	needGas := common.Contains(addlFields, "gas")
-	needGasPrice := common.Contains(addlFields, "gasPrice")
+	extraFields := []string{}
+	for _, field := range config.ExtraFieldNames {
+		if common.Contains(addlFields, field) {
+			extraFields = append(extraFields, field)
+		}
+	}
 
 	rows, start := getPagingQueryParams(c)
 	log.WithField("account", account).Info("Server: Getting transactions for account")
-	total, addressIndexes := server.indexRepo.GetTransactionByAddress(account, rows, start, fromTime, toTime)
+	ctx, cancel := queryContext(c)
+	defer cancel()
+	total, approximate, addressIndexes := chain.findTransactions(ctx, account, rows, start, fromTime, toTime)
 	addresses := []httpTypes.EIAddress{}
 	for _, idx := range addressIndexes {
 		addr := httpTypes.AddressToEIAddress(idx)
-		if needTxData || needGas || needGasPrice {
-			addlTxData, err := server.fetcher.TransactionByHash(addr.TxHash)
+		// pseudo-transactions have no transaction fields
+		if len(extraFields) > 0 && idx.RecordType == types.RecordTransaction {
+			addlTxData, err := chain.transactionExtra(addr.TxHash, extraFields)
 			if err == nil {
-				if needTxData {
-					addr.Data = addlTxData.Data
-				}
-				if needGas {
-					addr.Gas = addlTxData.Gas
-				}
-				if needGasPrice {
-					addr.GasPrice = addlTxData.GasPrice
-				}
-
+				setExtraFields(&addr, addlTxData, extraFields)
 			} else {
 				log.WithField("txHash", addr.TxHash).Warn("Server: cannot get additional data for transaction")
 			}
@@ -144,35 +170,82 @@ func (server *Server) getTransactionsByAccount(c *gin.Context) {
 		addresses = append(addresses, addr)
 	}
 	totalStr := strconv.Itoa(total)
-	if total > common.NumMaxTransaction {
-		// If this address has a lot of transactions, just say +10000
-		totalStr = "+" + strconv.Itoa(common.NumMaxTransaction)
+	if approximate {
+		totalStr = "+" + totalStr
+		log.WithFields(log.Fields{
+			"account": account,
+			"total":   total,
+		}).Warn("Server: Account query reached its budget or timeout, returning a partial total")
 	}
 	// response automatically marshalled using json.Marshall()
 	response := httpTypes.EITransactionsByAccount{
-		Total:   totalStr,
-		Start:   start,
-		Indexes: addresses,
+		Total:       totalStr,
+		Start:       start,
+		Indexes:     addresses,
+		Approximate: approximate,
 	}
 	c.JSON(http.StatusOK, response)
 }
 
-func (server *Server) getTotalByAccount(c *gin.Context) {
+// setExtraFields set fields of extra to addr
+func setExtraFields(addr *httpTypes.EIAddress, extra *types.TransactionExtra, fields []string) {
+	for _, field := range fields {
+		switch field {
+		case config.ExtraData:
+			addr.Data = extra.Data
+		case config.ExtraGas:
+			addr.Gas = extra.Gas
+		case config.ExtraGasPrice:
+			addr.GasPrice = extra.GasPrice
+		case config.ExtraType:
+			addr.Type = &extra.Type
+		case config.ExtraNonce:
+			addr.Nonce = &extra.Nonce
+		case config.ExtraMaxFeePerGas:
+			addr.MaxFeePerGas = extra.MaxFeePerGas
+		case config.ExtraMaxPriorityFeePerGas:
+			addr.MaxPriorityFeePerGas = extra.MaxPriorityFeePerGas
+		case config.ExtraEffectiveGasPrice:
+			addr.EffectiveGasPrice = extra.EffectiveGasPrice
+		case config.ExtraGasUsed:
+			addr.GasUsed = &extra.GasUsed
+		}
+	}
+}
+
+func (server *Server) getTotalByAccount(chain *chainAPI, c *gin.Context) {
 	account, fromTime, toTime, err := getAccountParam(c)
 	if err != nil {
 		return
 	}
-	total := server.indexRepo.GetTotalTransaction(account, fromTime, toTime)
+	ctx, cancel := queryContext(c)
+	defer cancel()
+	total, approximate := chain.countTransactions(ctx, account, fromTime, toTime)
+	if approximate {
+		log.WithFields(log.Fields{
+			"account": account,
+			"total":   total,
+		}).Warn("Server: Account query reached its budget or timeout, returning a partial total")
+	}
 	response := httpTypes.EITotalTransaction{
-		Total: total,
+		Total:       total,
+		Approximate: approximate,
 	}
 	c.JSON(http.StatusOK, response)
 }
 
-func (server *Server) getBlock(c *gin.Context) {
+// queryContext context of an account query, it's done when the client is gone or after the query timeout of the config
+func queryContext(c *gin.Context) (context.Context, context.CancelFunc) {
+	if timeout := config.GetConfig().QueryTimeout; timeout > 0 {
+		return context.WithTimeout(c.Request.Context(), timeout)
+	}
+	return context.WithCancel(c.Request.Context())
+}
+
+func (server *Server) getBlock(chain *chainAPI, c *gin.Context) {
 	blockNumber := c.Param("blockNumber")
 	rows, start := getPagingQueryParams(c)
-	total, blocks := server.indexRepo.GetBlocks(blockNumber, rows, start)
+	total, blocks := chain.indexRepo.GetBlocks(blockNumber, rows, start)
 	response := httpTypes.EIBlocks{
 		Total:   total,
 		Start:   start,
@@ -182,7 +255,7 @@ func (server *Server) getBlock(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
-func (server *Server) rerunBlock(c *gin.Context) {
+func (server *Server) rerunBlock(chain *chainAPI, c *gin.Context) {
 	blockNumberStr := c.Param("blockNumber")
 	log.WithField("blockNumber", blockNumberStr).Info("Server: found block from http param")
 	blockNumber := new(big.Int)
@@ -192,7 +265,7 @@ func (server *Server) rerunBlock(c *gin.Context) {
 		return
 	}
 
-	err := server.indexer.FetchAndProcess(blockNumber)
+	err := chain.indexer.FetchAndProcess(blockNumber)
 	if err != nil {
 		c.JSON(500, gin.H{"msg": "internal server error " + err.Error()})
 		return
@@ -201,16 +274,54 @@ func (server *Server) rerunBlock(c *gin.Context) {
 }
 
 func (server *Server) getConfig(c *gin.Context) {
-	ipc := service.GetIpcManager().GetIPC()
+	ipc := server.chains[server.defaultChain].indexer.IpcManager.GetIPC()
 	c.JSON(http.StatusOK, config.GetConfig().String()+" ipc="+ipc)
 }
 
+func (server *Server) getChains(c *gin.Context) {
+	response := []httpTypes.EIChain{}
+	for _, chainID := range server.chainIDs {
+		idx := server.chains[chainID].indexer
+		response = append(response, httpTypes.EIChain{
+			ID:      chainID,
+			Genesis: idx.Genesis.Int64(),
+			IPC:     idx.IpcManager.GetIPC(),
+			Default: chainID == server.defaultChain,
+		})
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func (server *Server) getEndpoints(chain *chainAPI, c *gin.Context) {
+	response := []httpTypes.EIEndpoint{}
+	for _, status := range chain.indexer.IpcManager.GetEndpointStatuses() {
+		response = append(response, httpTypes.EndpointToEIEndpoint(status))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func (server *Server) getQuorum(chain *chainAPI, c *gin.Context) {
+	response := httpTypes.EIQuorum{
+		Quorum:        config.GetConfig().Quorum,
+		Disagreements: chain.indexer.IpcManager.GetDisagreements(),
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func (server *Server) getGaps(chain *chainAPI, c *gin.Context) {
+	response := httpTypes.EIGaps{
+		IndexedRanges: chain.indexRepo.GetIndexedRanges(),
+		Gaps:          chain.indexer.Gaps.Gaps(),
+	}
+	c.JSON(http.StatusOK, response)
+}
+
 func (server *Server) getVersion(c *gin.Context) {
 	c.JSON(http.StatusOK, config.GetVersion())
 }
 
-func (server *Server) getBatchStatus(c *gin.Context) {
-	batchStatuses := server.batchRepo.GetAllBatchStatuses()
+func (server *Server) getBatchStatus(chain *chainAPI, c *gin.Context) {
+	batchStatuses := chain.batchRepo.GetAllBatchStatuses()
 	response := []httpTypes.EIBatchStatus{}
 	for _, batch := range batchStatuses {
 		current := ""
@@ -230,6 +341,35 @@ func (server *Server) getBatchStatus(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+func (server *Server) getBatchProgress(chain *chainAPI, c *gin.Context) {
+	report := chain.indexer.Progress.Report()
+	c.JSON(http.StatusOK, httpTypes.ProgressToEIProgress(report, indexer.ProgressWindows))
+}
+
+func (server *Server) getWorkers(chain *chainAPI, c *gin.Context) {
+	response := httpTypes.EIWorkers{
+		NumWorker:    chain.indexer.Scheduler.NumWorker(),
+		ActiveWorker: chain.indexer.Scheduler.ActiveWorker(),
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func (server *Server) setWorkers(chain *chainAPI, c *gin.Context) {
+	numWorkerStr := c.Param("numWorker")
+	numWorker, err := strconv.Atoi(numWorkerStr)
+	if err != nil {
+		c.JSON(400, gin.H{"msg": "invalid number of workers " + numWorkerStr})
+		return
+	}
+	err = chain.indexer.Scheduler.SetWorkers(numWorker)
+	if err != nil {
+		c.JSON(400, gin.H{"msg": err.Error()})
+		return
+	}
+	log.WithField("numWorker", numWorker).Info("Server: updated number of batch workers")
+	server.getWorkers(chain, c)
+}
+
 // Return rows, start http query params
 func getPagingQueryParams(c *gin.Context) (int, int) {
 	// rows: max result returned
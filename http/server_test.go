@@ -0,0 +1,22 @@
+package http
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/WeTrustPlatform/account-indexer/common/config"
+	"github.com/WeTrustPlatform/account-indexer/core/types"
+	httpTypes "github.com/WeTrustPlatform/account-indexer/http/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetExtraFields(t *testing.T) {
+	extra := &types.TransactionExtra{Gas: 21000, GasPrice: big.NewInt(50), Type: 0, Nonce: 3, EffectiveGasPrice: big.NewInt(50), GasUsed: 21000}
+	addr := httpTypes.EIAddress{}
+	setExtraFields(&addr, extra, []string{config.ExtraGas, config.ExtraType, config.ExtraGasUsed})
+	data, err := json.Marshal(addr)
+	assert.Nil(t, err)
+	// requested fields are returned even if they are zero, other typed transaction fields are omitted
+	assert.JSONEq(t, `{"address":"","txHash":"","value":null,"time":"","coupleAddress":"","data":null,"gas":21000,"gasPrice":null,"type":0,"gasUsed":21000}`, string(data))
+}
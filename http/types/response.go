@@ -12,6 +12,8 @@ import (
 // EITotalTransaction total transaction of an account
 type EITotalTransaction struct {
 	Total int `json:"numFound"`
+	// Approximate the query reached its budget or timeout, Total is a partial count, omitted if false
+	Approximate bool `json:"approximate,omitempty"`
 }
 
 // EITransactionsByAccount response for getTransactionsByAccount api
@@ -19,6 +21,8 @@ type EITransactionsByAccount struct {
 	Total   string      `json:"numFound"`
 	Start   int         `json:"start"`
 	Indexes []EIAddress `json:"data"`
+	// Approximate the query reached its budget or timeout, Total is a partial count with prefix "+", omitted if false
+	Approximate bool `json:"approximate,omitempty"`
 }
 
 // EIAddress response for getTransactionsByAccount api
@@ -29,10 +33,19 @@ type EIAddress struct {
 	Value   *big.Int `json:"value"`
 	Time    string   `json:"time"`
 	// BlockNumber   *big.Int `json:"blockNumber"`
-	CoupleAddress string   `json:"coupleAddress"`
-	Data          []byte   `json:"data"`
-	Gas           uint64   `json:"gas"`
-	GasPrice      *big.Int `json:"gasPrice"`
+	CoupleAddress string `json:"coupleAddress"`
+	// RecordType type of a pseudo-transaction (blockReward, uncleReward or withdrawal), omitted for transactions
+	RecordType string   `json:"recordType,omitempty"`
+	Data       []byte   `json:"data"`
+	Gas        uint64   `json:"gas"`
+	GasPrice   *big.Int `json:"gasPrice"`
+	// fields of typed transactions, only returned when they are in fl
+	Type                 *uint8   `json:"type,omitempty"`
+	Nonce                *uint64  `json:"nonce,omitempty"`
+	MaxFeePerGas         *big.Int `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas *big.Int `json:"maxPriorityFeePerGas,omitempty"`
+	EffectiveGasPrice    *big.Int `json:"effectiveGasPrice,omitempty"`
+	GasUsed              *uint64  `json:"gasUsed,omitempty"`
 }
 
 // EIBlocks list of blocks to return to frontend
@@ -52,13 +65,133 @@ type EIBatchStatus struct {
 	UpdatedAt time.Time `json:"updatedAt"`
 }
 
+// EIProgress overall progress of all batches
+type EIProgress struct {
+	TotalBlocks int64   `json:"totalBlocks"`
+	DoneBlocks  int64   `json:"doneBlocks"`
+	Percent     float64 `json:"percent"`
+	// key is the sliding window, for example "5m0s"
+	BlocksPerSecond map[string]float64 `json:"blocksPerSecond"`
+	ETA             string             `json:"eta"`
+	ETASeconds      int64              `json:"etaSeconds"`
+}
+
+// EIWorkers number of batch workers
+type EIWorkers struct {
+	NumWorker    int `json:"numWorker"`
+	ActiveWorker int `json:"activeWorker"`
+}
+
+// EIEndpoint health of a geth endpoint
+type EIEndpoint struct {
+	Endpoint    string    `json:"endpoint"`
+	Transport   string    `json:"transport"`
+	Current     bool      `json:"current"`
+	Score       float64   `json:"score"`
+	LatestBlock int64     `json:"latestBlock"`
+	PeerCount   int64     `json:"peerCount"`
+	LatencyMs   int64     `json:"latencyMs"`
+	Failures    int       `json:"failures"`
+	LastError   string    `json:"lastError"`
+	LastProbe   time.Time `json:"lastProbe"`
+}
+
+// EIQuorum quorum setting and recent disagreements between endpoints
+type EIQuorum struct {
+	Quorum        int                  `json:"quorum"`
+	Disagreements []types.Disagreement `json:"disagreements"`
+}
+
+// EIBackup status of the last backup started by the admin api
+type EIBackup struct {
+	Running    bool                  `json:"running"`
+	File       string                `json:"file"`
+	StartedAt  time.Time             `json:"startedAt"`
+	FinishedAt time.Time             `json:"finishedAt"`
+	Error      string                `json:"error"`
+	Manifest   *types.BackupManifest `json:"manifest"`
+}
+
+// EIGaps ranges of blocks indexed in realtime and blocks that are not covered by them or by a batch
+type EIGaps struct {
+	IndexedRanges []types.BlockRange `json:"indexedRanges"`
+	Gaps          []types.BlockRange `json:"gaps"`
+}
+
+// EndpointToEIEndpoint business data type to EI data type
+func EndpointToEIEndpoint(status types.EndpointStatus) EIEndpoint {
+	return EIEndpoint{
+		Endpoint:    status.Endpoint,
+		Transport:   status.Transport,
+		Current:     status.Current,
+		Score:       status.Score,
+		LatestBlock: status.LatestBlock,
+		PeerCount:   status.PeerCount,
+		LatencyMs:   int64(status.Latency / time.Millisecond),
+		Failures:    status.Failures,
+		LastError:   status.LastError,
+		LastProbe:   status.LastProbe,
+	}
+}
+
+// ProgressToEIProgress business data type to EI data type
+func ProgressToEIProgress(report types.ProgressReport, windows []time.Duration) EIProgress {
+	speed := map[string]float64{}
+	for _, window := range windows {
+		speed[window.String()] = report.BlocksPerSecond[window]
+	}
+	return EIProgress{
+		TotalBlocks:     report.TotalBlocks,
+		DoneBlocks:      report.DoneBlocks,
+		Percent:         report.Percent,
+		BlocksPerSecond: speed,
+		ETA:             report.ETA.String(),
+		ETASeconds:      int64(report.ETA.Seconds()),
+	}
+}
+
 // AddressToEIAddress business data type to EI data type
 func AddressToEIAddress(address types.AddressIndex) EIAddress {
-	return EIAddress{
+	result := EIAddress{
 		Address:       address.Address,
 		TxHash:        address.TxHash,
 		Value:         address.Value,
 		Time:          common.UnmarshallIntToTime(address.Time).Format(time.RFC3339),
 		CoupleAddress: address.CoupleAddress,
 	}
+	if address.RecordType != types.RecordTransaction {
+		result.RecordType = types.RecordTypeNames[address.RecordType]
+	}
+	return result
+}
+
+// EIChain a chain indexed by this process
+type EIChain struct {
+	ID      string `json:"id"`
+	Genesis int64  `json:"genesis"`
+	IPC     string `json:"ipc"`
+	Default bool   `json:"default"`
+}
+
+// EIAPIKey a key of the public api, Key is only returned when the key is created
+type EIAPIKey struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Key       string    `json:"key,omitempty"`
+	RateLimit float64   `json:"rateLimit"`
+	RateBurst int       `json:"rateBurst"`
+	Disabled  bool      `json:"disabled"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// APIKeyToEIAPIKey business data type to EI data type
+func APIKeyToEIAPIKey(key types.APIKey) EIAPIKey {
+	return EIAPIKey{
+		ID:        key.ID,
+		Name:      key.Name,
+		RateLimit: key.RateLimit,
+		RateBurst: key.RateBurst,
+		Disabled:  key.Disabled,
+		CreatedAt: time.Unix(key.CreatedAt, 0).UTC(),
+	}
 }
@@ -42,3 +42,10 @@ func TestMarshall(t *testing.T) {
 	expectedStr := fmt.Sprintf(`{"numFound":"10","start":5,"data":[{"address":"from1","txHash":"0xtx1","value":-111,"time":"%v","coupleAddress":"to1","data":"AQI=","gas":0,"gasPrice":null}]}`, tm)
 	assert.Equal(t, expectedStr, dataStr)
 }
+
+func TestAddressToEIAddressRecordType(t *testing.T) {
+	assert.Equal(t, "", AddressToEIAddress(index).RecordType)
+	reward := index
+	reward.RecordType = coreTypes.RecordUncleReward
+	assert.Equal(t, "uncleReward", AddressToEIAddress(reward).RecordType)
+}
@@ -0,0 +1,39 @@
+package http
+
+import (
+	"math/big"
+	"net/http"
+
+	"github.com/WeTrustPlatform/account-indexer/indexer"
+	"github.com/gin-gonic/gin"
+)
+
+// startVerify verify blocks of the chain from query param "from" to "to" against the chain in the background,
+// records that differ are repaired if "repair" is true
+func (server *Server) startVerify(chain *chainAPI, c *gin.Context) {
+	from, ok := new(big.Int).SetString(c.Query("from"), 10)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "invalid from block " + c.Query("from")})
+		return
+	}
+	to, ok := new(big.Int).SetString(c.Query("to"), 10)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": "invalid to block " + c.Query("to")})
+		return
+	}
+	repair := c.Query("repair") == "true"
+	err := chain.verifier.Start(server.ctx, server.jobs, from, to, repair)
+	if err == indexer.ErrVerifyRunning {
+		c.JSON(http.StatusConflict, gin.H{"msg": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"msg": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, chain.verifier.Report())
+}
+
+func (server *Server) getVerify(chain *chainAPI, c *gin.Context) {
+	c.JSON(http.StatusOK, chain.verifier.Report())
+}
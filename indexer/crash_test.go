@@ -0,0 +1,115 @@
+package indexer
+
+import (
+	"bufio"
+	"fmt"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/syndtr/goleveldb/leveldb"
+
+	"github.com/WeTrustPlatform/account-indexer/core/types"
+	"github.com/WeTrustPlatform/account-indexer/repository"
+	"github.com/WeTrustPlatform/account-indexer/repository/keyvalue"
+)
+
+// crashDBEnv the database of the helper process that is killed while storing blocks
+const crashDBEnv = "INDEXER_CRASH_TEST_DB"
+
+const crashLastBlock = 1000000
+
+// crashContract the receiver of all transactions
+const crashContract = "0xffffffffffffffffffffffffffffffffffffffff"
+
+func crashAddress(blockNumber int64) string {
+	return fmt.Sprintf("0x%040x", blockNumber)
+}
+
+func crashBlock(blockNumber int64) *types.BLockDetail {
+	return &types.BLockDetail{
+		BlockNumber: big.NewInt(blockNumber),
+		Time:        big.NewInt(blockNumber),
+		Transactions: []types.TransactionDetail{
+			{From: crashAddress(blockNumber), To: crashContract, TxHash: fmt.Sprintf("0x%064x", blockNumber), Value: big.NewInt(1)},
+		},
+	}
+}
+
+// storeBlocksUntilKilled index fake blocks with the scheduler, it prints a line once some blocks are stored
+func storeBlocksUntilKilled(dbPath string) {
+	db, err := leveldb.OpenFile(dbPath, nil)
+	if err != nil {
+		panic(err)
+	}
+	indexRepo, batchRepo := keyvalue.NewLevelDbRepos(db)
+	idx := NewIndexer(indexRepo, batchRepo, nil)
+	scheduler := NewScheduler(batchRepo, 4, 1000, 10)
+	// OnBlockDone is called by all workers
+	numDone := int64(0)
+	scheduler.OnBlockDone = func(blockNumber *big.Int) {
+		if atomic.AddInt64(&numDone, 1) == 500 {
+			fmt.Println("stored")
+		}
+	}
+	newHandler := func() (RangeHandler, error) {
+		return func(from *big.Int, to *big.Int, done func(blockNumber *big.Int, wb repository.WriteBatch)) error {
+			for i := from.Int64(); i <= to.Int64(); i++ {
+				idx.storeBatchBlock(crashBlock(i), done)
+			}
+			return nil
+		}, nil
+	}
+	scheduler.Run(GetInitBatches(100000, big.NewInt(1), big.NewInt(crashLastBlock)), newHandler, make(chan struct{}))
+}
+
+// TestCrashRecovery kill a process while it's storing blocks, every block before the saved progress
+// of a batch must be stored and none after it
+func TestCrashRecovery(t *testing.T) {
+	if dbPath := os.Getenv(crashDBEnv); dbPath != "" {
+		storeBlocksUntilKilled(dbPath)
+		return
+	}
+	if testing.Short() {
+		t.Skip("starts a helper process")
+	}
+	dbPath := filepath.Join(t.TempDir(), "db")
+	cmd := exec.Command(os.Args[0], "-test.run=^TestCrashRecovery$")
+	cmd.Env = append(os.Environ(), crashDBEnv+"="+dbPath)
+	stdout, err := cmd.StdoutPipe()
+	assert.Nil(t, err)
+	assert.Nil(t, cmd.Start())
+	_, err = bufio.NewReader(stdout).ReadString('\n')
+	assert.Nil(t, err)
+	time.Sleep(50 * time.Millisecond)
+	assert.Nil(t, cmd.Process.Kill())
+	cmd.Wait()
+
+	db, err := leveldb.OpenFile(dbPath, nil)
+	assert.Nil(t, err)
+	defer db.Close()
+	indexRepo, batchRepo := keyvalue.NewLevelDbRepos(db)
+	isStored := func(blockNumber int64) bool {
+		return indexRepo.GetTotalTransaction(crashAddress(blockNumber), time.Time{}, time.Time{}) == 1
+	}
+	batches := batchRepo.GetAllBatchStatuses()
+	assert.Equal(t, crashLastBlock/1000, len(batches))
+	numStored := 0
+	for _, batch := range batches {
+		next := nextBlock(batch).Int64()
+		if batch.Current != nil {
+			assert.True(t, isStored(batch.From.Int64()), "first block should be stored: "+batch.String())
+			assert.True(t, isStored(batch.Current.Int64()), "current block should be stored: "+batch.String())
+			numStored += int(batch.Current.Int64() - batch.From.Int64() + 1)
+		}
+		if next <= batch.To.Int64() {
+			assert.False(t, isStored(next), "next block should not be stored: "+batch.String())
+		}
+	}
+	assert.True(t, numStored >= 500)
+}
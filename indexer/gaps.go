@@ -0,0 +1,104 @@
+package indexer
+
+import (
+	"context"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/WeTrustPlatform/account-indexer/common/config"
+	"github.com/WeTrustPlatform/account-indexer/core/types"
+	"github.com/WeTrustPlatform/account-indexer/repository"
+	log "github.com/sirupsen/logrus"
+)
+
+// GapDetector find blocks that are neither indexed in realtime nor covered by a batch, for example
+// blocks received while the realtime subscription was down, and schedule batches to backfill them
+type GapDetector struct {
+	indexRepo repository.IndexRepo
+	batchRepo repository.BatchRepo
+	scheduler *Scheduler
+	genesis   int64
+}
+
+// NewGapDetector create a GapDetector instance, blocks before genesis are never gaps
+func NewGapDetector(indexRepo repository.IndexRepo, batchRepo repository.BatchRepo, scheduler *Scheduler, genesis int64) *GapDetector {
+	return &GapDetector{indexRepo: indexRepo, batchRepo: batchRepo, scheduler: scheduler, genesis: genesis}
+}
+
+// Gaps blocks from genesis to the last realtime or batch block that are not covered,
+// blocks of a batch are covered even if the batch is not done yet
+func (gd *GapDetector) Gaps() []types.BlockRange {
+	covered := gd.indexRepo.GetIndexedRanges()
+	for _, batch := range gd.batchRepo.GetAllBatchStatuses() {
+		covered = append(covered, types.BlockRange{From: batch.From.Int64(), To: batch.To.Int64()})
+	}
+	return FindGaps(gd.genesis, covered)
+}
+
+// FindGaps holes between genesis and the last block of the covered ranges
+func FindGaps(genesis int64, covered []types.BlockRange) []types.BlockRange {
+	sorted := append([]types.BlockRange{}, covered...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].From < sorted[j].From
+	})
+	gaps := []types.BlockRange{}
+	// next first block that is not covered yet
+	next := genesis
+	for _, rg := range sorted {
+		if rg.From > next {
+			gaps = append(gaps, types.BlockRange{From: next, To: rg.From - 1})
+		}
+		if rg.To+1 > next {
+			next = rg.To + 1
+		}
+	}
+	return gaps
+}
+
+// Watch check for gaps regularly until ctx is cancelled, the batches of gaps are processed with newHandler
+func (gd *GapDetector) Watch(ctx context.Context, newHandler HandlerFactory) {
+	ticker := time.NewTicker(config.GetConfig().GapInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("GapDetector: Stopped")
+			return
+		case <-ticker.C:
+			gd.fill(ctx, newHandler)
+		}
+	}
+}
+
+// fill save a batch for every gap so it's not lost on restart, then queue them to the scheduler
+// or process them here if the scheduler is not running
+func (gd *GapDetector) fill(ctx context.Context, newHandler HandlerFactory) {
+	gaps := gd.Gaps()
+	if len(gaps) == 0 {
+		return
+	}
+	now := big.NewInt(time.Now().Unix())
+	batches := []types.BatchStatus{}
+	for _, gap := range gaps {
+		batch := types.BatchStatus{
+			From:      big.NewInt(gap.From),
+			To:        big.NewInt(gap.To),
+			Step:      1,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if err := gd.batchRepo.UpdateBatch(batch); err != nil {
+			log.WithFields(log.Fields{
+				"batch": batch.String(),
+				"error": err.Error(),
+			}).Error("GapDetector: Cannot save batch")
+			return
+		}
+		log.WithField("gap", gap.String()).Warn("GapDetector: Found gap, scheduled a batch to backfill it")
+		batches = append(batches, batch)
+	}
+	if !gd.scheduler.Add(batches) {
+		gd.scheduler.Run(batches, newHandler, ctx.Done())
+	}
+}
@@ -0,0 +1,56 @@
+package indexer
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/WeTrustPlatform/account-indexer/core/types"
+	"github.com/WeTrustPlatform/account-indexer/repository"
+)
+
+func TestFindGaps(t *testing.T) {
+	assert.Equal(t, []types.BlockRange{}, FindGaps(0, nil))
+	assert.Equal(t, []types.BlockRange{}, FindGaps(0, []types.BlockRange{{From: 0, To: 10}, {From: 11, To: 20}}))
+	// overlapping and unsorted ranges
+	covered := []types.BlockRange{{From: 30, To: 40}, {From: 5, To: 10}, {From: 0, To: 8}, {From: 12, To: 20}, {From: 15, To: 18}}
+	assert.Equal(t, []types.BlockRange{{From: 11, To: 11}, {From: 21, To: 29}}, FindGaps(0, covered))
+	assert.Equal(t, []types.BlockRange{{From: 0, To: 99}}, FindGaps(0, []types.BlockRange{{From: 100, To: 100}}))
+	// blocks before genesis are not gaps
+	assert.Equal(t, []types.BlockRange{{From: 50, To: 99}}, FindGaps(50, []types.BlockRange{{From: 100, To: 100}}))
+	assert.Equal(t, []types.BlockRange{}, FindGaps(50, []types.BlockRange{{From: 50, To: 100}}))
+}
+
+func TestFillGaps(t *testing.T) {
+	idx := NewTestIndexer()
+	now := big.NewInt(time.Now().Unix())
+	assert.Nil(t, idx.BatchRepo.UpdateBatch(types.BatchStatus{From: big.NewInt(0), To: big.NewInt(9), Current: big.NewInt(9), Step: 1, CreatedAt: now, UpdatedAt: now}))
+	// realtime subscription dropped after block 12
+	for _, blockNumber := range []int64{10, 11, 12, 20, 21} {
+		assert.Nil(t, idx.ProcessBlock(crashBlock(blockNumber), false))
+	}
+	assert.Equal(t, []types.BlockRange{{From: 13, To: 19}}, idx.Gaps.Gaps())
+
+	stored := []int64{}
+	newHandler := func() (RangeHandler, error) {
+		return func(from *big.Int, to *big.Int, done func(blockNumber *big.Int, wb repository.WriteBatch)) error {
+			for i := from.Int64(); i <= to.Int64(); i++ {
+				idx.storeBatchBlock(crashBlock(i), done)
+				stored = append(stored, i)
+			}
+			return nil
+		}, nil
+	}
+	// the scheduler is not running, the gaps are processed by the detector
+	assert.False(t, idx.Scheduler.Add(nil))
+	idx.Gaps.fill(context.Background(), newHandler)
+	assert.Equal(t, []int64{13, 14, 15, 16, 17, 18, 19}, stored)
+	assert.Equal(t, []types.BlockRange{}, idx.Gaps.Gaps())
+	for _, batch := range idx.BatchRepo.GetAllBatchStatuses() {
+		assert.True(t, batch.IsDone(), batch.String())
+	}
+	assert.Equal(t, 1, idx.IndexRepo.GetTotalTransaction(crashAddress(15), time.Time{}, time.Time{}))
+}
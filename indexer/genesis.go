@@ -0,0 +1,85 @@
+package indexer
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/WeTrustPlatform/account-indexer/common"
+	"github.com/WeTrustPlatform/account-indexer/core/types"
+	"github.com/WeTrustPlatform/account-indexer/repository"
+	gethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+)
+
+// genesisTxHash tx hash of genesis records, allocations are not transactions
+var genesisTxHash = hexutil.Encode(make([]byte, gethcommon.HashLength))
+
+// Genesis the timestamp and allocations of a genesis file in the format of geth (genesis.json)
+type Genesis struct {
+	Timestamp math.HexOrDecimal64       `json:"timestamp"`
+	Alloc     map[string]GenesisAccount `json:"alloc"`
+}
+
+// GenesisAccount an allocation of a genesis file, code and storage are ignored
+type GenesisAccount struct {
+	Balance *math.HexOrDecimal256 `json:"balance"`
+}
+
+// ReadGenesis decode a genesis file, addresses of alloc are hex with or without 0x like in geth
+func ReadGenesis(reader io.Reader) (*Genesis, error) {
+	genesis := &Genesis{}
+	if err := json.NewDecoder(reader).Decode(genesis); err != nil {
+		return nil, errors.New("invalid genesis file: " + err.Error())
+	}
+	for address, account := range genesis.Alloc {
+		if !gethcommon.IsHexAddress(address) {
+			return nil, errors.New("invalid address " + address + " in alloc of genesis file")
+		}
+		if account.Balance != nil && (*big.Int)(account.Balance).Sign() < 0 {
+			return nil, errors.New("negative balance of " + address + " in alloc of genesis file")
+		}
+	}
+	return genesis, nil
+}
+
+// CreateGenesisData address records of the allocations of a genesis file: an inflow of the balance at the genesis
+// timestamp with zero tx hash and couple address, ordered by address. Allocations without balance have no record
+func CreateGenesisData(genesis *Genesis) []*types.AddressIndex {
+	result := []*types.AddressIndex{}
+	for address, account := range genesis.Alloc {
+		if account.Balance == nil || (*big.Int)(account.Balance).Sign() == 0 {
+			continue
+		}
+		result = append(result, &types.AddressIndex{
+			AddressSequence: types.AddressSequence{
+				Address: strings.ToLower(gethcommon.HexToAddress(address).Hex()),
+				// the genesis block has no other records
+				Sequence: 1,
+			},
+			TxHash:        genesisTxHash,
+			Value:         new(big.Int).Set((*big.Int)(account.Balance)),
+			Time:          new(big.Int).SetUint64(uint64(genesis.Timestamp)),
+			CoupleAddress: common.AddressZero,
+			RecordType:    types.RecordGenesis,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Address < result[j].Address
+	})
+	return result
+}
+
+// ImportGenesis store the records of the allocations of a genesis file in one atomic write, importing a file again
+// overwrites its records. It returns the number of records
+func ImportGenesis(indexRepo repository.IndexRepo, genesis *Genesis) (int, error) {
+	records := CreateGenesisData(genesis)
+	if err := indexRepo.RepairAddressIndex(records, nil); err != nil {
+		return 0, err
+	}
+	return len(records), nil
+}
@@ -0,0 +1,65 @@
+package indexer
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/WeTrustPlatform/account-indexer/common"
+	"github.com/WeTrustPlatform/account-indexer/core/types"
+)
+
+const genesisFile = `{
+	"config": {"chainId": 1337},
+	"timestamp": "0x5c2aad80",
+	"alloc": {
+		"0000000000000000000000000000000000000002": {"balance": "1000000000000000000"},
+		"0x00000000000000000000000000000000000000AA": {"balance": "0x10"},
+		"0x0000000000000000000000000000000000000003": {"code": "0x00"}
+	}
+}`
+
+func TestReadGenesis(t *testing.T) {
+	genesis, err := ReadGenesis(strings.NewReader(genesisFile))
+	assert.Nil(t, err)
+	records := CreateGenesisData(genesis)
+	assert.Equal(t, 2, len(records))
+	assert.Equal(t, &types.AddressIndex{
+		AddressSequence: types.AddressSequence{Address: "0x0000000000000000000000000000000000000002", Sequence: 1},
+		TxHash:          "0x0000000000000000000000000000000000000000000000000000000000000000",
+		Value:           big.NewInt(1e18),
+		Time:            big.NewInt(1546300800),
+		CoupleAddress:   common.AddressZero,
+		RecordType:      types.RecordGenesis,
+	}, records[0])
+	assert.Equal(t, "0x00000000000000000000000000000000000000aa", records[1].Address)
+	assert.Equal(t, big.NewInt(16), records[1].Value)
+
+	_, err = ReadGenesis(strings.NewReader(`{"alloc": {"0x01": {"balance": "1"}}}`))
+	assert.NotNil(t, err)
+	_, err = ReadGenesis(strings.NewReader(`{"alloc": {"0x0000000000000000000000000000000000000002": {"balance": "-1"}}}`))
+	assert.NotNil(t, err)
+	_, err = ReadGenesis(strings.NewReader(`{"alloc": [`))
+	assert.NotNil(t, err)
+}
+
+func TestImportGenesis(t *testing.T) {
+	idx := NewTestIndexer()
+	genesis, err := ReadGenesis(strings.NewReader(genesisFile))
+	assert.Nil(t, err)
+	for i := 0; i < 2; i++ {
+		// importing again overwrites the records
+		total, err := ImportGenesis(idx.IndexRepo, genesis)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, total)
+	}
+	address := "0x0000000000000000000000000000000000000002"
+	total, indexes := idx.IndexRepo.GetTransactionByAddress(address, 10, 0, time.Time{}, time.Time{})
+	assert.Equal(t, 1, total)
+	assert.Equal(t, types.RecordGenesis, indexes[0].RecordType)
+	assert.Equal(t, big.NewInt(1e18), indexes[0].Value)
+	assert.Equal(t, 1, idx.IndexRepo.GetTotalTransaction(address, time.Time{}, time.Time{}))
+}
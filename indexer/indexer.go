@@ -1,6 +1,7 @@
 package indexer
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math/big"
@@ -19,39 +20,67 @@ import (
 
 // Indexer fetch data from blockchain and store in a repository
 type Indexer struct {
-	IndexRepo       repository.IndexRepo
-	BatchRepo       repository.BatchRepo
-	bdChan          chan *types.BLockDetail
-	watcher         watcher.Watcher
-	realtimeFetcher *fetcher.ChainFetch
-	stopChan        chan struct{}
+	// ChainID id of the indexed chain in the config and the api
+	ChainID string
+	// IpcManager endpoints of the chain
+	IpcManager *service.IpcManager
+	// Genesis first block of the chain, blocks before it are not indexed
+	Genesis   *big.Int
+	IndexRepo repository.IndexRepo
+	BatchRepo repository.BatchRepo
+	watcher   watcher.Watcher
+	Scheduler *Scheduler
+	Progress  *Progress
+	Gaps      *GapDetector
+	// ctx the lifetime of the indexer, set by FirstIndex
+	ctx context.Context
+	// runMutex guards the current index run, a new run is started after every ipc change
+	runMutex  sync.Mutex
+	cancelRun context.CancelFunc
+	runDone   chan struct{}
 }
 
-// NewIndexer create an Indexer
-func NewIndexer(IndexRepo repository.IndexRepo, BatchRepo repository.BatchRepo, wa watcher.Watcher) Indexer {
-	result := Indexer{IndexRepo: IndexRepo, BatchRepo: BatchRepo, watcher: wa}
+// NewIndexer create an Indexer of the default chain, its endpoints are in the global ipc manager
+func NewIndexer(IndexRepo repository.IndexRepo, BatchRepo repository.BatchRepo, wa watcher.Watcher) *Indexer {
+	return NewChainIndexer(common.DefaultChainID, service.GetIpcManager(), big.NewInt(common.DefaultGenesis), IndexRepo, BatchRepo, wa)
+}
+
+// NewChainIndexer create an Indexer of a chain whose endpoints are in ipcManager, blocks are indexed from genesis
+func NewChainIndexer(chainID string, ipcManager *service.IpcManager, genesis *big.Int, IndexRepo repository.IndexRepo, BatchRepo repository.BatchRepo, wa watcher.Watcher) *Indexer {
+	segmentSize := int64(config.GetConfig().FetchBatchSize * fetcher.PipelineDepth)
+	scheduler := NewScheduler(BatchRepo, config.GetConfig().NumBatch, config.GetConfig().ChunkSize, segmentSize)
+	progress := NewProgress(BatchRepo)
+	scheduler.OnBlockDone = progress.BlockDone
+	gaps := NewGapDetector(IndexRepo, BatchRepo, scheduler, genesis.Int64())
+	result := &Indexer{
+		ChainID:    chainID,
+		IpcManager: ipcManager,
+		Genesis:    genesis,
+		IndexRepo:  IndexRepo,
+		BatchRepo:  BatchRepo,
+		watcher:    wa,
+		Scheduler:  scheduler,
+		Progress:   progress,
+		Gaps:       gaps,
+	}
 	if wa == nil {
-		wt := watcher.NewNodeStatusWatcher(IndexRepo, BatchRepo)
+		wt := watcher.NewNodeStatusWatcher(IndexRepo, BatchRepo, ipcManager)
 		result.watcher = &wt
 	}
 	return result
 }
 
-// IpcUpdated implements IpcSubscriber interface
+// IpcUpdated implements IpcSubscriber interface, it stops the current run then starts a new one with the new ipc
 func (indexer *Indexer) IpcUpdated(ipcPath string) {
-	if indexer.realtimeFetcher != nil {
-		// let the old realtime fetch go, no need to give it new ipc
-		indexer.realtimeFetcher.IpcUpdated()
-	}
-	log.Info("Indexer: stopping all batch index goroutines, waiting for 30s")
-	// finish any ongoing go-routines of this fetcher
-	if indexer.stopChan != nil {
-		close(indexer.stopChan)
+	indexer.runMutex.Lock()
+	defer indexer.runMutex.Unlock()
+	log.Info("Indexer: stopping all index goroutines")
+	indexer.stop()
+	log.Info("Indexer: stopped all index goroutines")
+	if indexer.ctx.Err() != nil {
+		return
 	}
-	time.Sleep(30 * time.Second)
-	log.Info("Indexer: stopped all batch index goroutines")
-	indexAfterIPCChange := true
-	indexer.index(indexAfterIPCChange)
+	indexer.start()
 }
 
 // Name implements IpcSubscriber interface
@@ -59,68 +88,93 @@ func (indexer *Indexer) Name() string {
 	return "Indexer"
 }
 
-// FirstIndex Entry point
-func (indexer *Indexer) FirstIndex() {
-	indexAfterIPCChange := false
-	indexer.index(indexAfterIPCChange)
+// FirstIndex Entry point, it returns after ctx is cancelled and all index goroutines are stopped,
+// in-flight blocks are stored and batch statuses are saved by then
+func (indexer *Indexer) FirstIndex(ctx context.Context) {
+	indexer.ctx = ctx
+	var sub service.IpcSubscriber = indexer
+	indexer.IpcManager.Subscribe(&sub)
+	indexer.runMutex.Lock()
+	indexer.start()
+	indexer.runMutex.Unlock()
+	<-ctx.Done()
+	indexer.runMutex.Lock()
+	defer indexer.runMutex.Unlock()
+	indexer.stop()
+	log.Info("Indexer: stopped")
+}
+
+// start a new index run, runMutex should be locked
+func (indexer *Indexer) start() {
+	runCtx, cancel := context.WithCancel(indexer.ctx)
+	done := make(chan struct{})
+	indexer.cancelRun = cancel
+	indexer.runDone = done
+	go func() {
+		defer close(done)
+		indexer.index(runCtx)
+	}()
 }
 
-func (indexer *Indexer) index(indexAfterIPCChange bool) {
-	service.GetIpcManager().EnableSwitchIPC()
-	indexer.stopChan = make(chan struct{})
-	if !indexAfterIPCChange {
-		// don't subscribe again
-		var sub service.IpcSubscriber = indexer
-		service.GetIpcManager().Subscribe(&sub)
+// stop the current index run and wait for all of its goroutines, runMutex should be locked
+func (indexer *Indexer) stop() {
+	if indexer.cancelRun == nil {
+		return
 	}
-	fetcher, err := fetcher.NewChainFetch()
+	indexer.cancelRun()
+	<-indexer.runDone
+	indexer.cancelRun = nil
+}
+
+// index realtime blocks and batches with the current ipc until ctx is cancelled
+func (indexer *Indexer) index(ctx context.Context) {
+	indexer.IpcManager.EnableSwitchIPC()
+	realtimeFetcher, err := fetcher.NewChainFetchOf(indexer.IpcManager)
 	if err != nil {
 		log.Error("Indexer: index stopped because cannot create new fetch for realtime goroutine")
-		indexer.realtimeFetcher = nil
 		return
 	}
-	indexer.realtimeFetcher = fetcher
+	defer realtimeFetcher.Close()
 
-	latestBlock, err := indexer.realtimeFetcher.GetLatestBlock()
+	latestBlock, err := realtimeFetcher.GetLatestBlock()
 	if err != nil {
 		log.WithField("error", err.Error()).Error("Indexer: Can't get latest block, check IPC server.")
 		return
 	}
 	log.WithFields(log.Fields{
-		"ipc":         service.GetIpcManager().GetIPC(),
+		"chain":       indexer.ChainID,
+		"ipc":         indexer.IpcManager.GetIPC(),
 		"latestBlock": latestBlock.String(),
 	}).Info("Indexer: IPC path is correct")
 	batches := indexer.getBatches(latestBlock)
 	mainWG := sync.WaitGroup{}
-	mainWG.Add(2)
-	batchWG := sync.WaitGroup{}
-	batchWG.Add(len(batches))
-	// index batches
-	for _, bt := range batches {
-		_bt := bt
-		go func() {
-			defer batchWG.Done()
-			current := ""
-			if _bt.Current != nil {
-				current = _bt.Current.String()
-			}
-			tag := "" + _bt.From.String() + "-" + _bt.To.String() + "-" + current + ":"
-			indexer.batchIndex(_bt, indexer.stopChan, tag)
-		}()
-	}
+	mainWG.Add(1)
 	// index realtime
 	go func() {
 		defer mainWG.Done()
-		indexer.realtimeIndex()
+		indexer.realtimeIndex(ctx, realtimeFetcher)
 	}()
 
-	batchWG.Wait()
-	log.Info("Indexer: All batches are done, starting watcher")
+	newHandler := func() (RangeHandler, error) {
+		return indexer.newBatchHandler(ctx)
+	}
+	// backfill blocks missed by realtime index
+	mainWG.Add(1)
 	go func() {
 		defer mainWG.Done()
-		indexer.watcher.Watch()
+		indexer.Gaps.Watch(ctx, newHandler)
 	}()
 
+	// index batches
+	start := time.Now()
+	batchDone := make(chan struct{})
+	go indexer.logProgress(batchDone)
+	indexer.Scheduler.Run(batches, newHandler, ctx.Done())
+	close(batchDone)
+	if ctx.Err() == nil {
+		log.WithField("duration", fmt.Sprintf("%f minutes", time.Since(start).Minutes())).Info("Indexer: All batches are done, starting watcher")
+		indexer.watcher.Watch(ctx)
+	}
 	mainWG.Wait()
 }
 
@@ -129,9 +183,7 @@ func (indexer *Indexer) getBatches(latestBlock *big.Int) []types.BatchStatus {
 	batches := []types.BatchStatus{}
 	now := big.NewInt(time.Now().Unix())
 	if len(allBatches) == 0 {
-		// Ethereum mainnet has genesis block as 0
-		genesisBlock := big.NewInt(0)
-		batches = GetInitBatches(config.GetConfig().NumBatch, genesisBlock, latestBlock)
+		batches = GetInitBatches(config.GetConfig().ChunkSize, indexer.Genesis, latestBlock)
 	} else {
 		// Get latest block in block database
 		lastBlock, _ := indexer.IndexRepo.GetLastBlock()
@@ -158,15 +210,15 @@ func (indexer *Indexer) getBatches(latestBlock *big.Int) []types.BatchStatus {
 	return batches
 }
 
-// RealtimeIndex newHead subscribe
-func (indexer *Indexer) realtimeIndex() {
+// RealtimeIndex newHead subscribe, blocks received before ctx is cancelled are stored
+func (indexer *Indexer) realtimeIndex(ctx context.Context, realtimeFetcher *fetcher.ChainFetch) {
 	log.Info("Indexer: Starting realtime index")
-	indexer.bdChan = make(chan *types.BLockDetail)
-	go indexer.realtimeFetcher.RealtimeFetch(indexer.bdChan)
+	bdChan := make(chan *types.BLockDetail)
+	go realtimeFetcher.RealtimeFetch(ctx, bdChan)
 	for {
-		blockDetail, ok := <-indexer.bdChan
+		blockDetail, ok := <-bdChan
 		if !ok {
-			log.Error("Indexer: Stopping realtimeIndex, ipc is switched?")
+			log.Info("Indexer: Stopping realtimeIndex, ipc is switched or indexer is stopped")
 			break
 		}
 		log.WithFields(log.Fields{
@@ -176,75 +228,104 @@ func (indexer *Indexer) realtimeIndex() {
 		isBatch := false
 		indexer.ProcessBlock(blockDetail, isBatch)
 	}
-	indexer.realtimeFetcher = nil
 	log.Info("Indexer: Stopped realtimeIndex")
 }
 
-// from: inclusive, to: exclusive
-func (indexer *Indexer) batchIndex(batch types.BatchStatus, stop chan struct{}, tag string) {
-	log.WithField("tag", tag).Info("Indexer: start batchIndex")
-	start := time.Now()
-	fetcher, err := fetcher.NewChainFetch()
+// logProgress log the batch progress regularly until done is closed
+func (indexer *Indexer) logProgress(done chan struct{}) {
+	ticker := time.NewTicker(config.GetConfig().ProgressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			report := indexer.Progress.Report()
+			fields := log.Fields{
+				"doneBlocks":  report.DoneBlocks,
+				"totalBlocks": report.TotalBlocks,
+				"percent":     fmt.Sprintf("%.2f", report.Percent),
+				"eta":         report.ETA.String(),
+			}
+			for _, window := range ProgressWindows {
+				fields["speed"+window.String()] = fmt.Sprintf("%.2f", report.BlocksPerSecond[window])
+			}
+			log.WithFields(fields).Info("Indexer: batch progress")
+		}
+	}
+}
+
+// newBatchHandler create a RangeHandler with its own fetcher for a scheduler worker.
+// Blocks are fetched and decoded by the fetcher pipeline while this goroutine stores them.
+func (indexer *Indexer) newBatchHandler(ctx context.Context) (RangeHandler, error) {
+	fetcher, err := fetcher.NewChainFetchOf(indexer.IpcManager)
 	if err != nil {
-		log.WithFields(log.Fields{
-			"tag":   tag,
-			"error": err.Error(),
-		}).Info("Indexer: batchIndex can't connect to IPC server")
-		return
+		return nil, err
 	}
-	i := 0
-	for !batch.IsDone() {
-		blockNumber := batch.Next()
-		blockDetail, err := fetcher.FetchABlock(blockNumber)
-		if err != nil {
-			// Finish the go-routines, someone will restart index()
-			log.WithFields(log.Fields{
-				"tag":         tag,
-				"blockNumber": blockNumber.String(),
-				"error":       err.Error(),
-			}).Error("Indexer: cannot get block")
-			break
-		}
-		isBatch := true
-		err = indexer.ProcessBlock(blockDetail, isBatch)
-		if err != nil {
-			panic(errors.New(tag + " Indexer: cannot process block " + blockNumber.String() + " , error is " + err.Error()))
-		}
-		batch.UpdatedAt = big.NewInt(time.Now().Unix())
-		err = indexer.BatchRepo.UpdateBatch(batch)
-		if err != nil {
-			panic(errors.New(tag + " Indexer: cannot update batch for process block " + blockNumber.String() + " , error is " + err.Error()))
-		}
-		i++
-		if i%10 == 0 {
-			select {
-			case <-stop:
-				break
-			default:
-				continue
-			}
+	go func() {
+		<-ctx.Done()
+		fetcher.Close()
+	}()
+	handler := func(from *big.Int, to *big.Int, done func(blockNumber *big.Int, wb repository.WriteBatch)) error {
+		ch := make(chan *types.BLockDetail, config.GetConfig().FetchBatchSize)
+		fetchErr := make(chan error, 1)
+		go func() {
+			fetchErr <- fetcher.FetchRange(ctx, from, to, ch)
+		}()
+		for blockDetail := range ch {
+			indexer.storeBatchBlock(blockDetail, done)
 		}
+		return <-fetchErr
 	}
-	duration := time.Since(start)
-	s := fmt.Sprintf("%f minutes", duration.Minutes())
-	log.WithFields(log.Fields{
-		"tag":      tag,
-		"duration": s,
-	}).Info("Indexer: batchIndex is done")
+	return handler, nil
+}
+
+// storeBatchBlock store a block of a batch, done commits it together with the batch progress
+// so a crash never leaves a block without its progress or the other way around
+func (indexer *Indexer) storeBatchBlock(blockDetail *types.BLockDetail, done func(blockNumber *big.Int, wb repository.WriteBatch)) {
+	wb := indexer.IndexRepo.NewWriteBatch()
+	isBatch := true
+	err := indexer.storeIn(wb, blockDetail, isBatch)
+	if err != nil {
+		panic(errors.New("Indexer: cannot process block " + blockDetail.BlockNumber.String() + " , error is " + err.Error()))
+	}
+	done(blockDetail.BlockNumber, wb)
 }
 
 // ProcessBlock transform blockchain data to our index structure and save it to repo
 func (indexer *Indexer) ProcessBlock(blockDetail *types.BLockDetail, isBatch bool) error {
+	wb := indexer.IndexRepo.NewWriteBatch()
+	err := indexer.storeIn(wb, blockDetail, isBatch)
+	if err != nil {
+		return err
+	}
+	err = wb.Commit()
+	if err != nil {
+		panic(errors.New("Indexer: cannot write block " + blockDetail.BlockNumber.String() + ", error is " + err.Error()))
+	}
+	return nil
+}
+
+// storeIn add index data and kept transaction extras of a block to wb
+func (indexer *Indexer) storeIn(wb repository.WriteBatch, blockDetail *types.BLockDetail, isBatch bool) error {
 	addressIndex, blockIndex := indexer.CreateIndexData(blockDetail)
-	return indexer.IndexRepo.Store(addressIndex, blockIndex, isBatch)
+	err := indexer.IndexRepo.StoreIn(wb, addressIndex, blockIndex, isBatch)
+	if err != nil {
+		return err
+	}
+	if extras := CreateExtraData(blockDetail); len(extras) > 0 {
+		return indexer.IndexRepo.StoreExtrasIn(wb, extras)
+	}
+	return nil
 }
 
 // FetchAndProcess fetch a block data from blockchain and process it
 func (indexer *Indexer) FetchAndProcess(blockNumber *big.Int) error {
-	fetcher, err := fetcher.NewChainFetch()
+	fetcher, err := fetcher.NewChainFetchOf(indexer.IpcManager)
 	if err != nil {
 		return err
 	}
+	defer fetcher.Close()
 	blockDetail, err := fetcher.FetchABlock(blockNumber)
 	if err != nil {
 		return err
@@ -294,6 +375,7 @@ func (indexer *Indexer) CreateIndexData(blockDetail *types.BLockDetail) ([]*type
 				Time:   blockDetail.Time,
 				// BlockNumber:   blockDetail.BlockNumber,
 				CoupleAddress: to,
+				RecordType:    transaction.RecordType,
 			}
 			if _, ok := sequenceMap[from]; !ok {
 				sequenceMap[from] = 0
@@ -311,6 +393,7 @@ func (indexer *Indexer) CreateIndexData(blockDetail *types.BLockDetail) ([]*type
 				Time:   blockDetail.Time,
 				// BlockNumber:   blockDetail.BlockNumber,
 				CoupleAddress: from,
+				RecordType:    transaction.RecordType,
 			}
 			if _, ok := sequenceMap[to]; !ok {
 				sequenceMap[to] = 0
@@ -327,18 +410,34 @@ func (indexer *Indexer) CreateIndexData(blockDetail *types.BLockDetail) ([]*type
 	return addressIndex, blockIndex
 }
 
-// GetInitBatches create batch initially
-func GetInitBatches(numBatch int, genesisBlock *big.Int, latestBlock *big.Int) []types.BatchStatus {
+// CreateExtraData the kept extras of the transactions of a block by tx hash
+func CreateExtraData(blockDetail *types.BLockDetail) map[string]*types.TransactionExtra {
+	extras := map[string]*types.TransactionExtra{}
+	for _, transaction := range blockDetail.Transactions {
+		if transaction.Extra != nil {
+			extras[transaction.TxHash] = transaction.Extra
+		}
+	}
+	return extras
+}
+
+// GetInitBatches split the range from genesis block to latest block into chunks of chunkSize blocks
+func GetInitBatches(chunkSize int64, genesisBlock *big.Int, latestBlock *big.Int) []types.BatchStatus {
 	result := []types.BatchStatus{}
 	now := big.NewInt(time.Now().Unix())
-	for i := 0; i < numBatch; i++ {
-		from := new(big.Int)
-		from = from.Add(genesisBlock, big.NewInt(int64(i)))
+	if chunkSize < 1 {
+		chunkSize = 1
+	}
+	for from := genesisBlock.Int64(); from <= latestBlock.Int64(); from += chunkSize {
+		to := from + chunkSize - 1
+		if to > latestBlock.Int64() {
+			to = latestBlock.Int64()
+		}
 		batch := types.BatchStatus{
-			From:      from,
-			To:        latestBlock,
+			From:      big.NewInt(from),
+			To:        big.NewInt(to),
 			CreatedAt: now,
-			Step:      byte(numBatch),
+			Step:      byte(1),
 		}
 		result = append(result, batch)
 	}
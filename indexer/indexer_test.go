@@ -12,7 +12,6 @@ import (
 
 	"github.com/WeTrustPlatform/account-indexer/core/types"
 	"github.com/WeTrustPlatform/account-indexer/repository/keyvalue"
-	"github.com/WeTrustPlatform/account-indexer/repository/keyvalue/dao"
 )
 
 var blockTime = big.NewInt(time.Now().Unix())
@@ -103,18 +102,42 @@ func TestCreateIndexData(t *testing.T) {
 	assert.Equal(t, uint8(2), blockIndexAddresses["to1"])
 }
 
+func TestProcessBlockExtras(t *testing.T) {
+	idx := NewTestIndexer()
+	txHash := "0x0000000000000000000000000000000000000000000000000000000000000001"
+	tx2Hash := "0x0000000000000000000000000000000000000000000000000000000000000002"
+	extra := &types.TransactionExtra{Data: []byte{1, 2}, Gas: 21000}
+	block := &types.BLockDetail{
+		BlockNumber: big.NewInt(1),
+		Time:        big.NewInt(1546300800),
+		Transactions: []types.TransactionDetail{
+			{From: "0x0000000000000000000000000000000000000001", To: "0x0000000000000000000000000000000000000002", TxHash: txHash, Value: big.NewInt(1), Extra: extra},
+			{From: "0x0000000000000000000000000000000000000001", To: "0x0000000000000000000000000000000000000002", TxHash: tx2Hash, Value: big.NewInt(1)},
+		},
+	}
+	assert.Equal(t, map[string]*types.TransactionExtra{txHash: extra}, CreateExtraData(block))
+	assert.Nil(t, idx.ProcessBlock(block, false))
+	assert.Equal(t, extra, idx.IndexRepo.GetTransactionExtra(txHash))
+	// extras of transactions indexed without them are not kept
+	assert.Nil(t, idx.IndexRepo.GetTransactionExtra(tx2Hash))
+	assert.Equal(t, 2, idx.IndexRepo.GetTotalTransaction("0x0000000000000000000000000000000000000002", time.Time{}, time.Time{}))
+}
+
 func TestGetInitBatches(t *testing.T) {
 	genesisBlock := big.NewInt(0)
 	latestBlock := big.NewInt(10)
-	numBatch := 3
-	batches := GetInitBatches(numBatch, genesisBlock, latestBlock)
+	chunkSize := int64(4)
+	batches := GetInitBatches(chunkSize, genesisBlock, latestBlock)
 	assert.Equal(t, 3, len(batches))
 	assert.Equal(t, big.NewInt(0), batches[0].From)
-	assert.Equal(t, big.NewInt(1), batches[1].From)
-	assert.Equal(t, big.NewInt(2), batches[2].From)
-	assert.Equal(t, byte(3), batches[0].Step)
-	assert.Equal(t, byte(3), batches[1].Step)
-	assert.Equal(t, byte(3), batches[2].Step)
+	assert.Equal(t, big.NewInt(3), batches[0].To)
+	assert.Equal(t, big.NewInt(4), batches[1].From)
+	assert.Equal(t, big.NewInt(7), batches[1].To)
+	assert.Equal(t, big.NewInt(8), batches[2].From)
+	assert.Equal(t, big.NewInt(10), batches[2].To)
+	for _, batch := range batches {
+		assert.Equal(t, byte(1), batch.Step)
+	}
 }
 
 func TestGetBatches(t *testing.T) {
@@ -175,15 +198,9 @@ func TestWatchAfterBatch(t *testing.T) {
 	// TODO
 }
 
-func NewTestIndexer() Indexer {
-	addressDB := memdb.New(comparer.DefaultComparer, 0)
-	addressDAO := dao.NewMemDbDAO(addressDB)
-	blockDB := memdb.New(comparer.DefaultComparer, 0)
-	blockDAO := dao.NewMemDbDAO(blockDB)
-	batchDB := memdb.New(comparer.DefaultComparer, 0)
-	batchDAO := dao.NewMemDbDAO(batchDB)
-	indexRepo := keyvalue.NewKVIndexRepo(addressDAO, blockDAO)
-	batchRepo := keyvalue.NewKVBatchRepo(batchDAO)
+func NewTestIndexer() *Indexer {
+	db := memdb.New(comparer.DefaultComparer, 0)
+	indexRepo, batchRepo := keyvalue.NewMemDbRepos(db)
 	idx := NewIndexer(indexRepo, batchRepo, nil)
 	return idx
 }
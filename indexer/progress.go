@@ -0,0 +1,118 @@
+package indexer
+
+import (
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/WeTrustPlatform/account-indexer/core/types"
+	"github.com/WeTrustPlatform/account-indexer/repository"
+)
+
+// ProgressWindows sliding windows to compute processing speed
+var ProgressWindows = []time.Duration{1 * time.Minute, 5 * time.Minute, 15 * time.Minute}
+
+// Progress tracks processed blocks per second for the last 15 minutes
+type Progress struct {
+	batchRepo repository.BatchRepo
+	mutex     sync.Mutex
+	// buckets[i] number of blocks processed in second seconds[i]
+	buckets   []int64
+	seconds   []int64
+	startedAt time.Time
+	now       func() time.Time
+}
+
+// NewProgress create a Progress instance
+func NewProgress(batchRepo repository.BatchRepo) *Progress {
+	maxWindow := ProgressWindows[len(ProgressWindows)-1]
+	size := int(maxWindow / time.Second)
+	return &Progress{
+		batchRepo: batchRepo,
+		buckets:   make([]int64, size),
+		seconds:   make([]int64, size),
+		startedAt: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// BlockDone to be called after a block is processed
+func (p *Progress) BlockDone(blockNumber *big.Int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	second := p.now().Unix()
+	i := int(second % int64(len(p.buckets)))
+	if p.seconds[i] != second {
+		p.seconds[i] = second
+		p.buckets[i] = 0
+	}
+	p.buckets[i]++
+}
+
+// Speed number of processed blocks per second in the last window
+func (p *Progress) Speed(window time.Duration) float64 {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	now := p.now()
+	// don't count the time before we start
+	if elapsed := now.Sub(p.startedAt); elapsed < window {
+		window = elapsed
+	}
+	if window < time.Second {
+		window = time.Second
+	}
+	from := now.Add(-window).Unix()
+	total := int64(0)
+	for i, second := range p.seconds {
+		if second > from && second <= now.Unix() {
+			total += p.buckets[i]
+		}
+	}
+	return float64(total) / window.Seconds()
+}
+
+// Report compute progress of all batches and speed
+func (p *Progress) Report() types.ProgressReport {
+	report := types.ProgressReport{BlocksPerSecond: map[time.Duration]float64{}}
+	for _, batch := range p.batchRepo.GetAllBatchStatuses() {
+		total, done := countBlocks(batch)
+		report.TotalBlocks += total
+		report.DoneBlocks += done
+	}
+	if report.TotalBlocks > 0 {
+		report.Percent = 100 * float64(report.DoneBlocks) / float64(report.TotalBlocks)
+	}
+	for _, window := range ProgressWindows {
+		report.BlocksPerSecond[window] = p.Speed(window)
+	}
+	// 5 minutes window is stable enough, fallback to 1 minute when we just start
+	speed := report.BlocksPerSecond[ProgressWindows[1]]
+	if speed == 0 {
+		speed = report.BlocksPerSecond[ProgressWindows[0]]
+	}
+	if speed > 0 {
+		remaining := float64(report.TotalBlocks - report.DoneBlocks)
+		report.ETA = time.Duration(remaining/speed) * time.Second
+	}
+	return report
+}
+
+// countBlocks number of blocks and processed blocks of a batch
+func countBlocks(batch types.BatchStatus) (int64, int64) {
+	if batch.From == nil || batch.To == nil || batch.Step == 0 {
+		return 0, 0
+	}
+	step := int64(batch.Step)
+	total := (batch.To.Int64()-batch.From.Int64())/step + 1
+	if total < 0 {
+		total = 0
+	}
+	if batch.Current == nil {
+		return total, 0
+	}
+	done := (batch.Current.Int64()-batch.From.Int64())/step + 1
+	if done > total {
+		done = total
+	}
+	return total, done
+}
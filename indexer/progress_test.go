@@ -0,0 +1,62 @@
+package indexer
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/WeTrustPlatform/account-indexer/core/types"
+)
+
+func TestCountBlocks(t *testing.T) {
+	batch := types.BatchStatus{From: big.NewInt(10), To: big.NewInt(19), Step: 1}
+	total, done := countBlocks(batch)
+	assert.Equal(t, int64(10), total)
+	assert.Equal(t, int64(0), done)
+	batch.Current = big.NewInt(14)
+	total, done = countBlocks(batch)
+	assert.Equal(t, int64(10), total)
+	assert.Equal(t, int64(5), done)
+	// striped batch from an old version
+	batch = types.BatchStatus{From: big.NewInt(1), To: big.NewInt(100), Step: 10, Current: big.NewInt(21)}
+	total, done = countBlocks(batch)
+	assert.Equal(t, int64(10), total)
+	assert.Equal(t, int64(3), done)
+}
+
+func TestProgressReport(t *testing.T) {
+	batchRepo := newTestBatchRepo()
+	now := time.Now()
+	progress := NewProgress(batchRepo)
+	progress.startedAt = now.Add(-10 * time.Minute)
+	progress.now = func() time.Time { return now }
+	for _, batch := range GetInitBatches(100, big.NewInt(0), big.NewInt(399)) {
+		batch.UpdatedAt = big.NewInt(now.Unix())
+		if batch.From.Int64() == 0 {
+			batch.Current = big.NewInt(99)
+		}
+		assert.Nil(t, batchRepo.UpdateBatch(batch))
+	}
+	// 60 blocks in the last minute, 240 blocks 3 minutes ago
+	for i := 0; i < 60; i++ {
+		progress.BlockDone(big.NewInt(int64(i)))
+	}
+	progress.now = func() time.Time { return now.Add(-3 * time.Minute) }
+	for i := 0; i < 240; i++ {
+		progress.BlockDone(big.NewInt(int64(i)))
+	}
+	progress.now = func() time.Time { return now }
+
+	report := progress.Report()
+	assert.Equal(t, int64(400), report.TotalBlocks)
+	assert.Equal(t, int64(100), report.DoneBlocks)
+	assert.Equal(t, float64(25), report.Percent)
+	assert.Equal(t, float64(1), report.BlocksPerSecond[time.Minute])
+	assert.Equal(t, float64(1), report.BlocksPerSecond[5*time.Minute])
+	// 300 blocks remaining at 1 block per second
+	assert.Equal(t, 300*time.Second, report.ETA)
+	// the indexer is only started 10 minutes ago
+	assert.Equal(t, float64(300)/600, report.BlocksPerSecond[15*time.Minute])
+}
@@ -0,0 +1,449 @@
+package indexer
+
+import (
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/WeTrustPlatform/account-indexer/core/types"
+	"github.com/WeTrustPlatform/account-indexer/repository"
+	log "github.com/sirupsen/logrus"
+)
+
+// RangeHandler fetches and stores blocks from "from" to "to" (inclusive) in order for a scheduler worker.
+// done should be called with the uncommitted writes of each block, the scheduler adds the batch progress
+// and commits them in one atomic write. wb can be nil if the block is already stored.
+type RangeHandler func(from *big.Int, to *big.Int, done func(blockNumber *big.Int, wb repository.WriteBatch)) error
+
+// HandlerFactory creates a RangeHandler for a new worker, each worker has its own connection
+type HandlerFactory func() (RangeHandler, error)
+
+// Scheduler distributes the remaining block ranges of all batches to a pool of workers.
+// Ranges are split into chunks, a worker takes the next chunk from the queue and once the
+// queue is empty it steals the second half of the biggest range another worker is processing.
+// Every chunk is a batch with Step 1 so its key does not depend on the number of workers.
+// A worker claims a segment of a chunk at a time so that it can fetch blocks ahead.
+// mutex only guards the chunks in memory, batch statuses are written with the save mutex of their chunk.
+type Scheduler struct {
+	batchRepo   repository.BatchRepo
+	chunkSize   int64
+	segmentSize int64
+	runMutex    sync.Mutex
+	mutex       sync.Mutex
+	numWorker   int
+	active      int
+	pending     []*chunk
+	running     []*chunk
+	newHandler  HandlerFactory
+	stop        <-chan struct{}
+	wg          sync.WaitGroup
+	// OnBlockDone is called after a block is processed and its batch is saved
+	OnBlockDone func(blockNumber *big.Int)
+}
+
+// chunk a batch owned by the scheduler
+type chunk struct {
+	batch types.BatchStatus
+	// inFlight is the last block of the segment being processed by a worker, nil if none
+	inFlight *big.Int
+	// unsaved while a steal that changed the chunk is not written, it can't be stolen from then
+	unsaved bool
+	// saveMutex orders the writes of the batch status, it's taken before the scheduler mutex
+	saveMutex sync.Mutex
+	// savedTo the "To" of the batch status in the database, guarded by saveMutex
+	savedTo *big.Int
+}
+
+func newChunk(batch types.BatchStatus) *chunk {
+	return &chunk{batch: batch, savedTo: batch.To}
+}
+
+// NewScheduler create a Scheduler with numWorker workers, chunks of chunkSize blocks
+// and workers claim segmentSize blocks at a time
+func NewScheduler(batchRepo repository.BatchRepo, numWorker int, chunkSize int64, segmentSize int64) *Scheduler {
+	if numWorker < 1 {
+		numWorker = 1
+	}
+	if chunkSize < 1 {
+		chunkSize = 1
+	}
+	if segmentSize < 1 {
+		segmentSize = 1
+	}
+	return &Scheduler{batchRepo: batchRepo, numWorker: numWorker, chunkSize: chunkSize, segmentSize: segmentSize}
+}
+
+// Run process all batches until they are done, stop is closed or all workers are gone.
+// If a previous Run is still stopping, it waits for all of its workers to exit first.
+func (s *Scheduler) Run(batches []types.BatchStatus, newHandler HandlerFactory, stop <-chan struct{}) {
+	s.runMutex.Lock()
+	defer s.runMutex.Unlock()
+	s.mutex.Lock()
+	s.pending = []*chunk{}
+	s.running = []*chunk{}
+	for _, batch := range batches {
+		if batch.IsDone() {
+			continue
+		}
+		for _, bt := range s.split(batch) {
+			s.pending = append(s.pending, newChunk(bt))
+		}
+	}
+	s.newHandler = newHandler
+	s.stop = stop
+	log.WithFields(log.Fields{
+		"numChunk":  len(s.pending),
+		"numWorker": s.numWorker,
+	}).Info("Scheduler: starting workers")
+	s.spawn(s.numWorker)
+	s.mutex.Unlock()
+	s.wg.Wait()
+	s.mutex.Lock()
+	s.newHandler = nil
+	s.mutex.Unlock()
+}
+
+// Add queue batches to the running workers, it returns false if no worker is running
+// and the batches should be processed by Run
+func (s *Scheduler) Add(batches []types.BatchStatus) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	// a running worker takes the new chunks before it exits
+	if s.newHandler == nil || s.active == 0 {
+		return false
+	}
+	numChunk := 0
+	for _, batch := range batches {
+		if batch.IsDone() {
+			continue
+		}
+		for _, bt := range s.split(batch) {
+			s.pending = append(s.pending, newChunk(bt))
+			numChunk++
+		}
+	}
+	log.WithField("numChunk", numChunk).Info("Scheduler: added chunks")
+	if s.active < s.numWorker {
+		s.spawn(s.numWorker - s.active)
+	}
+	return true
+}
+
+// SetWorkers change the number of workers, it takes effect immediately if the scheduler is running
+func (s *Scheduler) SetWorkers(numWorker int) error {
+	if numWorker < 1 {
+		return errors.New("number of workers should be at least 1")
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.numWorker = numWorker
+	if s.newHandler != nil && s.active < numWorker {
+		s.spawn(numWorker - s.active)
+	}
+	log.WithField("numWorker", numWorker).Info("Scheduler: updated number of workers")
+	return nil
+}
+
+// NumWorker the target number of workers
+func (s *Scheduler) NumWorker() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.numWorker
+}
+
+// ActiveWorker the number of running workers
+func (s *Scheduler) ActiveWorker() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.active
+}
+
+// split a batch with Step 1 into chunks and save them so that no chunk is lost on restart,
+// mutex should be held
+func (s *Scheduler) split(batch types.BatchStatus) []types.BatchStatus {
+	next := nextBlock(batch)
+	// striped batch from an old version, let a single worker finish it
+	if batch.Step != 1 || batch.To.Int64()-next.Int64()+1 <= s.chunkSize {
+		s.save(nil, batch)
+		return []types.BatchStatus{batch}
+	}
+	now := big.NewInt(time.Now().Unix())
+	result := []types.BatchStatus{}
+	first := batch
+	first.To = big.NewInt(next.Int64() + s.chunkSize - 1)
+	s.save(batch.To, first)
+	result = append(result, first)
+	for from := first.To.Int64() + 1; from <= batch.To.Int64(); from += s.chunkSize {
+		to := from + s.chunkSize - 1
+		if to > batch.To.Int64() {
+			to = batch.To.Int64()
+		}
+		bt := types.BatchStatus{
+			From:      big.NewInt(from),
+			To:        big.NewInt(to),
+			Step:      1,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		s.save(nil, bt)
+		result = append(result, bt)
+	}
+	return result
+}
+
+// spawn n workers, mutex should be held
+func (s *Scheduler) spawn(n int) {
+	for i := 0; i < n; i++ {
+		s.active++
+		s.wg.Add(1)
+		go s.work()
+	}
+}
+
+func (s *Scheduler) work() {
+	defer s.wg.Done()
+	handler, err := s.newHandler()
+	if err != nil {
+		log.WithField("error", err.Error()).Error("Scheduler: worker cannot connect to IPC server")
+		s.retire(nil)
+		return
+	}
+	var c *chunk
+	for {
+		var from, to *big.Int
+		c, from, to = s.claim(c)
+		if from == nil {
+			return
+		}
+		done := func(blockNumber *big.Int, wb repository.WriteBatch) {
+			s.complete(c, blockNumber, wb)
+		}
+		err := handler(from, to, done)
+		if err != nil {
+			// Finish the go-routines, someone will restart index()
+			log.WithFields(log.Fields{
+				"from":  from.String(),
+				"to":    to.String(),
+				"error": err.Error(),
+			}).Error("Scheduler: cannot process blocks")
+			s.retire(c)
+			return
+		}
+		select {
+		case <-s.stop:
+			log.Info("Scheduler: worker is stopped")
+			s.retire(c)
+			return
+		default:
+		}
+	}
+}
+
+// claim return the next segment to process, it moves to another chunk when the current one is done.
+// It returns nil when the worker should exit. A stolen chunk is saved before it's processed.
+func (s *Scheduler) claim(c *chunk) (*chunk, *big.Int, *big.Int) {
+	c, victim, from, to := s.next(c)
+	if victim != nil {
+		s.saveSteal(victim, c)
+	}
+	return c, from, to
+}
+
+// next the chunk and segment of claim, victim is the chunk c is stolen from if it's stolen
+func (s *Scheduler) next(c *chunk) (*chunk, *chunk, *big.Int, *big.Int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.active > s.numWorker {
+		s.release(c)
+		s.active--
+		return nil, nil, nil, nil
+	}
+	if c != nil {
+		if !c.batch.IsDone() {
+			from, to := s.segment(c)
+			return c, nil, from, to
+		}
+		s.remove(c)
+		log.WithField("batch", c.batch.String()).Info("Scheduler: chunk is done")
+	}
+	c, victim := s.take()
+	if c == nil {
+		s.active--
+		return nil, nil, nil, nil
+	}
+	from, to := s.segment(c)
+	return c, victim, from, to
+}
+
+// segment mark the next segment of a chunk as in flight, mutex should be held
+func (s *Scheduler) segment(c *chunk) (*big.Int, *big.Int) {
+	from := nextBlock(c.batch)
+	to := new(big.Int).Set(from)
+	// striped batch from an old version is processed block by block
+	if c.batch.Step == 1 {
+		to.SetInt64(from.Int64() + s.segmentSize - 1)
+		if to.Cmp(c.batch.To) > 0 {
+			to.Set(c.batch.To)
+		}
+	}
+	c.inFlight = to
+	return from, to
+}
+
+// take a pending chunk or steal from a running one, victim is the chunk it's stolen from.
+// The steal is only in memory, it should be written with saveSteal. mutex should be held
+func (s *Scheduler) take() (*chunk, *chunk) {
+	if len(s.pending) > 0 {
+		c := s.pending[0]
+		s.pending = s.pending[1:]
+		s.running = append(s.running, c)
+		return c, nil
+	}
+	var victim *chunk
+	var maxRemaining int64
+	for _, c := range s.running {
+		if c.batch.Step != 1 || c.inFlight == nil || c.unsaved {
+			continue
+		}
+		remaining := c.batch.To.Int64() - c.inFlight.Int64()
+		if remaining > maxRemaining {
+			victim = c
+			maxRemaining = remaining
+		}
+	}
+	// both of them should have at least 1 block
+	if victim == nil || maxRemaining < 2 {
+		return nil, nil
+	}
+	mid := victim.inFlight.Int64() + maxRemaining/2
+	now := big.NewInt(time.Now().Unix())
+	stolen := &chunk{batch: types.BatchStatus{
+		From:      big.NewInt(mid + 1),
+		To:        victim.batch.To,
+		Step:      1,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}, unsaved: true}
+	victim.batch.To = big.NewInt(mid)
+	victim.unsaved = true
+	s.running = append(s.running, stolen)
+	log.WithFields(log.Fields{
+		"victim": victim.batch.String(),
+		"stolen": stolen.batch.String(),
+	}).Info("Scheduler: stole work")
+	return stolen, victim
+}
+
+// saveSteal write the new "To" of victim and the stolen chunk in one write, so that no block is lost on restart.
+// Until then the victim keeps saving its progress with its old "To"
+func (s *Scheduler) saveSteal(victim *chunk, stolen *chunk) {
+	victim.saveMutex.Lock()
+	defer victim.saveMutex.Unlock()
+	s.mutex.Lock()
+	victimBatch := victim.batch
+	stolenBatch := stolen.batch
+	s.mutex.Unlock()
+	wb := s.batchRepo.NewWriteBatch()
+	s.saveIn(wb, victim.savedTo, victimBatch)
+	s.saveIn(wb, nil, stolenBatch)
+	s.commit(wb, stolenBatch)
+	victim.savedTo = victimBatch.To
+	stolen.savedTo = stolenBatch.To
+	s.mutex.Lock()
+	victim.unsaved = false
+	stolen.unsaved = false
+	s.mutex.Unlock()
+}
+
+// complete mark a block as done and commit the batch status with the writes of the block,
+// the write is ordered by the save mutex of the chunk so that workers don't wait for each other
+func (s *Scheduler) complete(c *chunk, blockNumber *big.Int, wb repository.WriteBatch) {
+	if wb == nil {
+		wb = s.batchRepo.NewWriteBatch()
+	}
+	c.saveMutex.Lock()
+	s.mutex.Lock()
+	c.batch.Current = blockNumber
+	c.batch.UpdatedAt = big.NewInt(time.Now().Unix())
+	batch := c.batch
+	onBlockDone := s.OnBlockDone
+	s.mutex.Unlock()
+	// the record of the chunk, a new "To" of a steal is only written by saveSteal
+	batch.To = c.savedTo
+	s.saveIn(wb, nil, batch)
+	s.commit(wb, batch)
+	c.saveMutex.Unlock()
+	if onBlockDone != nil {
+		onBlockDone(blockNumber)
+	}
+}
+
+// retire a worker and give its chunk back to the queue
+func (s *Scheduler) retire(c *chunk) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.release(c)
+	s.active--
+}
+
+// release put a chunk back to the queue, mutex should be held
+func (s *Scheduler) release(c *chunk) {
+	if c == nil {
+		return
+	}
+	c.inFlight = nil
+	s.remove(c)
+	if !c.batch.IsDone() {
+		s.pending = append([]*chunk{c}, s.pending...)
+	}
+}
+
+// remove a chunk from running list, mutex should be held
+func (s *Scheduler) remove(c *chunk) {
+	for i, item := range s.running {
+		if item == c {
+			s.running = append(s.running[:i], s.running[i+1:]...)
+			return
+		}
+	}
+}
+
+// save a batch status, oldTo is the "To" that the batch was saved with if it's changed
+func (s *Scheduler) save(oldTo *big.Int, batch types.BatchStatus) {
+	wb := s.batchRepo.NewWriteBatch()
+	s.saveIn(wb, oldTo, batch)
+	s.commit(wb, batch)
+}
+
+// saveIn add a batch status to wb, oldTo is the "To" that the batch was saved with if it's changed
+func (s *Scheduler) saveIn(wb repository.WriteBatch, oldTo *big.Int, batch types.BatchStatus) {
+	if batch.UpdatedAt == nil {
+		batch.UpdatedAt = big.NewInt(time.Now().Unix())
+	}
+	var err error
+	if oldTo != nil && oldTo.Cmp(batch.To) != 0 {
+		err = s.batchRepo.ReplaceBatchIn(wb, batch.From, batch.To)
+	}
+	if err == nil {
+		err = s.batchRepo.UpdateBatchIn(wb, batch)
+	}
+	if err != nil {
+		panic(errors.New("Scheduler: cannot save batch " + batch.String() + ", error is " + err.Error()))
+	}
+}
+
+// commit wb, a block or batch that cannot be saved is fatal
+func (s *Scheduler) commit(wb repository.WriteBatch, batch types.BatchStatus) {
+	if err := wb.Commit(); err != nil {
+		panic(errors.New("Scheduler: cannot save batch " + batch.String() + ", error is " + err.Error()))
+	}
+}
+
+// nextBlock the next block to process of a batch
+func nextBlock(batch types.BatchStatus) *big.Int {
+	if batch.Current == nil {
+		return new(big.Int).Set(batch.From)
+	}
+	return big.NewInt(batch.Current.Int64() + int64(batch.Step))
+}
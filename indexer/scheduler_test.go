@@ -0,0 +1,242 @@
+package indexer
+
+import (
+	"errors"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/syndtr/goleveldb/leveldb/comparer"
+	"github.com/syndtr/goleveldb/leveldb/memdb"
+
+	"github.com/WeTrustPlatform/account-indexer/core/types"
+	"github.com/WeTrustPlatform/account-indexer/repository"
+	"github.com/WeTrustPlatform/account-indexer/repository/keyvalue"
+	"github.com/WeTrustPlatform/account-indexer/repository/keyvalue/dao"
+)
+
+type blockRecorder struct {
+	mutex  sync.Mutex
+	blocks map[int64]int
+	delay  func(blockNumber int64) time.Duration
+}
+
+func newBlockRecorder() *blockRecorder {
+	return &blockRecorder{blocks: map[int64]int{}}
+}
+
+func (br *blockRecorder) factory() (RangeHandler, error) {
+	return func(from *big.Int, to *big.Int, done func(blockNumber *big.Int, wb repository.WriteBatch)) error {
+		for i := from.Int64(); i <= to.Int64(); i++ {
+			if br.delay != nil {
+				time.Sleep(br.delay(i))
+			}
+			br.mutex.Lock()
+			br.blocks[i]++
+			br.mutex.Unlock()
+			done(big.NewInt(i), nil)
+		}
+		return nil
+	}, nil
+}
+
+// blockHandler adapt a function that handles a single block to RangeHandler
+func blockHandler(handle func(blockNumber *big.Int) error) RangeHandler {
+	return func(from *big.Int, to *big.Int, done func(blockNumber *big.Int, wb repository.WriteBatch)) error {
+		for i := from.Int64(); i <= to.Int64(); i++ {
+			blockNumber := big.NewInt(i)
+			if err := handle(blockNumber); err != nil {
+				return err
+			}
+			done(blockNumber, nil)
+		}
+		return nil
+	}
+}
+
+func newTestBatchRepo() *keyvalue.KVBatchRepo {
+	batchDB := memdb.New(comparer.DefaultComparer, 0)
+	return keyvalue.NewKVBatchRepo(dao.NewMemDbDAO(batchDB))
+}
+
+func assertAllDone(t *testing.T, batches []types.BatchStatus) {
+	for _, batch := range batches {
+		assert.True(t, batch.IsDone(), "batch should be done: "+batch.String())
+	}
+}
+
+func TestSchedulerRun(t *testing.T) {
+	batchRepo := newTestBatchRepo()
+	scheduler := NewScheduler(batchRepo, 3, 10, 4)
+	recorder := newBlockRecorder()
+	batches := GetInitBatches(25, big.NewInt(0), big.NewInt(99))
+	scheduler.Run(batches, recorder.factory, make(chan struct{}))
+	assert.Equal(t, 100, len(recorder.blocks))
+	for i := int64(0); i < 100; i++ {
+		assert.Equal(t, 1, recorder.blocks[i], "block should be processed once")
+	}
+	savedBatches := batchRepo.GetAllBatchStatuses()
+	// 25-block batches are split into chunks of 10 blocks
+	assert.True(t, len(savedBatches) >= 12)
+	assertAllDone(t, savedBatches)
+	assert.Equal(t, 0, scheduler.ActiveWorker())
+}
+
+func TestSchedulerSteal(t *testing.T) {
+	batchRepo := newTestBatchRepo()
+	scheduler := NewScheduler(batchRepo, 4, 1000, 4)
+	recorder := newBlockRecorder()
+	recorder.delay = func(blockNumber int64) time.Duration {
+		return time.Millisecond
+	}
+	// a single batch, other workers have to steal from the first one
+	batches := GetInitBatches(1000, big.NewInt(0), big.NewInt(199))
+	scheduler.Run(batches, recorder.factory, make(chan struct{}))
+	assert.Equal(t, 200, len(recorder.blocks))
+	for i := int64(0); i < 200; i++ {
+		assert.Equal(t, 1, recorder.blocks[i], "block should be processed once")
+	}
+	savedBatches := batchRepo.GetAllBatchStatuses()
+	assert.True(t, len(savedBatches) > 1, "Should steal work")
+	assertAllDone(t, savedBatches)
+}
+
+func TestSchedulerResume(t *testing.T) {
+	batchRepo := newTestBatchRepo()
+	scheduler := NewScheduler(batchRepo, 2, 10, 1)
+	stop := make(chan struct{})
+	stopOnce := sync.Once{}
+	count := 0
+	mutex := sync.Mutex{}
+	factory := func() (RangeHandler, error) {
+		return blockHandler(func(blockNumber *big.Int) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			count++
+			if count >= 15 {
+				stopOnce.Do(func() { close(stop) })
+			}
+			return nil
+		}), nil
+	}
+	scheduler.Run(GetInitBatches(50, big.NewInt(0), big.NewInt(49)), factory, stop)
+	savedBatches := batchRepo.GetAllBatchStatuses()
+	assert.Equal(t, 5, len(savedBatches))
+
+	// restart with a different number of workers
+	recorder := newBlockRecorder()
+	scheduler = NewScheduler(batchRepo, 5, 10, 3)
+	scheduler.Run(savedBatches, recorder.factory, make(chan struct{}))
+	assert.True(t, len(recorder.blocks) <= 50-15+2, "Should not process done blocks again")
+	assertAllDone(t, batchRepo.GetAllBatchStatuses())
+}
+
+func TestSchedulerSetWorkers(t *testing.T) {
+	scheduler := NewScheduler(newTestBatchRepo(), 1, 10, 2)
+	assert.NotNil(t, scheduler.SetWorkers(0))
+	started := make(chan struct{})
+	startOnce := sync.Once{}
+	recorder := newBlockRecorder()
+	recorder.delay = func(blockNumber int64) time.Duration {
+		startOnce.Do(func() { close(started) })
+		return time.Millisecond
+	}
+	done := make(chan struct{})
+	go func() {
+		scheduler.Run(GetInitBatches(10, big.NewInt(0), big.NewInt(99)), recorder.factory, make(chan struct{}))
+		close(done)
+	}()
+	<-started
+	assert.Nil(t, scheduler.SetWorkers(4))
+	assert.Equal(t, 4, scheduler.NumWorker())
+	<-done
+	assert.Equal(t, 100, len(recorder.blocks))
+}
+
+func TestSchedulerHandlerError(t *testing.T) {
+	batchRepo := newTestBatchRepo()
+	scheduler := NewScheduler(batchRepo, 2, 10, 1)
+	factory := func() (RangeHandler, error) {
+		return blockHandler(func(blockNumber *big.Int) error {
+			if blockNumber.Int64() >= 5 {
+				return errors.New("cannot get block")
+			}
+			return nil
+		}), nil
+	}
+	scheduler.Run(GetInitBatches(10, big.NewInt(0), big.NewInt(19)), factory, make(chan struct{}))
+	assert.Equal(t, 0, scheduler.ActiveWorker())
+	savedBatches := batchRepo.GetAllBatchStatuses()
+	assert.Equal(t, 2, len(savedBatches))
+	assert.Equal(t, int64(4), savedBatches[0].Current.Int64())
+	assert.Nil(t, savedBatches[1].Current)
+}
+
+func TestSchedulerAdd(t *testing.T) {
+	batchRepo := newTestBatchRepo()
+	scheduler := NewScheduler(batchRepo, 2, 10, 4)
+	recorder := newBlockRecorder()
+	added := []types.BatchStatus{}
+	recorder.delay = func(blockNumber int64) time.Duration {
+		if blockNumber == 5 {
+			added = GetInitBatches(10, big.NewInt(100), big.NewInt(119))
+			assert.True(t, scheduler.Add(added))
+		}
+		return 0
+	}
+	scheduler.Run(GetInitBatches(10, big.NewInt(0), big.NewInt(19)), recorder.factory, make(chan struct{}))
+	assert.Equal(t, 40, len(recorder.blocks))
+	assert.Equal(t, 1, recorder.blocks[119])
+	assertAllDone(t, batchRepo.GetAllBatchStatuses())
+	// the scheduler is not running anymore
+	assert.False(t, scheduler.Add(added))
+}
+
+func TestSchedulerSlowCommit(t *testing.T) {
+	batchRepo := newTestBatchRepo()
+	scheduler := NewScheduler(batchRepo, 2, 10, 1)
+	blocked := make(chan struct{})
+	unblock := make(chan struct{})
+	otherDone := make(chan struct{})
+	numDone := int64(0)
+	scheduler.OnBlockDone = func(blockNumber *big.Int) {
+		if blockNumber.Int64() >= 10 && atomic.AddInt64(&numDone, 1) == 10 {
+			close(otherDone)
+		}
+	}
+	factory := func() (RangeHandler, error) {
+		return func(from *big.Int, to *big.Int, done func(blockNumber *big.Int, wb repository.WriteBatch)) error {
+			for i := from.Int64(); i <= to.Int64(); i++ {
+				wb := batchRepo.NewWriteBatch()
+				if i == 0 {
+					// the write of block 0 hangs until the other chunk is done
+					wb.(*dao.Batch).OnCommit(func() func() {
+						close(blocked)
+						<-unblock
+						return func() {}
+					})
+				}
+				done(big.NewInt(i), wb)
+			}
+			return nil
+		}, nil
+	}
+	finished := make(chan struct{})
+	go func() {
+		scheduler.Run(GetInitBatches(10, big.NewInt(0), big.NewInt(19)), factory, make(chan struct{}))
+		close(finished)
+	}()
+	<-blocked
+	select {
+	case <-otherDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a slow write should not block other workers")
+	}
+	assert.Equal(t, 2, scheduler.NumWorker())
+	close(unblock)
+	<-finished
+	assertAllDone(t, batchRepo.GetAllBatchStatuses())
+}
@@ -0,0 +1,260 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WeTrustPlatform/account-indexer/core/types"
+	"github.com/WeTrustPlatform/account-indexer/fetcher"
+	log "github.com/sirupsen/logrus"
+)
+
+// MaxVerifyIssues number of issues kept in a verify report, all of them are counted and logged
+const MaxVerifyIssues = 1000
+
+// ErrVerifyRunning a verification is already running
+var ErrVerifyRunning = errors.New("verification is running")
+
+// FetchRangeFunc fetch blocks from to to (inclusive) and send them to ch, ch is closed when it returns
+type FetchRangeFunc func(ctx context.Context, from *big.Int, to *big.Int, ch chan<- *types.BLockDetail) error
+
+// Verifier refetch blocks from the chain and compare their index data with the address database,
+// only one verification runs at a time
+type Verifier struct {
+	indexer    *Indexer
+	fetchRange FetchRangeFunc
+	mutex      sync.Mutex
+	report     types.VerifyReport
+}
+
+// NewVerifier create a Verifier fetching blocks from the current ipc of the chain of idx
+func NewVerifier(idx *Indexer) *Verifier {
+	fetchRange := func(ctx context.Context, from *big.Int, to *big.Int, ch chan<- *types.BLockDetail) error {
+		fetcher, err := fetcher.NewChainFetchOf(idx.IpcManager)
+		if err != nil {
+			close(ch)
+			return err
+		}
+		defer fetcher.Close()
+		return fetcher.FetchRange(ctx, from, to, ch)
+	}
+	return &Verifier{indexer: idx, fetchRange: fetchRange}
+}
+
+// Report the report of the running or last verification
+func (v *Verifier) Report() types.VerifyReport {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	report := v.report
+	report.Issues = append([]types.VerifyIssue{}, v.report.Issues...)
+	return report
+}
+
+// Start verify blocks from to to (inclusive) in the background, records that differ are repaired if repair is true.
+// jobs is done when the verification finishes
+func (v *Verifier) Start(ctx context.Context, jobs *sync.WaitGroup, from *big.Int, to *big.Int, repair bool) error {
+	if err := v.begin(from, to, repair); err != nil {
+		return err
+	}
+	jobs.Add(1)
+	go func() {
+		defer jobs.Done()
+		v.run(ctx, from, to, repair)
+	}()
+	return nil
+}
+
+// Run verify blocks from to to (inclusive) and return the report, records that differ are repaired if repair is true
+func (v *Verifier) Run(ctx context.Context, from *big.Int, to *big.Int, repair bool) (types.VerifyReport, error) {
+	if err := v.begin(from, to, repair); err != nil {
+		return types.VerifyReport{}, err
+	}
+	err := v.run(ctx, from, to, repair)
+	return v.Report(), err
+}
+
+func (v *Verifier) begin(from *big.Int, to *big.Int, repair bool) error {
+	if from.Sign() < 0 || from.Cmp(to) > 0 {
+		return errors.New("invalid block range " + from.String() + " - " + to.String())
+	}
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if v.report.Running {
+		return ErrVerifyRunning
+	}
+	v.report = types.VerifyReport{
+		Running:   true,
+		From:      from.Int64(),
+		To:        to.Int64(),
+		Repair:    repair,
+		Current:   from.Int64() - 1,
+		Issues:    []types.VerifyIssue{},
+		StartedAt: time.Now().UTC(),
+	}
+	return nil
+}
+
+func (v *Verifier) run(ctx context.Context, from *big.Int, to *big.Int, repair bool) error {
+	log.WithFields(log.Fields{
+		"from":   from.String(),
+		"to":     to.String(),
+		"repair": repair,
+	}).Info("Verifier: Started")
+	// stop fetching after an error
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ch := make(chan *types.BLockDetail)
+	fetchErr := make(chan error, 1)
+	go func() {
+		fetchErr <- v.fetchRange(ctx, from, to, ch)
+	}()
+	var err error
+	for blockDetail := range ch {
+		if err == nil {
+			if err = v.verifyBlock(blockDetail, repair); err != nil {
+				cancel()
+			}
+		}
+	}
+	if fetchErr := <-fetchErr; err == nil {
+		err = fetchErr
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.report.Running = false
+	v.report.FinishedAt = time.Now().UTC()
+	fields := log.Fields{
+		"from":       from.String(),
+		"to":         to.String(),
+		"current":    v.report.Current,
+		"missing":    v.report.Missing,
+		"extra":      v.report.Extra,
+		"mismatched": v.report.Mismatched,
+		"repaired":   v.report.Repaired,
+	}
+	if err != nil {
+		v.report.Error = err.Error()
+		fields["error"] = err.Error()
+		log.WithFields(fields).Error("Verifier: Stopped with error")
+		return err
+	}
+	log.WithFields(fields).Info("Verifier: Finished")
+	return nil
+}
+
+// verifyBlock compare the records of a block with the address database, the records of an address
+// at the block time are compared so extra records are only found for addresses of the block
+// or of its record in the block database
+func (v *Verifier) verifyBlock(blockDetail *types.BLockDetail, repair bool) error {
+	indexRepo := v.indexer.IndexRepo
+	addressIndexes, _ := v.indexer.CreateIndexData(blockDetail)
+	expected := map[string]map[uint8]*types.AddressIndex{}
+	for _, addressIndex := range addressIndexes {
+		address := strings.ToLower(addressIndex.Address)
+		if expected[address] == nil {
+			expected[address] = map[uint8]*types.AddressIndex{}
+		}
+		expected[address][addressIndex.Sequence] = addressIndex
+	}
+	addressSet := map[string]bool{}
+	for address := range expected {
+		addressSet[address] = true
+	}
+	if total, blocks := indexRepo.GetBlocks(blockDetail.BlockNumber.String(), 1, 0); total > 0 {
+		for _, addressSequence := range blocks[0].Addresses {
+			addressSet[strings.ToLower(addressSequence.Address)] = true
+		}
+	}
+	addresses := make([]string, 0, len(addressSet))
+	for address := range addressSet {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	issues := []types.VerifyIssue{}
+	save := []*types.AddressIndex{}
+	remove := []types.AddressIndex{}
+	blockNumber := blockDetail.BlockNumber.Int64()
+	for _, address := range addresses {
+		found := map[uint8]bool{}
+		for _, stored := range indexRepo.GetAddressIndexesAt(address, blockDetail.Time) {
+			stored := stored
+			found[stored.Sequence] = true
+			want, ok := expected[address][stored.Sequence]
+			if !ok {
+				issues = append(issues, types.VerifyIssue{Kind: types.RecordExtra, Found: &stored})
+				remove = append(remove, stored)
+			} else if !sameAddressIndex(want, &stored) {
+				issues = append(issues, types.VerifyIssue{Kind: types.RecordMismatched, Expected: want, Found: &stored})
+				save = append(save, want)
+			}
+		}
+		for sequence := uint8(1); int(sequence) <= len(expected[address]); sequence++ {
+			if want := expected[address][sequence]; !found[sequence] {
+				issues = append(issues, types.VerifyIssue{Kind: types.RecordMissing, Expected: want})
+				save = append(save, want)
+			}
+		}
+	}
+	for i := range issues {
+		issues[i].BlockNumber = blockNumber
+		record := issues[i].Expected
+		if record == nil {
+			record = issues[i].Found
+		}
+		issues[i].Address = strings.ToLower(record.Address)
+		issues[i].Sequence = record.Sequence
+		log.WithFields(log.Fields{
+			"kind":        issues[i].Kind,
+			"blockNumber": blockNumber,
+			"address":     issues[i].Address,
+			"sequence":    issues[i].Sequence,
+		}).Warn("Verifier: record differs from the chain")
+	}
+
+	repaired := false
+	if repair && len(issues) > 0 {
+		if err := indexRepo.RepairAddressIndex(save, remove); err != nil {
+			return errors.New("cannot repair block " + blockDetail.BlockNumber.String() + ": " + err.Error())
+		}
+		repaired = true
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.report.Current = blockNumber
+	v.report.NumBlocks++
+	v.report.NumRecords += int64(len(addressIndexes))
+	for _, issue := range issues {
+		switch issue.Kind {
+		case types.RecordMissing:
+			v.report.Missing++
+		case types.RecordExtra:
+			v.report.Extra++
+		case types.RecordMismatched:
+			v.report.Mismatched++
+		}
+		if len(v.report.Issues) < MaxVerifyIssues {
+			v.report.Issues = append(v.report.Issues, issue)
+		}
+	}
+	if repaired {
+		v.report.Repaired++
+	}
+	return nil
+}
+
+// sameAddressIndex whether a stored record has the data of a record of the chain,
+// the address database keeps the absolute value and lower case hex
+func sameAddressIndex(want *types.AddressIndex, stored *types.AddressIndex) bool {
+	return strings.EqualFold(want.TxHash, stored.TxHash) &&
+		strings.EqualFold(want.CoupleAddress, stored.CoupleAddress) &&
+		new(big.Int).Abs(want.Value).Cmp(stored.Value) == 0 &&
+		want.RecordType == stored.RecordType
+}
@@ -0,0 +1,94 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/WeTrustPlatform/account-indexer/core/types"
+)
+
+func verifyTestBlock(blockNumber int64) *types.BLockDetail {
+	return &types.BLockDetail{
+		BlockNumber: big.NewInt(blockNumber),
+		Time:        big.NewInt(1500000000 + blockNumber),
+		Transactions: []types.TransactionDetail{
+			{From: fmt.Sprintf("0x%040x", blockNumber), To: crashContract, TxHash: fmt.Sprintf("0x%064x", 2*blockNumber), Value: big.NewInt(1)},
+			{From: fmt.Sprintf("0x%040X", blockNumber+100), To: crashContract, TxHash: fmt.Sprintf("0x%064x", 2*blockNumber+1), Value: big.NewInt(2)},
+		},
+	}
+}
+
+func newTestVerifier(idx *Indexer, blocks map[int64]*types.BLockDetail) *Verifier {
+	verifier := NewVerifier(idx)
+	verifier.fetchRange = func(ctx context.Context, from *big.Int, to *big.Int, ch chan<- *types.BLockDetail) error {
+		defer close(ch)
+		for i := from.Int64(); i <= to.Int64(); i++ {
+			ch <- blocks[i]
+		}
+		return nil
+	}
+	return verifier
+}
+
+func TestVerify(t *testing.T) {
+	idx := NewTestIndexer()
+	blocks := map[int64]*types.BLockDetail{}
+	for i := int64(1); i <= 5; i++ {
+		blocks[i] = verifyTestBlock(i)
+		assert.Nil(t, idx.ProcessBlock(blocks[i], true))
+	}
+	verifier := newTestVerifier(idx, blocks)
+	report, err := verifier.Run(context.Background(), big.NewInt(1), big.NewInt(5), false)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), report.NumBlocks)
+	assert.Equal(t, int64(20), report.NumRecords)
+	assert.Equal(t, int64(0), report.NumIssues())
+
+	// block 2 misses a record, block 3 has a wrong value and block 4 has an extra record
+	indexes2, _ := idx.CreateIndexData(blocks[2])
+	indexes3, _ := idx.CreateIndexData(blocks[3])
+	indexes3[0].Value = big.NewInt(5)
+	indexes4, _ := idx.CreateIndexData(blocks[4])
+	extra := *indexes4[1]
+	extra.Sequence = 3
+	assert.Nil(t, idx.IndexRepo.RepairAddressIndex([]*types.AddressIndex{indexes3[0], &extra}, []types.AddressIndex{*indexes2[1]}))
+
+	report, err = verifier.Run(context.Background(), big.NewInt(1), big.NewInt(5), false)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), report.Missing)
+	assert.Equal(t, int64(1), report.Mismatched)
+	assert.Equal(t, int64(1), report.Extra)
+	assert.Equal(t, int64(0), report.Repaired)
+	assert.Equal(t, 3, len(report.Issues))
+	assert.Equal(t, types.RecordMissing, report.Issues[0].Kind)
+	assert.Equal(t, int64(2), report.Issues[0].BlockNumber)
+	assert.Equal(t, crashContract, report.Issues[0].Address)
+	assert.Equal(t, types.RecordMismatched, report.Issues[1].Kind)
+	assert.Equal(t, big.NewInt(5), report.Issues[1].Found.Value)
+	assert.Equal(t, types.RecordExtra, report.Issues[2].Kind)
+	assert.Equal(t, uint8(3), report.Issues[2].Sequence)
+
+	report, err = verifier.Run(context.Background(), big.NewInt(1), big.NewInt(5), true)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), report.NumIssues())
+	assert.Equal(t, int64(3), report.Repaired)
+	report, err = verifier.Run(context.Background(), big.NewInt(1), big.NewInt(5), false)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), report.NumIssues())
+
+	_, err = verifier.Run(context.Background(), big.NewInt(5), big.NewInt(1), false)
+	assert.NotNil(t, err)
+
+	// a verification in the background is done with jobs
+	jobs := &sync.WaitGroup{}
+	assert.Nil(t, verifier.Start(context.Background(), jobs, big.NewInt(1), big.NewInt(5), false))
+	jobs.Wait()
+	report = verifier.Report()
+	assert.False(t, report.Running)
+	assert.Equal(t, int64(5), report.NumBlocks)
+}
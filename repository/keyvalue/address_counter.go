@@ -0,0 +1,278 @@
+package keyvalue
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"time"
+
+	"github.com/WeTrustPlatform/account-indexer/common"
+	"github.com/WeTrustPlatform/account-indexer/repository/keyvalue/dao"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	log "github.com/sirupsen/logrus"
+)
+
+// Keys of the counter db: the address (20 bytes) for the number of address records of an address and the address
+// followed by a day (4 bytes, days since unix epoch) for its number of records of the day. Values are 8 bytes big endian.
+const (
+	addressLength = 20
+	secondsPerDay = 24 * 60 * 60
+)
+
+// countersReadyKey key of the counter db written once counters are built, they are not used before
+var countersReadyKey = []byte("ready")
+
+// addressChanges address record keys written by a batch, true if the key is put and false if it's deleted
+type addressChanges map[string]bool
+
+// putAddressTo add an address record to batch and count it when the batch is committed
+func (repo *KVIndexRepo) putAddressTo(batch *dao.Batch, record dao.KeyValue) {
+	repo.addressDAO.PutTo(batch, record)
+	repo.changesOf(batch)[string(record.Key)] = true
+}
+
+// deleteAddressTo add a delete of an address record to batch and uncount it when the batch is committed
+func (repo *KVIndexRepo) deleteAddressTo(batch *dao.Batch, key []byte) {
+	repo.addressDAO.DeleteTo(batch, key)
+	repo.changesOf(batch)[string(key)] = false
+}
+
+// changesOf the address changes of batch, counters are updated with them when it's committed and listeners
+// are notified once it's written
+func (repo *KVIndexRepo) changesOf(batch *dao.Batch) addressChanges {
+	return batch.Value(repo, func() interface{} {
+		changes := addressChanges{}
+		batch.OnCommit(func() func() {
+			repo.counterMutex.Lock()
+			repo.countChangesTo(batch, changes)
+			return func() {
+				repo.counterMutex.Unlock()
+				repo.notifyChanges(changes)
+			}
+		})
+		return changes
+	}).(addressChanges)
+}
+
+// countChangesTo add counter updates of changes to batch, only records that are added or removed by the batch are counted
+// so storing a block again does not change counters
+func (repo *KVIndexRepo) countChangesTo(batch *dao.Batch, changes addressChanges) {
+	deltas := map[string]int64{}
+	for key, put := range changes {
+		existing, err := repo.addressDAO.FindByKey([]byte(key))
+		exists := err == nil && existing != nil
+		if put == exists || len(key) <= addressLength {
+			continue
+		}
+		delta := int64(1)
+		if !put {
+			delta = -1
+		}
+		address := key[:addressLength]
+		day := common.UnmarshallTimeToInt([]byte(key[addressLength:len(key)-1])).Int64() / secondsPerDay
+		deltas[address] += delta
+		deltas[string(dayCounterKey([]byte(address), day))] += delta
+	}
+	for key, delta := range deltas {
+		if delta == 0 {
+			continue
+		}
+		count := repo.getCounter([]byte(key)) + delta
+		if count <= 0 {
+			repo.counterDAO.DeleteTo(batch, []byte(key))
+			continue
+		}
+		repo.counterDAO.PutTo(batch, dao.NewKeyValue([]byte(key), counterValue(count)))
+	}
+}
+
+// OnAddressesChanged implements IndexRepo
+func (repo *KVIndexRepo) OnAddressesChanged(listener func(addresses []string)) {
+	repo.listenerMutex.Lock()
+	defer repo.listenerMutex.Unlock()
+	repo.listeners = append(repo.listeners, listener)
+}
+
+// notifyChanges call listeners with the addresses of changes
+func (repo *KVIndexRepo) notifyChanges(changes addressChanges) {
+	repo.listenerMutex.RLock()
+	listeners := repo.listeners
+	repo.listenerMutex.RUnlock()
+	if len(listeners) == 0 {
+		return
+	}
+	seen := map[string]bool{}
+	addresses := []string{}
+	for key := range changes {
+		if len(key) < addressLength || seen[key[:addressLength]] {
+			continue
+		}
+		seen[key[:addressLength]] = true
+		addresses = append(addresses, hexutil.Encode([]byte(key[:addressLength])))
+	}
+	for _, listener := range listeners {
+		listener(addresses)
+	}
+}
+
+func dayCounterKey(address []byte, day int64) []byte {
+	key := make([]byte, addressLength+4)
+	copy(key, address)
+	binary.BigEndian.PutUint32(key[addressLength:], uint32(day))
+	return key
+}
+
+func counterValue(count int64) []byte {
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, uint64(count))
+	return value
+}
+
+func (repo *KVIndexRepo) getCounter(key []byte) int64 {
+	keyValue, err := repo.counterDAO.FindByKey(key)
+	if err != nil || keyValue == nil || len(keyValue.Value) != 8 {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(keyValue.Value))
+}
+
+// CountersReady whether address counters are built, see RebuildCounters
+func (repo *KVIndexRepo) CountersReady() bool {
+	keyValue, err := repo.counterDAO.FindByKey(countersReadyKey)
+	return err == nil && keyValue != nil
+}
+
+// rebuildBatchSize number of counters written at once by RebuildCounters
+const rebuildBatchSize = 10000
+
+// RebuildCounters count all address records again, it returns the number of records.
+// Address records must not be written meanwhile, it's done before indexing starts.
+func (repo *KVIndexRepo) RebuildCounters() (int, error) {
+	repo.counterMutex.Lock()
+	defer repo.counterMutex.Unlock()
+	batch := dao.NewBatch()
+	err := repo.counterDAO.Iterate(nil, nil, false, func(keyValue dao.KeyValue) bool {
+		repo.counterDAO.DeleteTo(batch, append([]byte{}, keyValue.Key...))
+		return true
+	})
+	if err == nil {
+		err = batch.Commit()
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	var address []byte
+	var addressCount int64
+	var day, dayCount int64
+	flushDay := func() {
+		if dayCount > 0 {
+			repo.counterDAO.PutTo(batch, dao.NewKeyValue(dayCounterKey(address, day), counterValue(dayCount)))
+		}
+		dayCount = 0
+	}
+	flushAddress := func() {
+		flushDay()
+		if addressCount > 0 {
+			repo.counterDAO.PutTo(batch, dao.NewKeyValue(address, counterValue(addressCount)))
+		}
+		addressCount = 0
+	}
+	var commitErr error
+	err = repo.addressDAO.Iterate(nil, nil, false, func(keyValue dao.KeyValue) bool {
+		key := keyValue.Key
+		if len(key) <= addressLength {
+			return true
+		}
+		keyDay := common.UnmarshallTimeToInt(key[addressLength:len(key)-1]).Int64() / secondsPerDay
+		if !bytes.Equal(address, key[:addressLength]) {
+			flushAddress()
+			address = append([]byte{}, key[:addressLength]...)
+			day = keyDay
+		} else if keyDay != day {
+			flushDay()
+			day = keyDay
+		}
+		addressCount++
+		dayCount++
+		total++
+		if batch.Len() >= rebuildBatchSize {
+			if commitErr = batch.Commit(); commitErr != nil {
+				return false
+			}
+		}
+		return true
+	})
+	if err == nil {
+		err = commitErr
+	}
+	if err != nil {
+		return total, err
+	}
+	flushAddress()
+	repo.counterDAO.PutTo(batch, dao.NewKeyValue(countersReadyKey, []byte{1}))
+	return total, batch.Commit()
+}
+
+// countAddress number of address records of an address from fromTime to toTime (inclusive, zero times are unbounded).
+// With counters, whole days of the range are counted with day counters and only records of the first and last day
+// are scanned. Without counters all records are scanned. It's approximate if a scan stopped early.
+func (repo *KVIndexRepo) countAddress(ctx context.Context, address string, fromTime time.Time, toTime time.Time, budget int) (int, bool) {
+	if !repo.CountersReady() {
+		return repo.scanCount(ctx, repo.addressRange(address, fromTime, toTime), budget)
+	}
+	prefix := repo.marshaller.MarshallAddressKeyPrefix(address)
+	if time.Time.IsZero(fromTime) && time.Time.IsZero(toTime) {
+		return int(repo.getCounter(prefix)), false
+	}
+	// records in [lower, upper) seconds
+	lower, upper := int64(0), int64(-1)
+	if !time.Time.IsZero(fromTime) {
+		lower = fromTime.Unix()
+	}
+	if !time.Time.IsZero(toTime) {
+		upper = toTime.Unix() + 1
+	}
+	// whole days of the range are [firstDay, lastDay)
+	firstDay := (lower + secondsPerDay - 1) / secondsPerDay
+	limit := dao.PrefixRange(prefix).Limit
+	lastDay := int64(-1)
+	if upper >= 0 {
+		lastDay = upper / secondsPerDay
+		if firstDay >= lastDay {
+			return repo.scanCount(ctx, repo.addressRange(address, fromTime, toTime), budget)
+		}
+		limit = dayCounterKey(prefix, lastDay)
+	}
+	total := int64(0)
+	err := repo.counterDAO.Iterate(dayCounterKey(prefix, firstDay), limit, false, func(keyValue dao.KeyValue) bool {
+		total += int64(binary.BigEndian.Uint64(keyValue.Value))
+		return true
+	})
+	if err != nil {
+		log.WithField("error", err.Error()).Error("KVIndexRepo: cannot read counters")
+	}
+	approximate := false
+	if lower < firstDay*secondsPerDay {
+		count, partial := repo.scanCount(ctx, repo.addressRange(address, fromTime, time.Unix(firstDay*secondsPerDay-1, 0)), budget)
+		total += int64(count)
+		approximate = approximate || partial
+	}
+	if upper >= 0 && upper > lastDay*secondsPerDay {
+		count, partial := repo.scanCount(ctx, repo.addressRange(address, time.Unix(lastDay*secondsPerDay, 0), toTime), budget)
+		total += int64(count)
+		approximate = approximate || partial
+	}
+	return int(total), approximate
+}
+
+// scanCount count address records of rg by scanning them
+func (repo *KVIndexRepo) scanCount(ctx context.Context, rg *dao.Range, budget int) (int, bool) {
+	total := 0
+	complete := repo.scanAddress(ctx, rg, false, budget, func(keyValue dao.KeyValue) bool {
+		total++
+		return true
+	})
+	return total, !complete
+}
@@ -0,0 +1,133 @@
+package keyvalue
+
+import (
+	"context"
+	"math/big"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/WeTrustPlatform/account-indexer/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+const counterAddress = "0x0000000000000000000000000000000000000003"
+
+// storeCounterBlock store a block with sequences 1 to n of counterAddress at blockTime
+func storeCounterBlock(t *testing.T, repo *KVIndexRepo, blockNumber int64, blockTime int64, n uint8) {
+	addressIndexes := []*types.AddressIndex{}
+	for i := uint8(1); i <= n; i++ {
+		addressIndexes = append(addressIndexes, &types.AddressIndex{
+			AddressSequence: types.AddressSequence{Address: counterAddress, Sequence: i},
+			TxHash:          tx1,
+			Value:           big.NewInt(1),
+			Time:            big.NewInt(blockTime),
+			CoupleAddress:   "0x0000000000000000000000000000000000000002",
+		})
+	}
+	blockIndex := &types.BlockIndex{
+		BlockNumber: big.NewInt(blockNumber).String(),
+		Addresses:   []types.AddressSequence{{Address: counterAddress, Sequence: n}},
+		Time:        big.NewInt(blockTime),
+		CreatedAt:   big.NewInt(blockTime),
+	}
+	assert.Nil(t, repo.Store(addressIndexes, blockIndex, false))
+}
+
+func TestAddressCounters(t *testing.T) {
+	db, err := OpenDB(BackendLevelDb, filepath.Join(t.TempDir(), "db"))
+	assert.Nil(t, err)
+	defer db.Close()
+	repo, _ := db.Repos()
+	assert.False(t, repo.CountersReady())
+	_, err = repo.RebuildCounters()
+	assert.Nil(t, err)
+	assert.True(t, repo.CountersReady())
+
+	day := int64(secondsPerDay)
+	// days since 2022-01-08 (day 19000): day 10 has 2 records at noon, day 11 has 3 records at 1am, day 12 has 1 record at 11pm
+	base := 19000 * day
+	storeCounterBlock(t, repo, 1, base+10*day+day/2, 2)
+	storeCounterBlock(t, repo, 2, base+11*day+3600, 3)
+	storeCounterBlock(t, repo, 3, base+12*day+23*3600, 1)
+	count := func(from int64, to int64) int {
+		fromTime, toTime := time.Time{}, time.Time{}
+		if from > 0 {
+			fromTime = time.Unix(from, 0)
+		}
+		if to > 0 {
+			toTime = time.Unix(to, 0)
+		}
+		total, approximate := repo.CountTransactions(context.Background(), counterAddress, fromTime, toTime, 0)
+		assert.False(t, approximate)
+		return total
+	}
+	assert.Equal(t, 6, count(0, 0))
+	assert.Equal(t, 6, count(base+10*day, base+13*day))
+	assert.Equal(t, 6, count(base+10*day+day/2, base+12*day+23*3600))
+	assert.Equal(t, 4, count(base+11*day-1, 0))
+	assert.Equal(t, 5, count(0, base+11*day+3600))
+	assert.Equal(t, 3, count(base+11*day, base+12*day-1))
+	assert.Equal(t, 3, count(base+11*day+3600, base+11*day+3600))
+	assert.Equal(t, 0, count(base+11*day+3601, base+12*day+23*3600-1))
+
+	// storing a block again does not change counters, a reorg replaces its records
+	storeCounterBlock(t, repo, 2, base+11*day+3600, 3)
+	assert.Equal(t, 6, count(0, 0))
+	storeCounterBlock(t, repo, 2, base+11*day+3600, 1)
+	assert.Equal(t, 4, count(0, 0))
+	assert.Equal(t, 1, count(base+11*day, base+12*day-1))
+	assert.Nil(t, repo.HandleReorg(big.NewInt(base+10*day+day/2), []types.AddressSequence{{Address: counterAddress, Sequence: 2}}))
+	assert.Equal(t, 2, count(0, 0))
+	assert.Equal(t, 0, count(base+10*day, base+11*day-1))
+	total, _, addresses := repo.FindTransactions(context.Background(), counterAddress, 1, 0, time.Time{}, time.Time{}, 0)
+	assert.Equal(t, 2, total)
+	assert.Equal(t, 1, len(addresses))
+
+	// counters are the same after a rebuild
+	numRecords, err := repo.RebuildCounters()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, numRecords)
+	assert.Equal(t, 2, count(0, 0))
+	assert.Equal(t, 1, count(base+11*day, base+12*day-1))
+	assert.Equal(t, 1, count(base+12*day, base+13*day))
+}
+
+func TestAddressCountersConcurrentStores(t *testing.T) {
+	db, err := OpenDB(BackendPebble, filepath.Join(t.TempDir(), "db"))
+	assert.Nil(t, err)
+	defer db.Close()
+	repo, _ := db.Repos()
+	_, err = repo.RebuildCounters()
+	assert.Nil(t, err)
+	wg := sync.WaitGroup{}
+	for worker := int64(0); worker < 8; worker++ {
+		wg.Add(1)
+		go func(worker int64) {
+			defer wg.Done()
+			for i := int64(0); i < 20; i++ {
+				blockNumber := worker*100 + i
+				storeCounterBlock(t, repo, blockNumber, 1600000000+blockNumber*15, 2)
+			}
+		}(worker)
+	}
+	wg.Wait()
+	assert.Equal(t, 8*20*2, repo.GetTotalTransaction(counterAddress, time.Time{}, time.Time{}))
+}
+
+func TestOnAddressesChanged(t *testing.T) {
+	db, err := OpenDB(BackendLevelDb, filepath.Join(t.TempDir(), "db"))
+	assert.Nil(t, err)
+	defer db.Close()
+	repo, _ := db.Repos()
+	changed := [][]string{}
+	repo.OnAddressesChanged(func(addresses []string) {
+		changed = append(changed, addresses)
+	})
+	blockTime := int64(19000 * secondsPerDay)
+	storeCounterBlock(t, repo, 1, blockTime, 2)
+	assert.Equal(t, [][]string{{counterAddress}}, changed)
+	assert.Nil(t, repo.HandleReorg(big.NewInt(blockTime), []types.AddressSequence{{Address: counterAddress, Sequence: 2}}))
+	assert.Equal(t, [][]string{{counterAddress}, {counterAddress}}, changed)
+}
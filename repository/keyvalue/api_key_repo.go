@@ -0,0 +1,65 @@
+package keyvalue
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/WeTrustPlatform/account-indexer/core/types"
+	"github.com/WeTrustPlatform/account-indexer/repository/keyvalue/dao"
+	log "github.com/sirupsen/logrus"
+)
+
+// KVAPIKeyRepo implement APIKeyRepo, keys are stored by id as json
+type KVAPIKeyRepo struct {
+	apiKeyDAO dao.KeyValueDAO
+}
+
+// NewKVAPIKeyRepo new KVAPIKeyRepo instance
+func NewKVAPIKeyRepo(apiKeyDAO dao.KeyValueDAO) *KVAPIKeyRepo {
+	return &KVAPIKeyRepo{apiKeyDAO: apiKeyDAO}
+}
+
+// GetAPIKeys implements APIKeyRepo, ordered by id
+func (repo *KVAPIKeyRepo) GetAPIKeys() []types.APIKey {
+	keys := []types.APIKey{}
+	for _, keyValue := range repo.apiKeyDAO.GetAllRecords() {
+		key := types.APIKey{}
+		if err := json.Unmarshal(keyValue.Value, &key); err != nil {
+			log.WithFields(log.Fields{
+				"id":    string(keyValue.Key),
+				"error": err.Error(),
+			}).Error("KVAPIKeyRepo: cannot unmarshall api key")
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// GetAPIKey implements APIKeyRepo
+func (repo *KVAPIKeyRepo) GetAPIKey(id string) (types.APIKey, error) {
+	key := types.APIKey{}
+	keyValue, err := repo.apiKeyDAO.FindByKey([]byte(id))
+	if err != nil {
+		return key, errors.New("api key " + id + " not found")
+	}
+	err = json.Unmarshal(keyValue.Value, &key)
+	return key, err
+}
+
+// SaveAPIKey implements APIKeyRepo
+func (repo *KVAPIKeyRepo) SaveAPIKey(key types.APIKey) error {
+	if key.ID == "" || key.Hash == "" {
+		return errors.New("API key is not valid, value:" + key.String())
+	}
+	value, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	return repo.apiKeyDAO.Put(dao.NewKeyValue([]byte(key.ID), value))
+}
+
+// DeleteAPIKey implements APIKeyRepo
+func (repo *KVAPIKeyRepo) DeleteAPIKey(id string) error {
+	return repo.apiKeyDAO.DeleteByKey([]byte(id))
+}
@@ -0,0 +1,32 @@
+package keyvalue
+
+import (
+	"testing"
+
+	"github.com/WeTrustPlatform/account-indexer/core/types"
+	"github.com/WeTrustPlatform/account-indexer/repository/keyvalue/dao"
+	"github.com/stretchr/testify/assert"
+	"github.com/syndtr/goleveldb/leveldb/comparer"
+	"github.com/syndtr/goleveldb/leveldb/memdb"
+)
+
+func TestAPIKeyRepo(t *testing.T) {
+	db := memdb.New(comparer.DefaultComparer, 0)
+	repo := NewKVAPIKeyRepo(dao.NewPrefixMemDbDAO(db, APIKeySpace))
+	assert.Equal(t, 0, len(repo.GetAPIKeys()))
+	assert.NotNil(t, repo.SaveAPIKey(types.APIKey{ID: "1"}))
+
+	key1 := types.APIKey{ID: "1", Name: "partner", Hash: "h1", RateLimit: 5, RateBurst: 10, CreatedAt: 100}
+	key2 := types.APIKey{ID: "2", Name: "other", Hash: "h2", Disabled: true}
+	assert.Nil(t, repo.SaveAPIKey(key2))
+	assert.Nil(t, repo.SaveAPIKey(key1))
+	assert.Equal(t, []types.APIKey{key1, key2}, repo.GetAPIKeys())
+	key, err := repo.GetAPIKey("1")
+	assert.Nil(t, err)
+	assert.Equal(t, key1, key)
+
+	assert.Nil(t, repo.DeleteAPIKey("1"))
+	_, err = repo.GetAPIKey("1")
+	assert.NotNil(t, err)
+	assert.Equal(t, []types.APIKey{key2}, repo.GetAPIKeys())
+}
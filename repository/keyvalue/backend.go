@@ -0,0 +1,95 @@
+package keyvalue
+
+import (
+	"errors"
+
+	"github.com/WeTrustPlatform/account-indexer/repository/keyvalue/dao"
+	"github.com/cockroachdb/pebble"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// Storage backends
+const (
+	BackendLevelDb = "leveldb"
+	BackendPebble  = "pebble"
+)
+
+// DB a database of a storage backend holding the key spaces of all repositories
+type DB struct {
+	Backend  string
+	newDAO   func(keySpace []byte) dao.KeyValueDAO
+	snapshot func() (dao.Snapshot, error)
+	close    func() error
+}
+
+// ValidateBackend error if backend is not supported
+func ValidateBackend(backend string) error {
+	if backend != BackendLevelDb && backend != BackendPebble {
+		return errors.New("storage backend should be " + BackendLevelDb + " or " + BackendPebble + ", found " + backend)
+	}
+	return nil
+}
+
+// OpenDB open or create the database of backend at path
+func OpenDB(backend string, path string) (*DB, error) {
+	if err := ValidateBackend(backend); err != nil {
+		return nil, err
+	}
+	if backend == BackendPebble {
+		db, err := pebble.Open(path, &pebble.Options{})
+		if err != nil {
+			return nil, err
+		}
+		newDAO := func(keySpace []byte) dao.KeyValueDAO {
+			return dao.NewPrefixPebbleDAO(db, keySpace)
+		}
+		snapshot := func() (dao.Snapshot, error) {
+			return dao.NewPebbleSnapshot(db)
+		}
+		return &DB{Backend: backend, newDAO: newDAO, snapshot: snapshot, close: db.Close}, nil
+	}
+	db, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	newDAO := func(keySpace []byte) dao.KeyValueDAO {
+		return dao.NewPrefixLevelDbDAO(db, keySpace)
+	}
+	snapshot := func() (dao.Snapshot, error) {
+		return dao.NewLevelDbSnapshot(db)
+	}
+	return &DB{Backend: backend, newDAO: newDAO, snapshot: snapshot, close: db.Close}, nil
+}
+
+// KeySpace the DAO of a key space
+func (db *DB) KeySpace(keySpace []byte) dao.KeyValueDAO {
+	return db.newDAO(keySpace)
+}
+
+// Snapshot a consistent view of all key spaces, it must be released
+func (db *DB) Snapshot() (dao.Snapshot, error) {
+	return db.snapshot()
+}
+
+// Repos index and batch repositories of the database
+func (db *DB) Repos() (*KVIndexRepo, *KVBatchRepo) {
+	return NewRepos(db.newDAO)
+}
+
+// ChainRepos index and batch repositories of a chain, their key spaces are under the namespace of the chain
+func (db *DB) ChainRepos(chainID string) (*KVIndexRepo, *KVBatchRepo) {
+	namespace := ChainNamespace(chainID)
+	return NewRepos(func(keySpace []byte) dao.KeyValueDAO {
+		return db.newDAO(append(append([]byte{}, namespace...), keySpace...))
+	})
+}
+
+// APIKeyRepo repository of the keys of the public api
+func (db *DB) APIKeyRepo() *KVAPIKeyRepo {
+	return NewKVAPIKeyRepo(db.newDAO(APIKeySpace))
+}
+
+// Close close the database
+func (db *DB) Close() error {
+	return db.close()
+}
@@ -0,0 +1,375 @@
+package keyvalue
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/WeTrustPlatform/account-indexer/common"
+	"github.com/WeTrustPlatform/account-indexer/core/types"
+	"github.com/WeTrustPlatform/account-indexer/repository/keyvalue/dao"
+	"github.com/WeTrustPlatform/account-indexer/repository/keyvalue/marshal"
+)
+
+const (
+	// SchemaVersion version of the key spaces and record formats, a backup is only restored by the same version
+	SchemaVersion = 1
+	// backupManifestName the last entry of a backup tarball
+	backupManifestName = "manifest.json"
+	// backupDataPrefix records are in entries data/00000000, data/00000001...
+	backupDataPrefix = "data/"
+	// backupChunkSize max size of a data entry, a record is never split across entries
+	backupChunkSize = 16 << 20
+	// restoreBatchSize number of records restored in a write
+	restoreBatchSize = 10000
+)
+
+// Backup write a snapshot of all key spaces to w as a gzipped tarball, writes after the snapshot
+// is taken are not included so indexing can continue meanwhile. It stops with the error of ctx when ctx is done
+func (db *DB) Backup(ctx context.Context, w io.Writer) (types.BackupManifest, error) {
+	manifest := types.BackupManifest{SchemaVersion: SchemaVersion, Backend: db.Backend, CreatedAt: time.Now().UTC()}
+	snapshot, err := db.Snapshot()
+	if err != nil {
+		return manifest, err
+	}
+	defer snapshot.Release()
+	manifest.LastBlocks, err = snapshotLastBlocks(snapshot)
+	if err != nil {
+		return manifest, err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	hash := sha256.New()
+	chunk := []byte{}
+	numChunk := 0
+	writeChunk := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		name := fmt.Sprintf("%s%08d", backupDataPrefix, numChunk)
+		if err := writeTarEntry(tw, name, chunk, manifest.CreatedAt); err != nil {
+			return err
+		}
+		hash.Write(chunk)
+		chunk = chunk[:0]
+		numChunk++
+		return nil
+	}
+	var writeErr error
+	err = snapshot.Iterate(nil, nil, false, func(record dao.KeyValue) bool {
+		recordSize := 2*binary.MaxVarintLen64 + len(record.Key) + len(record.Value)
+		if len(chunk)+recordSize > backupChunkSize {
+			if writeErr = ctx.Err(); writeErr != nil {
+				return false
+			}
+			if writeErr = writeChunk(); writeErr != nil {
+				return false
+			}
+		}
+		chunk = appendRecord(chunk, record)
+		manifest.NumRecords++
+		return true
+	})
+	if err == nil {
+		err = writeErr
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err == nil {
+		err = writeChunk()
+	}
+	if err != nil {
+		return manifest, err
+	}
+	manifest.Checksum = hex.EncodeToString(hash.Sum(nil))
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return manifest, err
+	}
+	if err := writeTarEntry(tw, backupManifestName, manifestJSON, manifest.CreatedAt); err != nil {
+		return manifest, err
+	}
+	if err := tw.Close(); err != nil {
+		return manifest, err
+	}
+	return manifest, gz.Close()
+}
+
+// BackupFile write a backup to path, the file only appears at path once the backup is complete
+func (db *DB) BackupFile(ctx context.Context, path string) (types.BackupManifest, error) {
+	if _, err := os.Stat(path); err == nil {
+		return types.BackupManifest{}, errors.New("backup file " + path + " already exists")
+	}
+	tmpPath := path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return types.BackupManifest{}, err
+	}
+	defer os.Remove(tmpPath)
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	manifest, err := db.Backup(ctx, writer)
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if err == nil {
+		err = file.Close()
+	}
+	if err != nil {
+		return manifest, err
+	}
+	return manifest, os.Rename(tmpPath, path)
+}
+
+// VerifyBackup read a backup tarball and check its records against the manifest
+func VerifyBackup(r io.Reader) (types.BackupManifest, error) {
+	return readBackup(r, nil)
+}
+
+// Restore verify the backup at path then restore it to a new database of backend at dbPath.
+// Nothing is written if the backup is not valid, the new database is removed if restoring fails.
+func Restore(path string, backend string, dbPath string) (types.BackupManifest, error) {
+	manifest, err := verifyBackupFile(path)
+	if err != nil {
+		return manifest, err
+	}
+	if _, err := os.Stat(dbPath); err == nil {
+		return manifest, errors.New("database " + dbPath + " already exists, restore needs a new path")
+	}
+	db, err := OpenDB(backend, dbPath)
+	if err != nil {
+		return manifest, err
+	}
+	err = restoreRecords(db, path, manifest)
+	db.Close()
+	if err != nil {
+		os.RemoveAll(dbPath)
+	}
+	return manifest, err
+}
+
+func verifyBackupFile(path string) (types.BackupManifest, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return types.BackupManifest{}, err
+	}
+	defer file.Close()
+	return VerifyBackup(bufio.NewReader(file))
+}
+
+func restoreRecords(db *DB, path string, manifest types.BackupManifest) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	// records have key space prefixes
+	target := db.KeySpace(nil)
+	batch := dao.NewBatch()
+	_, err = readBackup(bufio.NewReader(file), func(record dao.KeyValue) error {
+		target.PutTo(batch, record)
+		if batch.Len() >= restoreBatchSize {
+			return batch.Commit()
+		}
+		return nil
+	})
+	if err == nil {
+		err = batch.Commit()
+	}
+	if err != nil {
+		return err
+	}
+	snapshot, err := db.Snapshot()
+	if err != nil {
+		return err
+	}
+	defer snapshot.Release()
+	lastBlocks, err := snapshotLastBlocks(snapshot)
+	if err != nil {
+		return err
+	}
+	for chainID, lastBlock := range manifest.LastBlocks {
+		if lastBlocks[chainID] != lastBlock {
+			return fmt.Errorf("last block of chain %v of restored database is %v, manifest has %v", chainID, lastBlocks[chainID], lastBlock)
+		}
+	}
+	for chainID, lastBlock := range lastBlocks {
+		if _, ok := manifest.LastBlocks[chainID]; !ok {
+			return fmt.Errorf("restored database has last block %v of chain %v, manifest has none", lastBlock, chainID)
+		}
+	}
+	return nil
+}
+
+// readBackup read all entries of a backup tarball, fn is called for every record if it's not nil.
+// It returns an error if the records do not match the manifest.
+func readBackup(r io.Reader, fn func(record dao.KeyValue) error) (types.BackupManifest, error) {
+	manifest := types.BackupManifest{}
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return manifest, err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	hash := sha256.New()
+	numChunk := 0
+	numRecords := int64(0)
+	hasManifest := false
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return manifest, err
+		}
+		if hasManifest {
+			return manifest, errors.New("unexpected entry " + header.Name + " after manifest")
+		}
+		if header.Name == backupManifestName {
+			data, err := io.ReadAll(io.LimitReader(tr, 1<<20))
+			if err != nil {
+				return manifest, err
+			}
+			if err := json.Unmarshal(data, &manifest); err != nil {
+				return manifest, errors.New("invalid manifest: " + err.Error())
+			}
+			hasManifest = true
+			continue
+		}
+		if header.Name != fmt.Sprintf("%s%08d", backupDataPrefix, numChunk) || header.Size > backupChunkSize {
+			return manifest, errors.New("unexpected entry " + header.Name)
+		}
+		chunk, err := io.ReadAll(tr)
+		if err != nil {
+			return manifest, err
+		}
+		hash.Write(chunk)
+		numChunk++
+		for len(chunk) > 0 {
+			var record dao.KeyValue
+			record, chunk, err = readRecord(chunk)
+			if err != nil {
+				return manifest, err
+			}
+			numRecords++
+			if fn != nil {
+				if err := fn(record); err != nil {
+					return manifest, err
+				}
+			}
+		}
+	}
+	if !hasManifest {
+		return manifest, errors.New("backup has no manifest")
+	}
+	if manifest.SchemaVersion != SchemaVersion {
+		return manifest, fmt.Errorf("backup schema version is %v, this version of the indexer needs %v", manifest.SchemaVersion, SchemaVersion)
+	}
+	if manifest.NumRecords != numRecords {
+		return manifest, fmt.Errorf("backup has %v records, manifest has %v", numRecords, manifest.NumRecords)
+	}
+	if checksum := hex.EncodeToString(hash.Sum(nil)); checksum != manifest.Checksum {
+		return manifest, fmt.Errorf("backup checksum is %v, manifest has %v", checksum, manifest.Checksum)
+	}
+	return manifest, nil
+}
+
+// snapshotLastBlocks latest block number of the default chain and of every chain namespace of a snapshot,
+// chains without blocks are left out
+func snapshotLastBlocks(snapshot dao.Snapshot) (map[string]string, error) {
+	chainIDs, err := snapshotChainIDs(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	lastBlocks := map[string]string{}
+	for _, chainID := range append([]string{common.DefaultChainID}, chainIDs...) {
+		lastBlock, err := snapshotLastBlock(snapshot, append(ChainNamespace(chainID), BlockKeySpace...))
+		if err != nil {
+			return nil, err
+		}
+		if lastBlock != "" {
+			lastBlocks[chainID] = lastBlock
+		}
+	}
+	return lastBlocks, nil
+}
+
+// snapshotChainIDs ids of the chain namespaces "c<chainID>/" of a snapshot, it seeks from one namespace to the next
+func snapshotChainIDs(snapshot dao.Snapshot) ([]string, error) {
+	chainIDs := []string{}
+	namespaces := dao.PrefixRange([]byte(chainNamespacePrefix))
+	start := namespaces.Start
+	for {
+		chainID := ""
+		err := snapshot.Iterate(start, namespaces.Limit, false, func(record dao.KeyValue) bool {
+			if end := bytes.IndexByte(record.Key, '/'); end > len(chainNamespacePrefix) {
+				chainID = string(record.Key[len(chainNamespacePrefix):end])
+			}
+			return false
+		})
+		if err != nil || chainID == "" {
+			return chainIDs, err
+		}
+		chainIDs = append(chainIDs, chainID)
+		start = dao.PrefixRange(ChainNamespace(chainID)).Limit
+	}
+}
+
+// snapshotLastBlock latest block number in a block key space of a snapshot, empty if there is none
+func snapshotLastBlock(snapshot dao.Snapshot, blockKeySpace []byte) (string, error) {
+	lastBlock := ""
+	blocks := dao.PrefixRange(blockKeySpace)
+	err := snapshot.Iterate(blocks.Start, blocks.Limit, true, func(record dao.KeyValue) bool {
+		lastBlock = marshal.ByteMarshaller{}.UnmarshallBlockKey(record.Key[len(blockKeySpace):]).String()
+		return false
+	})
+	return lastBlock, err
+}
+
+func writeTarEntry(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: modTime}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// appendRecord a record is the uvarint length of the key, the key, the uvarint length of the value then the value
+func appendRecord(buf []byte, record dao.KeyValue) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(record.Key)))
+	buf = append(buf, record.Key...)
+	buf = binary.AppendUvarint(buf, uint64(len(record.Value)))
+	return append(buf, record.Value...)
+}
+
+// readRecord read the first record of buf and return the rest
+func readRecord(buf []byte) (dao.KeyValue, []byte, error) {
+	fields := [][]byte{}
+	for i := 0; i < 2; i++ {
+		length, n := binary.Uvarint(buf)
+		if n <= 0 || uint64(len(buf)-n) < length {
+			return dao.KeyValue{}, nil, errors.New("backup has a truncated record")
+		}
+		fields = append(fields, buf[n:n+int(length)])
+		buf = buf[n+int(length):]
+	}
+	return dao.NewKeyValue(fields[0], fields[1]), buf, nil
+}
@@ -0,0 +1,147 @@
+package keyvalue
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/WeTrustPlatform/account-indexer/common"
+	"github.com/WeTrustPlatform/account-indexer/core/types"
+	"github.com/WeTrustPlatform/account-indexer/repository/keyvalue/dao"
+	"github.com/stretchr/testify/assert"
+)
+
+func saveTestBlocks(t *testing.T, db *DB, blockNumbers ...int64) {
+	saveTestChainBlocks(t, db, common.DefaultChainID, blockNumbers...)
+}
+
+func saveTestChainBlocks(t *testing.T, db *DB, chainID string, blockNumbers ...int64) {
+	indexRepo, _ := db.ChainRepos(chainID)
+	for _, blockNumber := range blockNumbers {
+		number := big.NewInt(blockNumber)
+		addressIndex := &types.AddressIndex{
+			AddressSequence: types.AddressSequence{Address: "0x0000000000000000000000000000000000000001", Sequence: 1},
+			TxHash:          "0x01",
+			Value:           big.NewInt(1),
+			Time:            number,
+			CoupleAddress:   "0x0000000000000000000000000000000000000002",
+		}
+		blockIndex := &types.BlockIndex{BlockNumber: number.String(), Time: number, CreatedAt: number}
+		assert.Nil(t, indexRepo.Store([]*types.AddressIndex{addressIndex}, blockIndex, false))
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	for _, backend := range []string{BackendLevelDb, BackendPebble} {
+		db, err := OpenDB(backend, filepath.Join(t.TempDir(), "db"))
+		assert.Nil(t, err)
+		saveTestBlocks(t, db, 10)
+		snapshot, err := db.Snapshot()
+		assert.Nil(t, err)
+		saveTestBlocks(t, db, 11)
+
+		lastBlocks, err := snapshotLastBlocks(snapshot)
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]string{common.DefaultChainID: "10"}, lastBlocks, backend)
+		numRecords := 0
+		assert.Nil(t, snapshot.Iterate(nil, nil, false, func(record dao.KeyValue) bool {
+			numRecords++
+			return true
+		}))
+		// an address, a block, a range record and the address and day counters of the address
+		assert.Equal(t, 5, numRecords, backend)
+		snapshot.Release()
+		assert.Nil(t, db.Close())
+	}
+}
+
+func TestBackupRestore(t *testing.T) {
+	for _, backend := range []string{BackendLevelDb, BackendPebble} {
+		dir := t.TempDir()
+		db, err := OpenDB(backend, filepath.Join(dir, "db"))
+		assert.Nil(t, err)
+		saveTestBlocks(t, db, 10, 11, 12)
+		saveTestChainBlocks(t, db, "1", 20)
+		saveTestChainBlocks(t, db, "10", 30, 31)
+		backupPath := filepath.Join(dir, "backup.tar.gz")
+		manifest, err := db.BackupFile(context.Background(), backupPath)
+		assert.Nil(t, err)
+		assert.Nil(t, db.Close())
+		assert.Equal(t, SchemaVersion, manifest.SchemaVersion)
+		assert.Equal(t, backend, manifest.Backend)
+		assert.Equal(t, map[string]string{common.DefaultChainID: "12", "1": "20", "10": "31"}, manifest.LastBlocks)
+		// 3 address, 3 block, a range record and 2 counters of the default chain, 1 block of chain 1 and 2 of chain 10
+		assert.Equal(t, int64(9+5+7), manifest.NumRecords)
+		_, err = os.Stat(backupPath + ".tmp")
+		assert.True(t, os.IsNotExist(err))
+
+		// a backup can be restored to another backend
+		for _, target := range []string{BackendLevelDb, BackendPebble} {
+			restorePath := filepath.Join(dir, "restored_"+target)
+			restored, err := Restore(backupPath, target, restorePath)
+			assert.Nil(t, err)
+			assert.Equal(t, manifest.Checksum, restored.Checksum)
+			db, err := OpenDB(target, restorePath)
+			assert.Nil(t, err)
+			indexRepo, _ := db.Repos()
+			total, blocks := indexRepo.GetBlocks("", 10, 0)
+			assert.Equal(t, 3, total)
+			assert.Equal(t, "12", blocks[0].BlockNumber)
+			assert.Equal(t, 3, indexRepo.GetTotalTransaction("0x0000000000000000000000000000000000000001", time.Time{}, time.Time{}))
+			chainRepo, _ := db.ChainRepos("10")
+			total, blocks = chainRepo.GetBlocks("", 10, 0)
+			assert.Equal(t, 2, total)
+			assert.Equal(t, "31", blocks[0].BlockNumber)
+			assert.Nil(t, db.Close())
+
+			_, err = Restore(backupPath, target, restorePath)
+			assert.NotNil(t, err, "restore to an existing database")
+		}
+
+		// the last block of every chain is checked
+		db, err = OpenDB(backend, filepath.Join(dir, "mismatch"))
+		assert.Nil(t, err)
+		manifest.LastBlocks["10"] = "30"
+		assert.NotNil(t, restoreRecords(db, backupPath, manifest))
+		assert.Nil(t, db.Close())
+	}
+}
+
+func TestVerifyBackup(t *testing.T) {
+	db, err := OpenDB(BackendLevelDb, filepath.Join(t.TempDir(), "db"))
+	assert.Nil(t, err)
+	defer db.Close()
+	saveTestBlocks(t, db, 10)
+	buf := &bytes.Buffer{}
+	manifest, err := db.Backup(context.Background(), buf)
+	assert.Nil(t, err)
+	verified, err := VerifyBackup(bytes.NewReader(buf.Bytes()))
+	assert.Nil(t, err)
+	assert.Equal(t, manifest.Checksum, verified.Checksum)
+
+	// a backup stops when its context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = db.Backup(ctx, &bytes.Buffer{})
+	assert.Equal(t, context.Canceled, err)
+
+	corrupted := append([]byte{}, buf.Bytes()...)
+	corrupted[len(corrupted)/2] ^= 0xff
+	_, err = VerifyBackup(bytes.NewReader(corrupted))
+	assert.NotNil(t, err)
+	_, err = VerifyBackup(bytes.NewReader(buf.Bytes()[:buf.Len()/2]))
+	assert.NotNil(t, err)
+
+	record := dao.NewKeyValue([]byte("key"), []byte("value"))
+	encoded := appendRecord(nil, record)
+	read, rest, err := readRecord(encoded)
+	assert.Nil(t, err)
+	assert.Equal(t, record, read)
+	assert.Equal(t, 0, len(rest))
+	_, _, err = readRecord(encoded[:len(encoded)-1])
+	assert.NotNil(t, err)
+}
@@ -5,6 +5,7 @@ import (
 	"math/big"
 
 	"github.com/WeTrustPlatform/account-indexer/core/types"
+	"github.com/WeTrustPlatform/account-indexer/repository"
 	"github.com/WeTrustPlatform/account-indexer/repository/keyvalue/dao"
 	"github.com/WeTrustPlatform/account-indexer/repository/keyvalue/marshal"
 )
@@ -50,21 +51,49 @@ func (repo *KVBatchRepo) keyValueToBatchStatus(keyValue dao.KeyValue) types.Batc
 	return batch
 }
 
+// NewWriteBatch implements BatchRepo
+func (repo *KVBatchRepo) NewWriteBatch() repository.WriteBatch {
+	return dao.NewBatch()
+}
+
 // UpdateBatch update a batch
 func (repo *KVBatchRepo) UpdateBatch(batch types.BatchStatus) error {
+	wb := repo.NewWriteBatch()
+	if err := repo.UpdateBatchIn(wb, batch); err != nil {
+		return err
+	}
+	return wb.Commit()
+}
+
+// UpdateBatchIn implements BatchRepo
+func (repo *KVBatchRepo) UpdateBatchIn(wb repository.WriteBatch, batch types.BatchStatus) error {
 	if batch.From == nil || batch.To == nil || batch.Step == 0 || batch.CreatedAt == nil {
 		return errors.New("Batch is not valid, value:" + batch.String())
 	}
+	daoBatch, err := daoBatch(wb)
+	if err != nil {
+		return err
+	}
 	key := repo.marshaller.MarshallBatchKey(batch.From, batch.To, batch.Step, batch.CreatedAt)
 	value := repo.marshaller.MarshallBatchValue(batch.UpdatedAt, batch.Current)
-	return repo.batchDAO.Put(dao.NewKeyValue(key, value))
+	repo.batchDAO.PutTo(daoBatch, dao.NewKeyValue(key, value))
+	return nil
 }
 
-// ReplaceBatch replace a batch with new "to"
+// ReplaceBatch replace a batch with new "to", the old record is deleted in the same write
 func (repo *KVBatchRepo) ReplaceBatch(from *big.Int, newTo *big.Int) error {
+	wb := repo.NewWriteBatch()
+	if err := repo.ReplaceBatchIn(wb, from, newTo); err != nil {
+		return err
+	}
+	return wb.Commit()
+}
+
+// ReplaceBatchIn implements BatchRepo
+func (repo *KVBatchRepo) ReplaceBatchIn(wb repository.WriteBatch, from *big.Int, newTo *big.Int) error {
 	fromByteArr := repo.marshaller.MarshallBatchKeyFrom(from)
 	asc := true
-	_, keyValues := repo.batchDAO.FindByKeyPrefix(fromByteArr, asc, 0, 0)
+	_, keyValues := repo.batchDAO.FindByKeyPrefix(fromByteArr, asc, 1, 0)
 	if len(keyValues) <= 0 {
 		return nil
 	}
@@ -72,14 +101,18 @@ func (repo *KVBatchRepo) ReplaceBatch(from *big.Int, newTo *big.Int) error {
 	key := keyValue.Key
 	value := keyValue.Value
 	batch := repo.getBatchStatus(key, value)
-	return repo.replaceBatch(batch, newTo)
+	return repo.replaceBatchIn(wb, batch, newTo)
 }
 
-func (repo *KVBatchRepo) replaceBatch(batch types.BatchStatus, newTo *big.Int) error {
+func (repo *KVBatchRepo) replaceBatchIn(wb repository.WriteBatch, batch types.BatchStatus, newTo *big.Int) error {
+	daoBatch, err := daoBatch(wb)
+	if err != nil {
+		return err
+	}
 	key := repo.marshaller.MarshallBatchKey(batch.From, batch.To, batch.Step, batch.CreatedAt)
-	repo.batchDAO.DeleteByKey(key)
+	repo.batchDAO.DeleteTo(daoBatch, key)
 	batch.To = newTo
-	return repo.UpdateBatch(batch)
+	return repo.UpdateBatchIn(wb, batch)
 }
 
 func (repo *KVBatchRepo) getBatchStatus(key []byte, value []byte) types.BatchStatus {
@@ -1,9 +1,5 @@
 package dao
 
-import (
-	"github.com/syndtr/goleveldb/leveldb/util"
-)
-
 // KeyValueDAO generic DAO interface for the indexer
 type KeyValueDAO interface {
 	Put(record KeyValue) error
@@ -12,13 +8,157 @@ type KeyValueDAO interface {
 	DeleteByKey(key []byte) error
 	FindByKeyPrefix(prefix []byte, asc bool, rows int, start int) (int, []KeyValue)
 	CountByKeyPrefix(prefix []byte) int
-	FindByRange(rg *util.Range, asc bool, rows int, start int) (int, []KeyValue)
-	CountByRange(rg *util.Range) int
+	FindByRange(rg *Range, asc bool, rows int, start int) (int, []KeyValue)
+	CountByRange(rg *Range) int
+	// Iterate call fn for records in [start, limit) in key order (or reverse order) until it returns false,
+	// nil start or limit is unbounded
+	Iterate(start []byte, limit []byte, reverse bool, fn IterateFunc) error
 	FindByKey(key []byte) (*KeyValue, error)
 	GetNFirstRecords(n int) []KeyValue
 	GetNLastRecords(n int) []KeyValue
 	GetNFirstPredicate(pre Predicate) []KeyValue
 	GetAllRecords() []KeyValue
+	// PutTo add a put to batch, it's written when the batch is committed
+	PutTo(batch *Batch, record KeyValue)
+	// DeleteTo add a delete to batch, it's written when the batch is committed
+	DeleteTo(batch *Batch, key []byte)
+}
+
+// batchOp a put or a delete of a Batch
+type batchOp struct {
+	key    []byte
+	value  []byte
+	delete bool
+}
+
+// batchDB a database that a Batch writes to, it applies the ops of a commit with its own batch
+type batchDB interface {
+	write(ops []batchOp) error
+}
+
+// Batch writes to one or more DAOs that are committed together.
+// Writes to DAOs of the same database are committed atomically.
+type Batch struct {
+	dbs    []batchDB
+	ops    map[batchDB][]batchOp
+	hooks  []func() func()
+	values map[interface{}]interface{}
+}
+
+// NewBatch new empty Batch
+func NewBatch() *Batch {
+	return &Batch{ops: map[batchDB][]batchOp{}, values: map[interface{}]interface{}{}}
+}
+
+// OnCommit fn is called by Commit before the batch is written, it can add writes to the batch.
+// The function it returns is called after the batch is written, even if that failed.
+func (b *Batch) OnCommit(fn func() func()) {
+	b.hooks = append(b.hooks, fn)
+}
+
+// Value a value attached to the batch for key until it's committed, init creates it on first use
+func (b *Batch) Value(key interface{}, init func() interface{}) interface{} {
+	value, ok := b.values[key]
+	if !ok {
+		value = init()
+		b.values[key] = value
+	}
+	return value
+}
+
+// put add a put of a copy of key and value to the writes of db
+func (b *Batch) put(db batchDB, key []byte, value []byte) {
+	b.add(db, batchOp{key: clone(key), value: clone(value)})
+}
+
+// delete add a delete of a copy of key to the writes of db
+func (b *Batch) delete(db batchDB, key []byte) {
+	b.add(db, batchOp{key: clone(key), delete: true})
+}
+
+func (b *Batch) add(db batchDB, op batchOp) {
+	if _, ok := b.ops[db]; !ok {
+		b.dbs = append(b.dbs, db)
+	}
+	b.ops[db] = append(b.ops[db], op)
+}
+
+// Len number of writes in the batch
+func (b *Batch) Len() int {
+	result := 0
+	for _, ops := range b.ops {
+		result += len(ops)
+	}
+	return result
+}
+
+// Commit write the batch to databases in the order they are first used, the batch is reset after that
+func (b *Batch) Commit() error {
+	hooks := b.hooks
+	b.hooks = nil
+	b.values = map[interface{}]interface{}{}
+	for _, hook := range hooks {
+		if after := hook(); after != nil {
+			defer after()
+		}
+	}
+	for _, db := range b.dbs {
+		if err := db.write(b.ops[db]); err != nil {
+			return err
+		}
+	}
+	b.dbs = nil
+	b.ops = map[batchDB][]batchOp{}
+	return nil
+}
+
+// keySpace a prefix of all keys of a DAO so that several DAOs can share a database
+type keySpace []byte
+
+func (ks keySpace) key(key []byte) []byte {
+	if len(ks) == 0 {
+		return key
+	}
+	result := make([]byte, 0, len(ks)+len(key))
+	result = append(result, ks...)
+	return append(result, key...)
+}
+
+// rg the range of rg in the key space, nil rg means all keys of the key space
+func (ks keySpace) rg(rg *Range) *Range {
+	if len(ks) == 0 {
+		return rg
+	}
+	all := PrefixRange(ks)
+	if rg == nil {
+		return all
+	}
+	result := &Range{Start: ks.key(rg.Start), Limit: all.Limit}
+	if rg.Limit != nil {
+		result.Limit = ks.key(rg.Limit)
+	}
+	return result
+}
+
+// iterator strip the key space from keys of iter
+func (ks keySpace) iterator(iter Iterator) Iterator {
+	if len(ks) == 0 {
+		return iter
+	}
+	return keySpaceIterator{Iterator: iter, n: len(ks)}
+}
+
+type keySpaceIterator struct {
+	Iterator
+	n int
+}
+
+func (ksi keySpaceIterator) Key() []byte {
+	key := ksi.Iterator.Key()
+	if key == nil {
+		return nil
+	}
+	return key[ksi.n:]
 }
 
 // KeyValue LevelDB uses key-value struct
@@ -0,0 +1,229 @@
+package dao
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/comparer"
+	"github.com/syndtr/goleveldb/leveldb/memdb"
+)
+
+var keyValues = []KeyValue{
+	KeyValue{Key: []byte("key1"), Value: []byte("value1")},
+	KeyValue{Key: []byte("key2"), Value: []byte("value2")},
+	KeyValue{Key: []byte("strange_key1"), Value: []byte("strange_value1")},
+}
+
+// testBackend a storage backend that the DAO tests run against
+type testBackend struct {
+	name string
+	// open an empty database, newDAO creates the DAO of a key space
+	open func(t *testing.T) (newDAO func(prefix []byte) KeyValueDAO, close func())
+}
+
+var testBackends = []testBackend{
+	{
+		name: "memdb",
+		open: func(t *testing.T) (func(prefix []byte) KeyValueDAO, func()) {
+			db := memdb.New(comparer.DefaultComparer, 0)
+			return func(prefix []byte) KeyValueDAO { return NewPrefixMemDbDAO(db, prefix) }, func() {}
+		},
+	},
+	{
+		name: "leveldb",
+		open: func(t *testing.T) (func(prefix []byte) KeyValueDAO, func()) {
+			db, err := leveldb.OpenFile(t.TempDir(), nil)
+			assert.Nil(t, err)
+			return func(prefix []byte) KeyValueDAO { return NewPrefixLevelDbDAO(db, prefix) }, func() { db.Close() }
+		},
+	},
+	{
+		name: "pebble",
+		open: func(t *testing.T) (func(prefix []byte) KeyValueDAO, func()) {
+			db, err := pebble.Open(t.TempDir(), &pebble.Options{})
+			assert.Nil(t, err)
+			return func(prefix []byte) KeyValueDAO { return NewPrefixPebbleDAO(db, prefix) }, func() { db.Close() }
+		},
+	},
+}
+
+type KeyValueDAOTestSuite struct {
+	suite.Suite
+	backend testBackend
+	prefix  []byte
+	close   func()
+	dao     KeyValueDAO
+	// neighbour DAO of the next key space in the same db
+	neighbour KeyValueDAO
+}
+
+// TestKeyValueDAO run the tests against every backend, then in a key space where
+// records of other key spaces must not be visible
+func TestKeyValueDAO(t *testing.T) {
+	for _, backend := range testBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			suite.Run(t, &KeyValueDAOTestSuite{backend: backend})
+		})
+		t.Run(backend.name+"KeySpace", func(t *testing.T) {
+			suite.Run(t, &KeyValueDAOTestSuite{backend: backend, prefix: []byte("b")})
+		})
+	}
+}
+
+func (suite *KeyValueDAOTestSuite) SetupTest() {
+	var newDAO func(prefix []byte) KeyValueDAO
+	newDAO, suite.close = suite.backend.open(suite.T())
+	suite.dao = newDAO(suite.prefix)
+	err := suite.dao.BatchPut(keyValues)
+	assert.Nil(suite.T(), err)
+	if len(suite.prefix) > 0 {
+		suite.neighbour = newDAO([]byte("c"))
+		assert.Nil(suite.T(), suite.neighbour.BatchPut(keyValues))
+		assert.Nil(suite.T(), newDAO([]byte("a")).BatchPut(keyValues))
+	}
+}
+
+func (suite *KeyValueDAOTestSuite) TearDownTest() {
+	suite.close()
+}
+
+func (suite *KeyValueDAOTestSuite) TestBatchCommit() {
+	if len(suite.prefix) == 0 {
+		suite.neighbour = suite.dao
+	}
+	batch := NewBatch()
+	suite.dao.PutTo(batch, NewKeyValue([]byte("key3"), []byte("value3")))
+	suite.neighbour.PutTo(batch, NewKeyValue([]byte("key4"), []byte("value4")))
+	suite.dao.DeleteTo(batch, []byte("key1"))
+	// the batch keeps copies of keys and values, writes are applied in order
+	value := []byte("value5")
+	suite.dao.PutTo(batch, NewKeyValue([]byte("key5"), value))
+	value[0] = 'x'
+	suite.dao.PutTo(batch, NewKeyValue([]byte("key6"), []byte("value6")))
+	suite.dao.DeleteTo(batch, []byte("key6"))
+	assert.Equal(suite.T(), 6, batch.Len())
+	assert.Equal(suite.T(), 2, suite.dao.CountByKeyPrefix([]byte("key")), "writes are not visible before commit")
+	assert.Nil(suite.T(), batch.Commit())
+	_, err := suite.dao.FindByKey([]byte("key1"))
+	assert.NotNil(suite.T(), err)
+	kv, err := suite.dao.FindByKey([]byte("key3"))
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), []byte("value3"), kv.Value)
+	kv, err = suite.neighbour.FindByKey([]byte("key4"))
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), []byte("value4"), kv.Value)
+	kv, err = suite.dao.FindByKey([]byte("key5"))
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), []byte("value5"), kv.Value)
+	_, err = suite.dao.FindByKey([]byte("key6"))
+	assert.NotNil(suite.T(), err)
+	assert.Equal(suite.T(), 0, batch.Len())
+}
+
+func (suite *KeyValueDAOTestSuite) TestFindByKeyPrefix() {
+	total, prefixFound := suite.dao.FindByKeyPrefix([]byte("key"), true, 10, 0)
+	assert.Equal(suite.T(), 2, total)
+	assert.Equal(suite.T(), 2, len(prefixFound), "Found items by prefix should be 2")
+	assert.True(suite.T(), reflect.DeepEqual(keyValues[0], prefixFound[0]))
+	assert.True(suite.T(), reflect.DeepEqual(keyValues[1], prefixFound[1]))
+
+	total, prefixFound = suite.dao.FindByKeyPrefix([]byte("key"), true, 1, 0)
+	assert.Equal(suite.T(), 2, total)
+	assert.Equal(suite.T(), 1, len(prefixFound), "Found items by prefix should be 1")
+	assert.True(suite.T(), reflect.DeepEqual(keyValues[0], prefixFound[0]))
+
+	total, prefixFound = suite.dao.FindByKeyPrefix([]byte("key"), false, 10, 0)
+	assert.Equal(suite.T(), 2, total)
+	assert.Equal(suite.T(), 2, len(prefixFound), "Found items by prefix should be 2")
+	assert.True(suite.T(), reflect.DeepEqual(keyValues[1], prefixFound[0]))
+	assert.True(suite.T(), reflect.DeepEqual(keyValues[0], prefixFound[1]))
+}
+
+func (suite *KeyValueDAOTestSuite) TestCountByKeyPrefix() {
+	total := suite.dao.CountByKeyPrefix([]byte("key"))
+	assert.Equal(suite.T(), 2, total)
+}
+
+func (suite *KeyValueDAOTestSuite) TestGetNFirstPredicate() {
+	// 1st test
+	pre := Predicate(func(KeyValue) bool {
+		return true
+	})
+	foundKVs := suite.dao.GetNFirstPredicate(pre)
+	assert.Equal(suite.T(), 3, len(foundKVs))
+	assert.True(suite.T(), reflect.DeepEqual(keyValues[0], foundKVs[0]))
+	assert.True(suite.T(), reflect.DeepEqual(keyValues[1], foundKVs[1]))
+	assert.True(suite.T(), reflect.DeepEqual(keyValues[2], foundKVs[2]))
+	// 2nd test
+	pre = Predicate(func(kv KeyValue) bool {
+		str := string(kv.Key)
+		return strings.HasPrefix(str, "key")
+	})
+	foundKVs = suite.dao.GetNFirstPredicate(pre)
+	assert.Equal(suite.T(), 2, len(foundKVs))
+	assert.True(suite.T(), reflect.DeepEqual(keyValues[0], foundKVs[0]))
+	assert.True(suite.T(), reflect.DeepEqual(keyValues[1], foundKVs[1]))
+}
+
+func (suite *KeyValueDAOTestSuite) TestBatchDelete() {
+	key1 := []byte("key1")
+	key2 := []byte("key2")
+	keys := [][]byte{key1, key2}
+	err := suite.dao.BatchDelete(keys)
+	assert.Nil(suite.T(), err)
+	all := suite.dao.GetAllRecords()
+	assert.Equal(suite.T(), 1, len(all), "After BatchDelete, it should has 1 item")
+	assert.True(suite.T(), reflect.DeepEqual(keyValues[2], all[0]))
+}
+
+func (suite *KeyValueDAOTestSuite) TestFindByKey() {
+	key := []byte("key1")
+	kv, err := suite.dao.FindByKey(key)
+	assert.Nil(suite.T(), err)
+	assert.Equal(suite.T(), keyValues[0].Key, kv.Key)
+	assert.Equal(suite.T(), keyValues[0].Value, kv.Value)
+}
+
+func (suite *KeyValueDAOTestSuite) TestGetNFirstRecords() {
+	result := suite.dao.GetNFirstRecords(2)
+	assert.Equal(suite.T(), 2, len(result), "Found items by prGetNFirstRecordsefix should be 2")
+	assert.True(suite.T(), reflect.DeepEqual(keyValues[0], result[0]))
+	assert.True(suite.T(), reflect.DeepEqual(keyValues[1], result[1]))
+}
+
+func (suite *KeyValueDAOTestSuite) TestGetNLastRecords() {
+	result := suite.dao.GetNLastRecords(2)
+	assert.Equal(suite.T(), 2, len(result), "Found items by GetNLastRecords should be 2")
+	assert.True(suite.T(), reflect.DeepEqual(keyValues[2], result[0]))
+	assert.True(suite.T(), reflect.DeepEqual(keyValues[1], result[1]))
+}
+
+func (suite *KeyValueDAOTestSuite) TestFindByRange() {
+	total, found := suite.dao.FindByRange(&Range{Start: []byte("key2"), Limit: []byte("strange_key2")}, true, 10, 0)
+	assert.Equal(suite.T(), 2, total)
+	assert.True(suite.T(), reflect.DeepEqual(keyValues[1:], found))
+	assert.Equal(suite.T(), 3, suite.dao.CountByRange(&Range{}))
+	assert.Equal(suite.T(), 2, suite.dao.CountByRange(PrefixRange([]byte("key"))))
+}
+
+func (suite *KeyValueDAOTestSuite) TestIterate() {
+	collect := func(start []byte, limit []byte, reverse bool, n int) []KeyValue {
+		result := []KeyValue{}
+		err := suite.dao.Iterate(start, limit, reverse, func(record KeyValue) bool {
+			result = append(result, CopyKeyValue(record.Key, record.Value))
+			return len(result) < n
+		})
+		assert.Nil(suite.T(), err)
+		return result
+	}
+	assert.True(suite.T(), reflect.DeepEqual(keyValues, collect(nil, nil, false, 10)))
+	assert.True(suite.T(), reflect.DeepEqual([]KeyValue{keyValues[2], keyValues[1], keyValues[0]}, collect(nil, nil, true, 10)))
+	assert.True(suite.T(), reflect.DeepEqual(keyValues[1:2], collect([]byte("key2"), []byte("strange"), false, 10)))
+	assert.True(suite.T(), reflect.DeepEqual([]KeyValue{keyValues[1]}, collect(nil, []byte("strange"), true, 1)))
+	assert.Equal(suite.T(), 0, len(collect([]byte("x"), nil, false, 10)))
+}
@@ -3,13 +3,13 @@ package dao
 import (
 	"github.com/WeTrustPlatform/account-indexer/common"
 	"github.com/syndtr/goleveldb/leveldb"
-	"github.com/syndtr/goleveldb/leveldb/iterator"
 	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
 // LevelDbDAO a dao implementation using leveldb
 type LevelDbDAO struct {
-	db *leveldb.DB
+	db       *leveldb.DB
+	keySpace keySpace
 }
 
 // NewLevelDbDAO New instance of LevelDbDAO struct
@@ -17,67 +17,115 @@ func NewLevelDbDAO(db *leveldb.DB) LevelDbDAO {
 	return LevelDbDAO{db: db}
 }
 
+// NewPrefixLevelDbDAO LevelDbDAO of the keys starting with prefix, the prefix is transparent to callers
+func NewPrefixLevelDbDAO(db *leveldb.DB, prefix []byte) LevelDbDAO {
+	return LevelDbDAO{db: db, keySpace: keySpace(prefix)}
+}
+
+// levelDbWriter write batches to a leveldb
+type levelDbWriter struct {
+	db *leveldb.DB
+}
+
+func (lw levelDbWriter) write(ops []batchOp) error {
+	batch := new(leveldb.Batch)
+	for _, op := range ops {
+		if op.delete {
+			batch.Delete(op.key)
+		} else {
+			batch.Put(op.key, op.value)
+		}
+	}
+	return lw.db.Write(batch, nil)
+}
+
 // Put put a single KeyValue
 func (ld LevelDbDAO) Put(record KeyValue) error {
-	err := ld.db.Put(record.Key, record.Value, nil)
+	err := ld.db.Put(ld.keySpace.key(record.Key), record.Value, nil)
 	return err
 }
 
 // BatchPut put an array in batch
 func (ld LevelDbDAO) BatchPut(records []KeyValue) error {
-	batch := new(leveldb.Batch)
+	batch := NewBatch()
 	for _, item := range records {
-		batch.Put(item.Key, item.Value)
+		ld.PutTo(batch, item)
 	}
-	err := ld.db.Write(batch, nil)
-	return err
+	return batch.Commit()
 }
 
 // BatchDelete delete by key array
 func (ld LevelDbDAO) BatchDelete(keys [][]byte) error {
-	batch := new(leveldb.Batch)
+	batch := NewBatch()
 	for _, key := range keys {
-		batch.Delete(key)
+		ld.DeleteTo(batch, key)
 	}
-	err := ld.db.Write(batch, nil)
-	return err
+	return batch.Commit()
+}
+
+// PutTo add a put to batch
+func (ld LevelDbDAO) PutTo(batch *Batch, record KeyValue) {
+	batch.put(levelDbWriter{db: ld.db}, ld.keySpace.key(record.Key), record.Value)
+}
+
+// DeleteTo add a delete to batch
+func (ld LevelDbDAO) DeleteTo(batch *Batch, key []byte) {
+	batch.delete(levelDbWriter{db: ld.db}, ld.keySpace.key(key))
 }
 
 // DeleteByKey delete by a key
 func (ld LevelDbDAO) DeleteByKey(key []byte) error {
-	err := ld.db.Delete(key, nil)
+	err := ld.db.Delete(ld.keySpace.key(key), nil)
 	return err
 }
 
+// newIterator iterator over rg of the key space, keys are returned without the key space prefix
+func (ld LevelDbDAO) newIterator(rg *Range) Iterator {
+	return ld.keySpace.iterator(ld.db.NewIterator(utilRange(ld.keySpace.rg(rg)), nil))
+}
+
+// utilRange rg as a range of leveldb
+func utilRange(rg *Range) *util.Range {
+	if rg == nil {
+		return nil
+	}
+	return &util.Range{Start: rg.Start, Limit: rg.Limit}
+}
+
+// Iterate implement interface
+func (ld LevelDbDAO) Iterate(start []byte, limit []byte, reverse bool, fn IterateFunc) error {
+	return iterate(ld.newIterator(&Range{Start: start, Limit: limit}), reverse, fn)
+}
+
 // CountByKeyPrefix count by a key prefix
 func (ld LevelDbDAO) CountByKeyPrefix(prefix []byte) int {
-	iter := ld.db.NewIterator(util.BytesPrefix(prefix), nil)
+	iter := ld.newIterator(PrefixRange(prefix))
 	defer iter.Release()
 	return count(iter)
 }
 
 // FindByKeyPrefix find by a key prefix
 func (ld LevelDbDAO) FindByKeyPrefix(prefix []byte, asc bool, rows int, start int) (int, []KeyValue) {
-	iter := ld.db.NewIterator(util.BytesPrefix(prefix), nil)
+	iter := ld.newIterator(PrefixRange(prefix))
 	defer iter.Release()
 	return findByKeyPrefix(iter, asc, rows, start)
 }
 
 // FindByRange find by a range
-func (ld LevelDbDAO) FindByRange(rg *util.Range, asc bool, rows int, start int) (int, []KeyValue) {
-	iter := ld.db.NewIterator(rg, nil)
+func (ld LevelDbDAO) FindByRange(rg *Range, asc bool, rows int, start int) (int, []KeyValue) {
+	iter := ld.newIterator(rg)
 	defer iter.Release()
 	return findByKeyPrefix(iter, asc, rows, start)
 }
 
 // CountByRange count total of items
-func (ld LevelDbDAO) CountByRange(rg *util.Range) int {
-	iter := ld.db.NewIterator(rg, nil)
+func (ld LevelDbDAO) CountByRange(rg *Range) int {
+	iter := ld.newIterator(rg)
 	defer iter.Release()
 	return count(iter)
 }
 
-func findByKeyPrefix(iter iterator.Iterator, asc bool, rows int, start int) (int, []KeyValue) {
+func findByKeyPrefix(iter Iterator, asc bool, rows int, start int) (int, []KeyValue) {
 	result := []KeyValue{}
 	count := 0
 	total := 0
@@ -116,7 +164,7 @@ func findByKeyPrefix(iter iterator.Iterator, asc bool, rows int, start int) (int
 
 // FindByKey find by a key
 func (ld LevelDbDAO) FindByKey(key []byte) (*KeyValue, error) {
-	value, err := ld.db.Get(key, nil)
+	value, err := ld.db.Get(ld.keySpace.key(key), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -126,12 +174,12 @@ func (ld LevelDbDAO) FindByKey(key []byte) (*KeyValue, error) {
 
 // GetNFirstRecords get n first records
 func (ld LevelDbDAO) GetNFirstRecords(n int) []KeyValue {
-	iter := ld.db.NewIterator(nil, nil)
+	iter := ld.newIterator(nil)
 	defer iter.Release()
 	return getNFirstRecords(iter, n)
 }
 
-func getNFirstRecords(iter iterator.Iterator, n int) []KeyValue {
+func getNFirstRecords(iter Iterator, n int) []KeyValue {
 	count := 0
 	result := []KeyValue{}
 	for count < n && iter.Next() {
@@ -143,12 +191,12 @@ func getNFirstRecords(iter iterator.Iterator, n int) []KeyValue {
 
 // GetNLastRecords get n last records
 func (ld LevelDbDAO) GetNLastRecords(n int) []KeyValue {
-	iter := ld.db.NewIterator(nil, nil)
+	iter := ld.newIterator(nil)
 	defer iter.Release()
 	return getNLastRecords(iter, n)
 }
 
-func getNLastRecords(iter iterator.Iterator, n int) []KeyValue {
+func getNLastRecords(iter Iterator, n int) []KeyValue {
 	result := []KeyValue{}
 	if !iter.Last() {
 		return result
@@ -170,12 +218,12 @@ func getNLastRecords(iter iterator.Iterator, n int) []KeyValue {
 
 // GetNFirstPredicate go from first record until predicate evaluation is false
 func (ld LevelDbDAO) GetNFirstPredicate(prep Predicate) []KeyValue {
-	iter := ld.db.NewIterator(nil, nil)
+	iter := ld.newIterator(nil)
 	defer iter.Release()
 	return getNFirstPredicate(iter, prep)
 }
 
-func getNFirstPredicate(iter iterator.Iterator, prep Predicate) []KeyValue {
+func getNFirstPredicate(iter Iterator, prep Predicate) []KeyValue {
 	result := []KeyValue{}
 	for iter.Next() {
 		key := iter.Key()
@@ -191,12 +239,12 @@ func getNFirstPredicate(iter iterator.Iterator, prep Predicate) []KeyValue {
 
 // GetAllRecords get all records
 func (ld LevelDbDAO) GetAllRecords() []KeyValue {
-	iter := ld.db.NewIterator(nil, nil)
+	iter := ld.newIterator(nil)
 	defer iter.Release()
 	return getAllRecords(iter)
 }
 
-func getAllRecords(iter iterator.Iterator) []KeyValue {
+func getAllRecords(iter Iterator) []KeyValue {
 	result := []KeyValue{}
 	for iter.Next() {
 		result = append(result, CopyKeyValue(iter.Key(), iter.Value()))
@@ -204,7 +252,7 @@ func getAllRecords(iter iterator.Iterator) []KeyValue {
 	return result
 }
 
-func count(iter iterator.Iterator) int {
+func count(iter Iterator) int {
 	result := 0
 	for iter.Next() {
 		result++
@@ -2,12 +2,12 @@ package dao
 
 import (
 	"github.com/syndtr/goleveldb/leveldb/memdb"
-	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
 // MemDbDAO an in-memory dao implementation using memdb package of leveldb
 type MemDbDAO struct {
-	db *memdb.DB
+	db       *memdb.DB
+	keySpace keySpace
 }
 
 // NewMemDbDAO new memdb dao instance
@@ -15,16 +15,61 @@ func NewMemDbDAO(db *memdb.DB) MemDbDAO {
 	return MemDbDAO{db: db}
 }
 
+// NewPrefixMemDbDAO MemDbDAO of the keys starting with prefix, the prefix is transparent to callers
+func NewPrefixMemDbDAO(db *memdb.DB, prefix []byte) MemDbDAO {
+	return MemDbDAO{db: db, keySpace: keySpace(prefix)}
+}
+
+// memDbWriter apply batches to a memdb one write at a time, memdb is only used in tests so it's not atomic
+type memDbWriter struct {
+	db *memdb.DB
+}
+
+func (mw memDbWriter) write(ops []batchOp) error {
+	for _, op := range ops {
+		var err error
+		if op.delete {
+			err = mw.db.Delete(op.key)
+		} else {
+			err = mw.db.Put(op.key, op.value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Put implement interface
 func (md MemDbDAO) Put(record KeyValue) error {
-	err := md.db.Put(record.Key, record.Value)
+	err := md.db.Put(md.keySpace.key(record.Key), record.Value)
 	return err
 }
 
+// PutTo implement interface
+func (md MemDbDAO) PutTo(batch *Batch, record KeyValue) {
+	batch.put(memDbWriter{db: md.db}, md.keySpace.key(record.Key), record.Value)
+}
+
+// DeleteTo implement interface
+func (md MemDbDAO) DeleteTo(batch *Batch, key []byte) {
+	batch.delete(memDbWriter{db: md.db}, md.keySpace.key(key))
+}
+
+// newIterator iterator over rg of the key space, keys are returned without the key space prefix
+func (md MemDbDAO) newIterator(rg *Range) Iterator {
+	return md.keySpace.iterator(md.db.NewIterator(utilRange(md.keySpace.rg(rg))))
+}
+
+// Iterate implement interface
+func (md MemDbDAO) Iterate(start []byte, limit []byte, reverse bool, fn IterateFunc) error {
+	return iterate(md.newIterator(&Range{Start: start, Limit: limit}), reverse, fn)
+}
+
 // BatchPut implement interface
 func (md MemDbDAO) BatchPut(records []KeyValue) error {
 	for _, item := range records {
-		err := md.db.Put(item.Key, item.Value)
+		err := md.Put(item)
 		if err != nil {
 			return err
 		}
@@ -45,41 +90,41 @@ func (md MemDbDAO) BatchDelete(keys [][]byte) error {
 
 // DeleteByKey implement interface
 func (md MemDbDAO) DeleteByKey(key []byte) error {
-	err := md.db.Delete(key)
+	err := md.db.Delete(md.keySpace.key(key))
 	return err
 }
 
 // CountByKeyPrefix count by key prefix
 func (md MemDbDAO) CountByKeyPrefix(prefix []byte) int {
-	iter := md.db.NewIterator(util.BytesPrefix(prefix))
+	iter := md.newIterator(PrefixRange(prefix))
 	defer iter.Release()
 	return count(iter)
 }
 
 // FindByKeyPrefix implement interface
 func (md MemDbDAO) FindByKeyPrefix(prefix []byte, asc bool, rows int, start int) (int, []KeyValue) {
-	iter := md.db.NewIterator(util.BytesPrefix(prefix))
+	iter := md.newIterator(PrefixRange(prefix))
 	defer iter.Release()
 	return findByKeyPrefix(iter, asc, rows, start)
 }
 
 // FindByRange find by a range
-func (md MemDbDAO) FindByRange(rg *util.Range, asc bool, rows int, start int) (int, []KeyValue) {
-	iter := md.db.NewIterator(rg)
+func (md MemDbDAO) FindByRange(rg *Range, asc bool, rows int, start int) (int, []KeyValue) {
+	iter := md.newIterator(rg)
 	defer iter.Release()
 	return findByKeyPrefix(iter, asc, rows, start)
 }
 
 // CountByRange count total of items
-func (md MemDbDAO) CountByRange(rg *util.Range) int {
-	iter := md.db.NewIterator(rg)
+func (md MemDbDAO) CountByRange(rg *Range) int {
+	iter := md.newIterator(rg)
 	defer iter.Release()
 	return count(iter)
 }
 
 // FindByKey implement interface
 func (md MemDbDAO) FindByKey(key []byte) (*KeyValue, error) {
-	value, err := md.db.Get(key)
+	value, err := md.db.Get(md.keySpace.key(key))
 	if err != nil {
 		return nil, err
 	}
@@ -89,28 +134,28 @@ func (md MemDbDAO) FindByKey(key []byte) (*KeyValue, error) {
 
 // GetNFirstRecords implement interface
 func (md MemDbDAO) GetNFirstRecords(n int) []KeyValue {
-	iter := md.db.NewIterator(nil)
+	iter := md.newIterator(nil)
 	defer iter.Release()
 	return getNFirstRecords(iter, n)
 }
 
 // GetNLastRecords implement interface
 func (md MemDbDAO) GetNLastRecords(n int) []KeyValue {
-	iter := md.db.NewIterator(nil)
+	iter := md.newIterator(nil)
 	defer iter.Release()
 	return getNLastRecords(iter, n)
 }
 
 // GetNFirstPredicate go from first record until predicate evaluation is false
 func (md MemDbDAO) GetNFirstPredicate(prep Predicate) []KeyValue {
-	iter := md.db.NewIterator(nil)
+	iter := md.newIterator(nil)
 	defer iter.Release()
 	return getNFirstPredicate(iter, prep)
 }
 
 // GetAllRecords implement interface
 func (md MemDbDAO) GetAllRecords() []KeyValue {
-	iter := md.db.NewIterator(nil)
+	iter := md.newIterator(nil)
 	defer iter.Release()
 	return getAllRecords(iter)
 }
@@ -0,0 +1,224 @@
+package dao
+
+import (
+	"github.com/cockroachdb/pebble"
+)
+
+// PebbleDAO a dao implementation using pebble, it does not stall writes for compaction like leveldb
+type PebbleDAO struct {
+	db       *pebble.DB
+	keySpace keySpace
+}
+
+// NewPebbleDAO new PebbleDAO instance
+func NewPebbleDAO(db *pebble.DB) PebbleDAO {
+	return PebbleDAO{db: db}
+}
+
+// NewPrefixPebbleDAO PebbleDAO of the keys starting with prefix, the prefix is transparent to callers
+func NewPrefixPebbleDAO(db *pebble.DB, prefix []byte) PebbleDAO {
+	return PebbleDAO{db: db, keySpace: keySpace(prefix)}
+}
+
+// pebbleWriter apply batches to a pebble db in one atomic write
+type pebbleWriter struct {
+	db *pebble.DB
+}
+
+func (pw pebbleWriter) write(ops []batchOp) error {
+	batch := pw.db.NewBatch()
+	defer batch.Close()
+	for _, op := range ops {
+		var err error
+		if op.delete {
+			err = batch.Delete(op.key, nil)
+		} else {
+			err = batch.Set(op.key, op.value, nil)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return batch.Commit(pebble.NoSync)
+}
+
+// Put implement interface
+func (pd PebbleDAO) Put(record KeyValue) error {
+	return pd.db.Set(pd.keySpace.key(record.Key), record.Value, pebble.NoSync)
+}
+
+// BatchPut implement interface
+func (pd PebbleDAO) BatchPut(records []KeyValue) error {
+	batch := NewBatch()
+	for _, item := range records {
+		pd.PutTo(batch, item)
+	}
+	return batch.Commit()
+}
+
+// BatchDelete implement interface
+func (pd PebbleDAO) BatchDelete(keys [][]byte) error {
+	batch := NewBatch()
+	for _, key := range keys {
+		pd.DeleteTo(batch, key)
+	}
+	return batch.Commit()
+}
+
+// PutTo implement interface
+func (pd PebbleDAO) PutTo(batch *Batch, record KeyValue) {
+	batch.put(pebbleWriter{db: pd.db}, pd.keySpace.key(record.Key), record.Value)
+}
+
+// DeleteTo implement interface
+func (pd PebbleDAO) DeleteTo(batch *Batch, key []byte) {
+	batch.delete(pebbleWriter{db: pd.db}, pd.keySpace.key(key))
+}
+
+// DeleteByKey implement interface
+func (pd PebbleDAO) DeleteByKey(key []byte) error {
+	return pd.db.Delete(pd.keySpace.key(key), pebble.NoSync)
+}
+
+// newIterator iterator over rg of the key space, keys are returned without the key space prefix
+func (pd PebbleDAO) newIterator(rg *Range) Iterator {
+	options := &pebble.IterOptions{}
+	if rg = pd.keySpace.rg(rg); rg != nil {
+		options.LowerBound = rg.Start
+		options.UpperBound = rg.Limit
+	}
+	iter, err := pd.db.NewIter(options)
+	if err != nil {
+		return errIterator{err: err}
+	}
+	return pd.keySpace.iterator(&pebbleIterator{iter: iter})
+}
+
+// Iterate implement interface
+func (pd PebbleDAO) Iterate(start []byte, limit []byte, reverse bool, fn IterateFunc) error {
+	return iterate(pd.newIterator(&Range{Start: start, Limit: limit}), reverse, fn)
+}
+
+// CountByKeyPrefix implement interface
+func (pd PebbleDAO) CountByKeyPrefix(prefix []byte) int {
+	iter := pd.newIterator(PrefixRange(prefix))
+	defer iter.Release()
+	return count(iter)
+}
+
+// FindByKeyPrefix implement interface
+func (pd PebbleDAO) FindByKeyPrefix(prefix []byte, asc bool, rows int, start int) (int, []KeyValue) {
+	iter := pd.newIterator(PrefixRange(prefix))
+	defer iter.Release()
+	return findByKeyPrefix(iter, asc, rows, start)
+}
+
+// FindByRange implement interface
+func (pd PebbleDAO) FindByRange(rg *Range, asc bool, rows int, start int) (int, []KeyValue) {
+	iter := pd.newIterator(rg)
+	defer iter.Release()
+	return findByKeyPrefix(iter, asc, rows, start)
+}
+
+// CountByRange implement interface
+func (pd PebbleDAO) CountByRange(rg *Range) int {
+	iter := pd.newIterator(rg)
+	defer iter.Release()
+	return count(iter)
+}
+
+// FindByKey implement interface
+func (pd PebbleDAO) FindByKey(key []byte) (*KeyValue, error) {
+	value, closer, err := pd.db.Get(pd.keySpace.key(key))
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+	kv := CopyKeyValue(key, value)
+	return &kv, nil
+}
+
+// GetNFirstRecords implement interface
+func (pd PebbleDAO) GetNFirstRecords(n int) []KeyValue {
+	iter := pd.newIterator(nil)
+	defer iter.Release()
+	return getNFirstRecords(iter, n)
+}
+
+// GetNLastRecords implement interface
+func (pd PebbleDAO) GetNLastRecords(n int) []KeyValue {
+	iter := pd.newIterator(nil)
+	defer iter.Release()
+	return getNLastRecords(iter, n)
+}
+
+// GetNFirstPredicate implement interface
+func (pd PebbleDAO) GetNFirstPredicate(prep Predicate) []KeyValue {
+	iter := pd.newIterator(nil)
+	defer iter.Release()
+	return getNFirstPredicate(iter, prep)
+}
+
+// GetAllRecords implement interface
+func (pd PebbleDAO) GetAllRecords() []KeyValue {
+	iter := pd.newIterator(nil)
+	defer iter.Release()
+	return getAllRecords(iter)
+}
+
+// pebbleIterator a pebble iterator where the first Next moves to the first record like a leveldb iterator
+type pebbleIterator struct {
+	iter     *pebble.Iterator
+	started  bool
+	released bool
+}
+
+func (pi *pebbleIterator) First() bool {
+	pi.started = true
+	return pi.iter.First()
+}
+
+func (pi *pebbleIterator) Last() bool {
+	pi.started = true
+	return pi.iter.Last()
+}
+
+func (pi *pebbleIterator) Next() bool {
+	if !pi.started {
+		return pi.First()
+	}
+	return pi.iter.Next()
+}
+
+func (pi *pebbleIterator) Prev() bool {
+	if !pi.started {
+		return false
+	}
+	return pi.iter.Prev()
+}
+
+func (pi *pebbleIterator) Key() []byte {
+	if !pi.started || !pi.iter.Valid() {
+		return nil
+	}
+	return pi.iter.Key()
+}
+
+func (pi *pebbleIterator) Value() []byte {
+	if !pi.started || !pi.iter.Valid() {
+		return nil
+	}
+	return pi.iter.Value()
+}
+
+func (pi *pebbleIterator) Error() error {
+	return pi.iter.Error()
+}
+
+func (pi *pebbleIterator) Release() {
+	if pi.released {
+		return
+	}
+	pi.released = true
+	pi.iter.Close()
+}
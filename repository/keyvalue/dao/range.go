@@ -0,0 +1,66 @@
+package dao
+
+// Range keys in [Start, Limit), nil Start is from the first key and nil Limit is up to the last key
+type Range struct {
+	Start []byte
+	Limit []byte
+}
+
+// PrefixRange range of all keys starting with prefix
+func PrefixRange(prefix []byte) *Range {
+	var limit []byte
+	for i := len(prefix) - 1; i >= 0; i-- {
+		if prefix[i] < 0xff {
+			limit = make([]byte, i+1)
+			copy(limit, prefix)
+			limit[i]++
+			break
+		}
+	}
+	return &Range{Start: prefix, Limit: limit}
+}
+
+// Iterator iterator of a backend, the first Next moves to the first record
+type Iterator interface {
+	First() bool
+	Last() bool
+	Next() bool
+	Prev() bool
+	Key() []byte
+	Value() []byte
+	Error() error
+	Release()
+}
+
+// IterateFunc called for every record of Iterate, iteration stops when it returns false.
+// The record is only valid during the call, use CopyKeyValue to keep it.
+type IterateFunc func(record KeyValue) bool
+
+// iterate call fn for records of iter until it returns false, iter is released
+func iterate(iter Iterator, reverse bool, fn IterateFunc) error {
+	defer iter.Release()
+	ok, move := iter.Next(), iter.Next
+	if reverse {
+		ok, move = iter.Last(), iter.Prev
+	}
+	for ; ok; ok = move() {
+		if !fn(KeyValue{Key: iter.Key(), Value: iter.Value()}) {
+			break
+		}
+	}
+	return iter.Error()
+}
+
+// errIterator an empty iterator of a backend that could not create one
+type errIterator struct {
+	err error
+}
+
+func (ei errIterator) First() bool   { return false }
+func (ei errIterator) Last() bool    { return false }
+func (ei errIterator) Next() bool    { return false }
+func (ei errIterator) Prev() bool    { return false }
+func (ei errIterator) Key() []byte   { return nil }
+func (ei errIterator) Value() []byte { return nil }
+func (ei errIterator) Error() error  { return ei.err }
+func (ei errIterator) Release()      {}
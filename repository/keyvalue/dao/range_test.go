@@ -0,0 +1,14 @@
+package dao
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefixRange(t *testing.T) {
+	assert.Equal(t, &Range{Start: []byte("ab"), Limit: []byte("ac")}, PrefixRange([]byte("ab")))
+	assert.Equal(t, &Range{Start: []byte{1, 0xff}, Limit: []byte{2}}, PrefixRange([]byte{1, 0xff}))
+	assert.Equal(t, &Range{Start: []byte{0xff}}, PrefixRange([]byte{0xff}))
+	assert.Equal(t, &Range{Start: []byte{}}, PrefixRange([]byte{}))
+}
@@ -0,0 +1,55 @@
+package dao
+
+import (
+	"github.com/cockroachdb/pebble"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// Snapshot a consistent read-only view of a whole database, writes after it's taken are not visible.
+// Keys include the key space prefixes.
+type Snapshot interface {
+	Iterate(start []byte, limit []byte, reverse bool, fn IterateFunc) error
+	Release()
+}
+
+type levelDbSnapshot struct {
+	snapshot *leveldb.Snapshot
+}
+
+// NewLevelDbSnapshot take a snapshot of a leveldb
+func NewLevelDbSnapshot(db *leveldb.DB) (Snapshot, error) {
+	snapshot, err := db.GetSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	return levelDbSnapshot{snapshot: snapshot}, nil
+}
+
+func (ls levelDbSnapshot) Iterate(start []byte, limit []byte, reverse bool, fn IterateFunc) error {
+	return iterate(ls.snapshot.NewIterator(utilRange(&Range{Start: start, Limit: limit}), nil), reverse, fn)
+}
+
+func (ls levelDbSnapshot) Release() {
+	ls.snapshot.Release()
+}
+
+type pebbleSnapshot struct {
+	snapshot *pebble.Snapshot
+}
+
+// NewPebbleSnapshot take a snapshot of a pebble db
+func NewPebbleSnapshot(db *pebble.DB) (Snapshot, error) {
+	return pebbleSnapshot{snapshot: db.NewSnapshot()}, nil
+}
+
+func (ps pebbleSnapshot) Iterate(start []byte, limit []byte, reverse bool, fn IterateFunc) error {
+	iter, err := ps.snapshot.NewIter(&pebble.IterOptions{LowerBound: start, UpperBound: limit})
+	if err != nil {
+		return err
+	}
+	return iterate(&pebbleIterator{iter: iter}, reverse, fn)
+}
+
+func (ps pebbleSnapshot) Release() {
+	ps.snapshot.Close()
+}
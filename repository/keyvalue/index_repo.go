@@ -1,173 +1,273 @@
 package keyvalue
 
 import (
+	"context"
 	"errors"
 	"math/big"
+	"sync"
 	"time"
 
+	"github.com/WeTrustPlatform/account-indexer/common"
 	"github.com/WeTrustPlatform/account-indexer/core/types"
+	"github.com/WeTrustPlatform/account-indexer/repository"
 	"github.com/WeTrustPlatform/account-indexer/repository/keyvalue/dao"
 	"github.com/WeTrustPlatform/account-indexer/repository/keyvalue/marshal"
 	log "github.com/sirupsen/logrus"
-	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
 // KVIndexRepo implementation of IndexRepo
 type KVIndexRepo struct {
 	addressDAO dao.KeyValueDAO
 	blockDAO   dao.KeyValueDAO
+	// rangeDAO contiguous ranges of blocks indexed in realtime, key is the first block and value the last one
+	rangeDAO dao.KeyValueDAO
+	// counterDAO number of address records per address and per address and day, see address_counter.go
+	counterDAO dao.KeyValueDAO
+	// counterMutex counters are read and written under this lock from the time a batch is committed until it's written,
+	// so that concurrent batches do not lose updates. Chains have their own repo and lock, a chain should have a single repo
+	counterMutex sync.Mutex
+	// extraDAO fields of transactions kept for --extras, key is the tx hash, see tx_extra.go
+	extraDAO   dao.KeyValueDAO
 	marshaller marshal.Marshaller
+	// listeners of OnAddressesChanged
+	listeners     []func(addresses []string)
+	listenerMutex sync.RWMutex
 }
 
 // NewKVIndexRepo create an instance of KVIndexRepo
-func NewKVIndexRepo(addressDAO dao.KeyValueDAO, blockDAO dao.KeyValueDAO) *KVIndexRepo {
+func NewKVIndexRepo(addressDAO dao.KeyValueDAO, blockDAO dao.KeyValueDAO, rangeDAO dao.KeyValueDAO, counterDAO dao.KeyValueDAO, extraDAO dao.KeyValueDAO) *KVIndexRepo {
 	return &KVIndexRepo{
 		addressDAO: addressDAO,
 		blockDAO:   blockDAO,
+		rangeDAO:   rangeDAO,
+		counterDAO: counterDAO,
+		extraDAO:   extraDAO,
 		marshaller: marshal.ByteMarshaller{},
 	}
 }
 
-// Store implements IndexRepo
+// NewWriteBatch implements IndexRepo
+func (repo *KVIndexRepo) NewWriteBatch() repository.WriteBatch {
+	return dao.NewBatch()
+}
+
+// Store implements IndexRepo, reorg deletes, address records and the block record are written atomically
 func (repo *KVIndexRepo) Store(addressIndex []*types.AddressIndex, blockIndex *types.BlockIndex, isBatch bool) error {
+	wb := repo.NewWriteBatch()
+	err := repo.StoreIn(wb, addressIndex, blockIndex, isBatch)
+	if err != nil {
+		return err
+	}
+	err = wb.Commit()
+	if err != nil {
+		panic(errors.New("Cannot write block " + blockIndex.BlockNumber + " to leveldb. Error: " + err.Error()))
+	}
+	return err
+}
+
+// StoreIn implements IndexRepo
+func (repo *KVIndexRepo) StoreIn(wb repository.WriteBatch, addressIndex []*types.AddressIndex, blockIndex *types.BlockIndex, isBatch bool) error {
+	batch, err := daoBatch(wb)
+	if err != nil {
+		return err
+	}
 	if !isBatch {
 		oldBlock, err := repo.blockDAO.FindByKey([]byte(blockIndex.BlockNumber))
 		if err == nil && oldBlock != nil {
 			blockIndex := repo.marshaller.UnmarshallBlockValue(oldBlock.Value)
 			if blockIndex.Addresses != nil && len(blockIndex.Addresses) > 0 {
-				blockTime := blockIndex.Time
-				reorgAddresses := blockIndex.Addresses
-				err = repo.HandleReorg(blockTime, reorgAddresses)
-				if err != nil {
-					log.WithField("error", err.Error).Error("Cannot handle reorg")
-					return err
-				}
+				repo.handleReorgIn(batch, blockIndex.Time, blockIndex.Addresses)
 			}
 		}
 	}
 
-	// AddressDB: write in batch
-	err := repo.SaveAddressIndex(addressIndex)
-	if err != nil {
-		log.WithField("error", err.Error).Error("Cannot save address index")
-		return err
+	repo.saveAddressIndexIn(batch, addressIndex)
+	if !isBatch {
+		repo.saveBlockIndexIn(batch, blockIndex)
+		blockNumber, ok := new(big.Int).SetString(blockIndex.BlockNumber, 10)
+		if !ok {
+			return errors.New("invalid block number " + blockIndex.BlockNumber)
+		}
+		repo.markIndexedIn(batch, blockNumber.Int64())
 	}
+	return nil
+}
 
-	// BlockDB: write a single record
-	if !isBatch {
-		err = repo.SaveBlockIndex(blockIndex)
-		if err != nil {
-			log.WithField("error", err.Error).Error("Cannot save block index")
+// markIndexedIn add a block to the indexed ranges, it's merged with the ranges right before and after it
+func (repo *KVIndexRepo) markIndexedIn(batch *dao.Batch, blockNumber int64) {
+	from, to := blockNumber, blockNumber
+	covered := false
+	// the range with the largest first block that is not after blockNumber
+	limit := repo.marshaller.MarshallRangeBlock(blockNumber + 1)
+	err := repo.rangeDAO.Iterate(nil, limit, true, func(keyValue dao.KeyValue) bool {
+		prevFrom := repo.marshaller.UnmarshallRangeBlock(keyValue.Key)
+		prevTo := repo.marshaller.UnmarshallRangeBlock(keyValue.Value)
+		if prevTo >= blockNumber {
+			covered = true
+		} else if prevTo == blockNumber-1 {
+			from = prevFrom
 		}
+		return false
+	})
+	if err != nil {
+		panic(errors.New("Cannot read range leveldb. Error: " + err.Error()))
 	}
-	return err
+	if covered {
+		return
+	}
+	nextKey := repo.marshaller.MarshallRangeBlock(blockNumber + 1)
+	if next, err := repo.rangeDAO.FindByKey(nextKey); err == nil && next != nil {
+		to = repo.marshaller.UnmarshallRangeBlock(next.Value)
+		repo.rangeDAO.DeleteTo(batch, nextKey)
+	}
+	key := repo.marshaller.MarshallRangeBlock(from)
+	value := repo.marshaller.MarshallRangeBlock(to)
+	repo.rangeDAO.PutTo(batch, dao.NewKeyValue(key, value))
+}
+
+// GetIndexedRanges implements IndexRepo
+func (repo *KVIndexRepo) GetIndexedRanges() []types.BlockRange {
+	result := []types.BlockRange{}
+	err := repo.rangeDAO.Iterate(nil, nil, false, func(keyValue dao.KeyValue) bool {
+		result = append(result, types.BlockRange{
+			From: repo.marshaller.UnmarshallRangeBlock(keyValue.Key),
+			To:   repo.marshaller.UnmarshallRangeBlock(keyValue.Value),
+		})
+		return true
+	})
+	if err != nil {
+		panic(errors.New("Cannot read range leveldb. Error: " + err.Error()))
+	}
+	return result
 }
 
 // SaveAddressIndex save to address db
 func (repo *KVIndexRepo) SaveAddressIndex(addressIndex []*types.AddressIndex) error {
-	keyValues := []dao.KeyValue{}
-	for _, item := range addressIndex {
-		key := repo.marshaller.MarshallAddressKey(item)
-		value := repo.marshaller.MarshallAddressValue(item)
-		keyValue := dao.NewKeyValue(key, value)
-		keyValues = append(keyValues, keyValue)
-	}
-	err := repo.addressDAO.BatchPut(keyValues)
+	batch := dao.NewBatch()
+	repo.saveAddressIndexIn(batch, addressIndex)
+	err := batch.Commit()
 	if err != nil {
 		panic(errors.New("Cannot write to address leveldb. Error: " + err.Error()))
 	}
 	return err
 }
 
+func (repo *KVIndexRepo) saveAddressIndexIn(batch *dao.Batch, addressIndex []*types.AddressIndex) {
+	for _, item := range addressIndex {
+		key := repo.marshaller.MarshallAddressKey(item)
+		value := repo.marshaller.MarshallAddressValue(item)
+		repo.putAddressTo(batch, dao.NewKeyValue(key, value))
+	}
+}
+
 // SaveBlockIndex save to block db
 func (repo *KVIndexRepo) SaveBlockIndex(blockIndex *types.BlockIndex) error {
-	key := repo.marshaller.MarshallBlockKey(blockIndex.BlockNumber)
-	value := repo.marshaller.MarshallBlockValue(blockIndex)
-	err := repo.blockDAO.Put(dao.NewKeyValue(key, value))
+	batch := dao.NewBatch()
+	repo.saveBlockIndexIn(batch, blockIndex)
+	err := batch.Commit()
 	if err != nil {
 		panic(errors.New("Cannot write to block leveldb. Error: " + err.Error()))
 	}
 	return err
 }
 
+func (repo *KVIndexRepo) saveBlockIndexIn(batch *dao.Batch, blockIndex *types.BlockIndex) {
+	key := repo.marshaller.MarshallBlockKey(blockIndex.BlockNumber)
+	value := repo.marshaller.MarshallBlockValue(blockIndex)
+	repo.blockDAO.PutTo(batch, dao.NewKeyValue(key, value))
+}
+
 // GetTotalTransaction get total transaction of an account
 func (repo *KVIndexRepo) GetTotalTransaction(address string, fromTime time.Time, toTime time.Time) int {
-	prefix := repo.marshaller.MarshallAddressKeyPrefix(address)
-	hasFrom := !time.Time.IsZero(fromTime)
-	hasTo := !time.Time.IsZero(toTime)
-	if hasFrom || hasTo {
-		// assuming fromTime and toTime is good
-		// make toTime inclusive
-		allTimeRange := util.BytesPrefix(prefix)
-		fromPrefix := repo.marshaller.MarshallAddressKeyPrefix3(address, fromTime)
-		newToTime := toTime.Add(1 * time.Second)
-		toPrefix := repo.marshaller.MarshallAddressKeyPrefix3(address, newToTime)
-		var rg *util.Range
-		if !hasFrom {
-			rg = &util.Range{Start: allTimeRange.Start, Limit: toPrefix}
-		} else if !hasTo {
-			rg = &util.Range{Start: fromPrefix, Limit: allTimeRange.Limit}
-		} else {
-			rg = &util.Range{Start: fromPrefix, Limit: toPrefix}
-		}
-		total := repo.addressDAO.CountByRange(rg)
-		return total
-	}
-	// Search by address as LevelDB prefix
+	total, _ := repo.CountTransactions(context.Background(), address, fromTime, toTime, 0)
+	return total
+}
+
+// CountTransactions implements IndexRepo
+func (repo *KVIndexRepo) CountTransactions(ctx context.Context, address string, fromTime time.Time, toTime time.Time, budget int) (int, bool) {
 	// bad address
-	if len(prefix) == 0 {
-		return 0
+	if len(repo.marshaller.MarshallAddressKeyPrefix(address)) == 0 {
+		return 0, false
 	}
-	total := repo.addressDAO.CountByKeyPrefix(prefix)
-	return total
+	return repo.countAddress(ctx, address, fromTime, toTime, budget)
 }
 
 // GetTransactionByAddress main thing for this indexer
 func (repo *KVIndexRepo) GetTransactionByAddress(address string, rows int, start int, fromTime time.Time, toTime time.Time) (int, []types.AddressIndex) {
-	convertKeyValuesToAddressIndexes := func(keyValues []dao.KeyValue) []types.AddressIndex {
-		result := []types.AddressIndex{}
-		for _, keyValue := range keyValues {
-			addressIndex := repo.keyValueToAddressIndex(keyValue)
-			result = append(result, addressIndex)
+	total, _, addressIndexes := repo.FindTransactions(context.Background(), address, rows, start, fromTime, toTime, 0)
+	return total, addressIndexes
+}
+
+// FindTransactions implements IndexRepo, records are the newest first without time range and the oldest first with it.
+// The total comes from counters, without them counting stops after common.NumMaxTransaction records
+// and the total is approximate then.
+func (repo *KVIndexRepo) FindTransactions(ctx context.Context, address string, rows int, start int, fromTime time.Time, toTime time.Time, budget int) (int, bool, []types.AddressIndex) {
+	addressIndexes := []types.AddressIndex{}
+	// bad address
+	if len(repo.marshaller.MarshallAddressKeyPrefix(address)) == 0 {
+		return 0, false, addressIndexes
+	}
+	countersReady := repo.CountersReady()
+	// Search by address as LevelDB prefix, the newest first
+	reverse := time.Time.IsZero(fromTime) && time.Time.IsZero(toTime)
+	read := 0
+	capped := false
+	complete := repo.scanAddress(ctx, repo.addressRange(address, fromTime, toTime), reverse, budget, func(keyValue dao.KeyValue) bool {
+		if read >= start && len(addressIndexes) < rows {
+			addressIndexes = append(addressIndexes, repo.keyValueToAddressIndex(dao.CopyKeyValue(keyValue.Key, keyValue.Value)))
+		}
+		read++
+		if countersReady {
+			return len(addressIndexes) < rows
+		}
+		// Due to the nature of LevelDB, don't want to loop thru the result if it's a lot
+		capped = read > common.NumMaxTransaction
+		return !capped
+	})
+	if !countersReady {
+		if capped {
+			return common.NumMaxTransaction, true, addressIndexes
 		}
-		return result
+		return read, !complete, addressIndexes
 	}
+	total, approximate := repo.countAddress(ctx, address, fromTime, toTime, budget)
+	return total, approximate || !complete, addressIndexes
+}
 
-	prefix := repo.marshaller.MarshallAddressKeyPrefix(address)
-	hasFrom := !time.Time.IsZero(fromTime)
-	hasTo := !time.Time.IsZero(toTime)
-	if hasFrom || hasTo {
-		// assuming fromTime and toTime is good
-		// make toTime inclusive
-		allTimeRange := util.BytesPrefix(prefix)
-		fromPrefix := repo.marshaller.MarshallAddressKeyPrefix3(address, fromTime)
-		newToTime := toTime.Add(1 * time.Second)
-		toPrefix := repo.marshaller.MarshallAddressKeyPrefix3(address, newToTime)
-		var rg *util.Range
-		if !hasFrom {
-			rg = &util.Range{Start: allTimeRange.Start, Limit: toPrefix}
-		} else if !hasTo {
-			rg = &util.Range{Start: fromPrefix, Limit: allTimeRange.Limit}
-		} else {
-			rg = &util.Range{Start: fromPrefix, Limit: toPrefix}
-		}
+// scanAddressCheckEvery number of records read between two checks of the deadline of a scan
+const scanAddressCheckEvery = 256
 
-		asc := true
-		total, keyValues := repo.addressDAO.FindByRange(rg, asc, rows, start)
-		addressIndexes := convertKeyValuesToAddressIndexes(keyValues)
-		return total, addressIndexes
+// scanAddress call fn for address records of rg until it returns false. It stops early after reading budget records
+// (0 for no limit) or when ctx is done, it returns false then.
+func (repo *KVIndexRepo) scanAddress(ctx context.Context, rg *dao.Range, reverse bool, budget int, fn dao.IterateFunc) bool {
+	read := 0
+	complete := true
+	err := repo.addressDAO.Iterate(rg.Start, rg.Limit, reverse, func(keyValue dao.KeyValue) bool {
+		if (budget > 0 && read >= budget) || (read%scanAddressCheckEvery == 0 && ctx.Err() != nil) {
+			complete = false
+			return false
+		}
+		read++
+		return fn(keyValue)
+	})
+	if err != nil {
+		log.WithField("error", err.Error()).Error("KVIndexRepo: cannot scan address records")
 	}
-	// Search by address as LevelDB prefix
+	return complete
+}
 
-	// bad address
-	if len(prefix) == 0 {
-		return 0, []types.AddressIndex{}
+// addressRange range of address records of an address from fromTime to toTime (inclusive), a zero time is unbounded
+func (repo *KVIndexRepo) addressRange(address string, fromTime time.Time, toTime time.Time) *dao.Range {
+	// assuming fromTime and toTime is good
+	rg := dao.PrefixRange(repo.marshaller.MarshallAddressKeyPrefix(address))
+	if !time.Time.IsZero(fromTime) {
+		rg.Start = repo.marshaller.MarshallAddressKeyPrefix3(address, fromTime)
 	}
-	asc := false
-	total, keyValues := repo.addressDAO.FindByKeyPrefix(prefix, asc, rows, start)
-	addressIndexes := convertKeyValuesToAddressIndexes(keyValues)
-
-	return total, addressIndexes
+	if !time.Time.IsZero(toTime) {
+		// make toTime inclusive
+		rg.Limit = repo.marshaller.MarshallAddressKeyPrefix3(address, toTime.Add(1*time.Second))
+	}
+	return rg
 }
 
 func (repo *KVIndexRepo) keyValueToAddressIndex(keyValue dao.KeyValue) types.AddressIndex {
@@ -180,18 +280,49 @@ func (repo *KVIndexRepo) keyValueToAddressIndex(keyValue dao.KeyValue) types.Add
 	return addressIndex
 }
 
+// GetAddressIndexesAt implements IndexRepo
+func (repo *KVIndexRepo) GetAddressIndexesAt(address string, blockTime *big.Int) []types.AddressIndex {
+	result := []types.AddressIndex{}
+	prefix := repo.marshaller.MarshallAddressKeyPrefix2(address, blockTime)
+	err := repo.addressDAO.Iterate(prefix, dao.PrefixRange(prefix).Limit, false, func(keyValue dao.KeyValue) bool {
+		addressIndex := repo.keyValueToAddressIndex(keyValue)
+		// the last byte of the key is the sequence
+		addressIndex.Sequence = keyValue.Key[len(keyValue.Key)-1]
+		result = append(result, addressIndex)
+		return true
+	})
+	if err != nil {
+		panic(errors.New("Cannot read address leveldb. Error: " + err.Error()))
+	}
+	return result
+}
+
+// RepairAddressIndex implements IndexRepo
+func (repo *KVIndexRepo) RepairAddressIndex(save []*types.AddressIndex, remove []types.AddressIndex) error {
+	batch := dao.NewBatch()
+	for _, item := range remove {
+		repo.deleteAddressTo(batch, repo.marshaller.MarshallAddressKey(&item))
+	}
+	repo.saveAddressIndexIn(batch, save)
+	return batch.Commit()
+}
+
 // HandleReorg handle reorg scenario: get block again
 func (repo *KVIndexRepo) HandleReorg(blockTime *big.Int, reorgAddresses []types.AddressSequence) error {
-	keys := [][]byte{}
+	batch := dao.NewBatch()
+	repo.handleReorgIn(batch, blockTime, reorgAddresses)
+	return batch.Commit()
+}
+
+// handleReorgIn delete address records of a block that is indexed again
+func (repo *KVIndexRepo) handleReorgIn(batch *dao.Batch, blockTime *big.Int, reorgAddresses []types.AddressSequence) {
 	for _, address := range reorgAddresses {
 		// Block database save address and max sequence as value
 		for i := uint8(1); i <= address.Sequence; i++ {
 			addressIndexKey := repo.marshaller.MarshallAddressKeyStr(address.Address, blockTime, i)
-			keys = append(keys, addressIndexKey)
+			repo.deleteAddressTo(batch, addressIndexKey)
 		}
 	}
-	err := repo.addressDAO.BatchDelete(keys)
-	return err
 }
 
 // GetLastBlock latest saved block in newHead block DB
@@ -214,17 +345,20 @@ func (repo *KVIndexRepo) GetFirstBlock() (types.BlockIndex, error) {
 
 // DeleteOldBlocks delete blocks where CreatedAt < untilTime
 func (repo *KVIndexRepo) DeleteOldBlocks(untilTime *big.Int) (int, error) {
-	pre := func(keyValue dao.KeyValue) bool {
-		blockIndex := repo.keyValueToBlockIndex(keyValue)
-		return blockIndex.CreatedAt.Cmp(untilTime) < 0
-	}
-	kvsToDel := repo.blockDAO.GetNFirstPredicate(pre)
 	keys := [][]byte{}
-	for _, kv := range kvsToDel {
-		keys = append(keys, kv.Key)
+	err := repo.blockDAO.Iterate(nil, nil, false, func(keyValue dao.KeyValue) bool {
+		blockIndex := repo.marshaller.UnmarshallBlockValue(keyValue.Value)
+		if blockIndex.CreatedAt.Cmp(untilTime) >= 0 {
+			return false
+		}
+		keys = append(keys, append([]byte{}, keyValue.Key...))
+		return true
+	})
+	if err != nil {
+		return 0, err
 	}
-	err := repo.blockDAO.BatchDelete(keys)
-	return len(kvsToDel), err
+	err = repo.blockDAO.BatchDelete(keys)
+	return len(keys), err
 }
 
 func (repo *KVIndexRepo) keyValueToBlockIndex(keyValue dao.KeyValue) types.BlockIndex {
@@ -1,6 +1,7 @@
 package keyvalue
 
 import (
+	"context"
 	"math/big"
 	"reflect"
 	"testing"
@@ -91,24 +92,54 @@ func TestBatch(t *testing.T) {
 
 type RepositoryTestSuite struct {
 	suite.Suite
-	repo *KVIndexRepo
+	// backend "memdb" for separate memdbs per DAO
+	backend string
+	db      *DB
+	repo    *KVIndexRepo
 }
 
+// TestRepository run the tests against every backend
 func TestRepository(t *testing.T) {
-	suite.Run(t, new(RepositoryTestSuite))
+	for _, backend := range []string{"memdb", BackendLevelDb, BackendPebble} {
+		t.Run(backend, func(t *testing.T) {
+			suite.Run(t, &RepositoryTestSuite{backend: backend})
+		})
+	}
 }
 
 func (suite *RepositoryTestSuite) SetupTest() {
-	addressDB := memdb.New(comparer.DefaultComparer, 0)
-	addressDAO := dao.NewMemDbDAO(addressDB)
-	blockDB := memdb.New(comparer.DefaultComparer, 0)
-	blockDAO := dao.NewMemDbDAO(blockDB)
-	repo := NewKVIndexRepo(addressDAO, blockDAO)
+	var repo *KVIndexRepo
+	if suite.backend == "memdb" {
+		addressDB := memdb.New(comparer.DefaultComparer, 0)
+		addressDAO := dao.NewMemDbDAO(addressDB)
+		blockDB := memdb.New(comparer.DefaultComparer, 0)
+		blockDAO := dao.NewMemDbDAO(blockDB)
+		rangeDB := memdb.New(comparer.DefaultComparer, 0)
+		rangeDAO := dao.NewMemDbDAO(rangeDB)
+		counterDB := memdb.New(comparer.DefaultComparer, 0)
+		counterDAO := dao.NewMemDbDAO(counterDB)
+		extraDB := memdb.New(comparer.DefaultComparer, 0)
+		extraDAO := dao.NewMemDbDAO(extraDB)
+		repo = NewKVIndexRepo(addressDAO, blockDAO, rangeDAO, counterDAO, extraDAO)
+	} else {
+		db, err := OpenDB(suite.backend, suite.T().TempDir())
+		assert.Nil(suite.T(), err)
+		suite.db = db
+		repo, _ = db.Repos()
+	}
 	suite.repo = repo
-	err := repo.Store(addressIndexes, blockIndex, false)
+	_, err := repo.RebuildCounters()
+	assert.Nil(suite.T(), err)
+	err = repo.Store(addressIndexes, blockIndex, false)
 	assert.Nil(suite.T(), err)
 }
 
+func (suite *RepositoryTestSuite) TearDownTest() {
+	if suite.db != nil {
+		suite.db.Close()
+	}
+}
+
 func (suite *RepositoryTestSuite) TestGetTransactionByAddress() {
 	fromTime := time.Time{}
 	toTime := time.Time{}
@@ -120,14 +151,16 @@ func (suite *RepositoryTestSuite) TestGetTransactionByAddress() {
 
 	assertAddresses := func(asc bool) {
 		// sort is desc, returned sequence is always 0 for now
-		addressIndexes[3].AddressSequence.Sequence = 0
-		addressIndexes[1].AddressSequence.Sequence = 0
+		address1 := *addressIndexes[1]
+		address1.AddressSequence.Sequence = 0
+		address3 := *addressIndexes[3]
+		address3.AddressSequence.Sequence = 0
 		if asc {
-			assert.True(suite.T(), reflect.DeepEqual(*addressIndexes[1], addresses[0]))
-			assert.True(suite.T(), reflect.DeepEqual(*addressIndexes[3], addresses[1]))
+			assert.True(suite.T(), reflect.DeepEqual(address1, addresses[0]))
+			assert.True(suite.T(), reflect.DeepEqual(address3, addresses[1]))
 		} else {
-			assert.True(suite.T(), reflect.DeepEqual(*addressIndexes[3], addresses[0]))
-			assert.True(suite.T(), reflect.DeepEqual(*addressIndexes[1], addresses[1]))
+			assert.True(suite.T(), reflect.DeepEqual(address3, addresses[0]))
+			assert.True(suite.T(), reflect.DeepEqual(address1, addresses[1]))
 		}
 
 	}
@@ -169,6 +202,43 @@ func (suite *RepositoryTestSuite) TestGetTransactionByAddress() {
 	assert.Equal(suite.T(), 0, total)
 }
 
+func (suite *RepositoryTestSuite) TestQueryLimits() {
+	noTime := time.Time{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// totals come from counters, only the page is read
+	total, approximate := suite.repo.CountTransactions(ctx, to1, noTime, noTime, 1)
+	assert.Equal(suite.T(), 2, total)
+	assert.False(suite.T(), approximate)
+	total, approximate, addresses := suite.repo.FindTransactions(context.Background(), to1, 1, 0, noTime, noTime, 1)
+	assert.Equal(suite.T(), 2, total)
+	assert.False(suite.T(), approximate)
+	assert.Equal(suite.T(), tx2, addresses[0].TxHash)
+
+	// without counters records are counted within the budget and the deadline, to1 has 2 records
+	assert.Nil(suite.T(), suite.repo.counterDAO.DeleteByKey(countersReadyKey))
+	total, approximate = suite.repo.CountTransactions(context.Background(), to1, noTime, noTime, 2)
+	assert.Equal(suite.T(), 2, total)
+	assert.False(suite.T(), approximate)
+	total, approximate = suite.repo.CountTransactions(context.Background(), to1, noTime, noTime, 1)
+	assert.Equal(suite.T(), 1, total)
+	assert.True(suite.T(), approximate)
+
+	total, approximate, addresses = suite.repo.FindTransactions(context.Background(), to1, 10, 0, noTime, noTime, 1)
+	assert.Equal(suite.T(), 1, total)
+	assert.True(suite.T(), approximate)
+	assert.Equal(suite.T(), tx2, addresses[0].TxHash)
+
+	// a query after its deadline returns nothing
+	total, approximate = suite.repo.CountTransactions(ctx, to1, noTime, noTime, 0)
+	assert.Equal(suite.T(), 0, total)
+	assert.True(suite.T(), approximate)
+	total, approximate, addresses = suite.repo.FindTransactions(ctx, to1, 10, 0, noTime, noTime, 0)
+	assert.Equal(suite.T(), 0, total)
+	assert.True(suite.T(), approximate)
+	assert.Equal(suite.T(), 0, len(addresses))
+}
+
 func (suite *RepositoryTestSuite) TestGetLastBlock() {
 	block, err := suite.repo.GetLastBlock()
 	assert.Nil(suite.T(), err)
@@ -195,6 +265,26 @@ func (suite *RepositoryTestSuite) TestGetBlocks() {
 	assert.Equal(suite.T(), "2018", blocks[0].BlockNumber)
 }
 
+func (suite *RepositoryTestSuite) TestGetIndexedRanges() {
+	// SetupTest stored block 2018
+	assert.Equal(suite.T(), []types.BlockRange{{From: 2018, To: 2018}}, suite.repo.GetIndexedRanges())
+	store := func(blockNumber int64, isBatch bool) {
+		block := &types.BlockIndex{BlockNumber: big.NewInt(blockNumber).String(), Time: blockTime, CreatedAt: blockTime}
+		assert.Nil(suite.T(), suite.repo.Store([]*types.AddressIndex{}, block, isBatch))
+	}
+	store(2020, false)
+	store(2021, false)
+	// batch blocks are tracked by batch statuses
+	store(2019, true)
+	assert.Equal(suite.T(), []types.BlockRange{{From: 2018, To: 2018}, {From: 2020, To: 2021}}, suite.repo.GetIndexedRanges())
+	// a block between two ranges merges them, a block indexed again changes nothing
+	store(2019, false)
+	store(2020, false)
+	store(2017, false)
+	store(2030, false)
+	assert.Equal(suite.T(), []types.BlockRange{{From: 2017, To: 2021}, {From: 2030, To: 2030}}, suite.repo.GetIndexedRanges())
+}
+
 func (suite *RepositoryTestSuite) TestDeleteOldBlocks() {
 	blockTimeT := common.UnmarshallIntToTime(blockTime)
 	oldTime := blockTimeT.Add(-5 * time.Hour)
@@ -0,0 +1,100 @@
+package keyvalue
+
+import (
+	"errors"
+
+	"github.com/WeTrustPlatform/account-indexer/common"
+	"github.com/WeTrustPlatform/account-indexer/repository"
+	"github.com/WeTrustPlatform/account-indexer/repository/keyvalue/dao"
+	"github.com/cockroachdb/pebble"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/memdb"
+)
+
+// Key spaces of the single database, a block's address records, block record and batch progress
+// are committed in one atomic write
+var (
+	AddressKeySpace = []byte("a")
+	BlockKeySpace   = []byte("b")
+	BatchKeySpace   = []byte("s")
+	RangeKeySpace   = []byte("r")
+	CounterKeySpace = []byte("n")
+	ExtraKeySpace   = []byte("x")
+)
+
+// APIKeySpace key space of the keys of the public api, they are shared by all chains
+var APIKeySpace = []byte("k")
+
+// chainNamespacePrefix first byte of the namespaces of chains
+const chainNamespacePrefix = "c"
+
+// ChainNamespace prefix of the key spaces of a chain, "c<chainID>/". The default chain has no prefix
+// so a single chain database keeps its key spaces.
+func ChainNamespace(chainID string) []byte {
+	if chainID == common.DefaultChainID {
+		return nil
+	}
+	return []byte(chainNamespacePrefix + chainID + "/")
+}
+
+// NewRepos index and batch repositories in the key spaces of a database, newDAO creates the DAO of a key space
+func NewRepos(newDAO func(keySpace []byte) dao.KeyValueDAO) (*KVIndexRepo, *KVBatchRepo) {
+	indexRepo := NewKVIndexRepo(newDAO(AddressKeySpace), newDAO(BlockKeySpace), newDAO(RangeKeySpace), newDAO(CounterKeySpace), newDAO(ExtraKeySpace))
+	batchRepo := NewKVBatchRepo(newDAO(BatchKeySpace))
+	return indexRepo, batchRepo
+}
+
+// NewLevelDbRepos index and batch repositories sharing a leveldb
+func NewLevelDbRepos(db *leveldb.DB) (*KVIndexRepo, *KVBatchRepo) {
+	return NewRepos(func(keySpace []byte) dao.KeyValueDAO {
+		return dao.NewPrefixLevelDbDAO(db, keySpace)
+	})
+}
+
+// NewMemDbRepos index and batch repositories sharing a memdb
+func NewMemDbRepos(db *memdb.DB) (*KVIndexRepo, *KVBatchRepo) {
+	return NewRepos(func(keySpace []byte) dao.KeyValueDAO {
+		return dao.NewPrefixMemDbDAO(db, keySpace)
+	})
+}
+
+// NewPebbleRepos index and batch repositories sharing a pebble db
+func NewPebbleRepos(db *pebble.DB) (*KVIndexRepo, *KVBatchRepo) {
+	return NewRepos(func(keySpace []byte) dao.KeyValueDAO {
+		return dao.NewPrefixPebbleDAO(db, keySpace)
+	})
+}
+
+// daoBatch the dao batch of a WriteBatch created by a key-value repository
+func daoBatch(wb repository.WriteBatch) (*dao.Batch, error) {
+	batch, ok := wb.(*dao.Batch)
+	if !ok {
+		return nil, errors.New("write batch is not created by a key-value repository")
+	}
+	return batch, nil
+}
+
+// migrateBatchSize number of records copied in a write
+const migrateBatchSize = 10000
+
+// MigrateLevelDb copy all records of a leveldb of older versions into target, the DAO of a key space.
+// It returns the number of copied records, copying again is harmless so an interrupted migration can be restarted.
+func MigrateLevelDb(target dao.KeyValueDAO, oldDB *leveldb.DB) (int, error) {
+	iter := oldDB.NewIterator(nil, nil)
+	defer iter.Release()
+	total := 0
+	batch := dao.NewBatch()
+	for iter.Next() {
+		target.PutTo(batch, dao.NewKeyValue(iter.Key(), iter.Value()))
+		total++
+		if batch.Len() >= migrateBatchSize {
+			if err := batch.Commit(); err != nil {
+				return total, err
+			}
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return total, err
+	}
+	return total, batch.Commit()
+}
@@ -0,0 +1,72 @@
+package keyvalue
+
+import (
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/WeTrustPlatform/account-indexer/common"
+	"github.com/WeTrustPlatform/account-indexer/core/types"
+	"github.com/WeTrustPlatform/account-indexer/repository/keyvalue/dao"
+	"github.com/stretchr/testify/assert"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+func TestMigrateLevelDb(t *testing.T) {
+	dir := t.TempDir()
+	oldDB, err := leveldb.OpenFile(filepath.Join(dir, "db_block"), nil)
+	assert.Nil(t, err)
+	defer oldDB.Close()
+	db, err := leveldb.OpenFile(filepath.Join(dir, "db"), nil)
+	assert.Nil(t, err)
+	defer db.Close()
+	repo := NewKVIndexRepo(nil, nil, nil, nil, nil)
+	for _, blockNumber := range []string{"10", "11", "12"} {
+		blockIndex := &types.BlockIndex{BlockNumber: blockNumber, Time: big.NewInt(1), CreatedAt: big.NewInt(1)}
+		key := repo.marshaller.MarshallBlockKey(blockNumber)
+		assert.Nil(t, oldDB.Put(key, repo.marshaller.MarshallBlockValue(blockIndex), nil))
+	}
+
+	total, err := MigrateLevelDb(dao.NewPrefixLevelDbDAO(db, BlockKeySpace), oldDB)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, total)
+	// migrating again is harmless
+	total, err = MigrateLevelDb(dao.NewPrefixLevelDbDAO(db, BlockKeySpace), oldDB)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, total)
+
+	indexRepo, batchRepo := NewLevelDbRepos(db)
+	total, blocks := indexRepo.GetBlocks("", 10, 0)
+	assert.Equal(t, 3, total)
+	assert.Equal(t, "12", blocks[0].BlockNumber)
+	assert.Equal(t, 0, len(batchRepo.GetAllBatchStatuses()))
+}
+
+func TestChainRepos(t *testing.T) {
+	db, err := OpenDB(BackendLevelDb, filepath.Join(t.TempDir(), "db"))
+	assert.Nil(t, err)
+	defer db.Close()
+	assert.Nil(t, ChainNamespace(common.DefaultChainID))
+	assert.Equal(t, []byte("c3/"), ChainNamespace("3"))
+
+	saveTestBlocks(t, db, 10)
+	defaultRepo, _ := db.ChainRepos(common.DefaultChainID)
+	chainRepo, chainBatchRepo := db.ChainRepos("3")
+	blockIndex := &types.BlockIndex{BlockNumber: "20", Time: big.NewInt(20), CreatedAt: big.NewInt(20)}
+	assert.Nil(t, chainRepo.Store([]*types.AddressIndex{}, blockIndex, false))
+	now := big.NewInt(time.Now().Unix())
+	assert.Nil(t, chainBatchRepo.UpdateBatch(types.BatchStatus{From: big.NewInt(0), To: big.NewInt(5), Step: 1, CreatedAt: now, UpdatedAt: now}))
+
+	// the default chain has the key spaces of a single chain database
+	total, blocks := defaultRepo.GetBlocks("", 10, 0)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, "10", blocks[0].BlockNumber)
+	total, blocks = chainRepo.GetBlocks("", 10, 0)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, "20", blocks[0].BlockNumber)
+	assert.Equal(t, []types.BlockRange{{From: 20, To: 20}}, chainRepo.GetIndexedRanges())
+	_, defaultBatchRepo := db.Repos()
+	assert.Equal(t, 0, len(defaultBatchRepo.GetAllBatchStatuses()))
+	assert.Equal(t, 1, len(chainBatchRepo.GetAllBatchStatuses()))
+}
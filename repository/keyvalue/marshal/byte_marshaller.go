@@ -2,6 +2,7 @@ package marshal
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"math/big"
 	"time"
@@ -139,6 +140,11 @@ func (bm ByteMarshaller) MarshallAddressValue(index *types.AddressIndex) []byte
 	// blockNumber
 	// blockNumber := blockNumberWidPad(index.BlockNumber.String())
 	// buf.Write([]byte(blockNumber))
+	// pseudo-transactions: 0 then the record type, a value never starts with 0 so records of transactions are unchanged
+	if index.RecordType != types.RecordTransaction {
+		buf.WriteByte(0)
+		buf.WriteByte(index.RecordType)
+	}
 	valueByteArr := index.Value.Bytes()
 	buf.Write(valueByteArr)
 	return buf.Bytes()
@@ -169,12 +175,18 @@ func (bm ByteMarshaller) UnmarshallAddressValue(value []byte) types.AddressIndex
 	// blockNumber := new(big.Int)
 	// blockNumber.SetString(blockNumberStr, 10)
 	prevIndex = index
+	recordType := types.RecordTransaction
+	if len(value) >= prevIndex+2 && value[prevIndex] == 0 {
+		recordType = value[prevIndex+1]
+		prevIndex += 2
+	}
 	txValueBI := new(big.Int)
 	txValueBI.SetBytes(value[prevIndex:])
 	result := types.AddressIndex{
 		TxHash:        txHash,
 		CoupleAddress: address,
 		Value:         txValueBI,
+		RecordType:    recordType,
 		// BlockNumber:   blockNumber,
 	}
 	return result
@@ -186,7 +198,15 @@ func (bm ByteMarshaller) MarshallBatchValue(updatedAt *big.Int, currentBlock *bi
 	// 4 byte
 	timeByteArr := common.MarshallTime(updatedAt)
 	buf.Write(timeByteArr)
+	// a batch that is not started yet has no current block
+	if currentBlock == nil {
+		return buf.Bytes()
+	}
 	blockNumberByteArr := currentBlock.Bytes()
+	if len(blockNumberByteArr) == 0 {
+		// block 0, distinguish it from a batch that is not started
+		blockNumberByteArr = []byte{0}
+	}
 	buf.Write(blockNumberByteArr)
 	return buf.Bytes()
 }
@@ -194,6 +214,9 @@ func (bm ByteMarshaller) MarshallBatchValue(updatedAt *big.Int, currentBlock *bi
 // UnmarshallBatchValue unmarshal value of key-value init batch status database
 func (bm ByteMarshaller) UnmarshallBatchValue(value []byte) types.BatchStatus {
 	timestamp := common.UnmarshallTimeToInt(value[:TimestampByteLength])
+	if len(value) <= TimestampByteLength {
+		return types.BatchStatus{UpdatedAt: timestamp}
+	}
 	currentBlock := new(big.Int)
 	currentBlock.SetBytes(value[TimestampByteLength:])
 	return types.BatchStatus{
@@ -254,6 +277,18 @@ func (bm ByteMarshaller) UnmarshallBlockKey(key []byte) *big.Int {
 	return result
 }
 
+// MarshallRangeBlock marshall a block number of the range db, 8 bytes big endian so ranges are sorted by block number
+func (bm ByteMarshaller) MarshallRangeBlock(blockNumber int64) []byte {
+	result := make([]byte, 8)
+	binary.BigEndian.PutUint64(result, uint64(blockNumber))
+	return result
+}
+
+// UnmarshallRangeBlock unmarshall a block number of the range db
+func (bm ByteMarshaller) UnmarshallRangeBlock(value []byte) int64 {
+	return int64(binary.BigEndian.Uint64(value))
+}
+
 func blockNumberWidPad(blockNumber string) string {
 	buf := &bytes.Buffer{}
 	if len(blockNumber) < BlockNumberMarshallLength {
@@ -76,7 +76,23 @@ func TestByteMarshallAddressValue(t *testing.T) {
 	assert.True(t, strings.EqualFold(addressIndex2.TxHash, addressIndex.TxHash))
 	assert.True(t, strings.EqualFold(addressIndex2.CoupleAddress, addressIndex.CoupleAddress))
 	assert.True(t, strings.EqualFold(addressIndex2.Value.String(), addressIndex.Value.String()))
+	assert.Equal(t, types.RecordTransaction, addressIndex2.RecordType)
 	// assert.Equal(t, blockNumber, addressIndex2.BlockNumber)
+
+	// pseudo-transactions keep their type, with any value
+	for _, value := range []*big.Int{big.NewInt(0), big.NewInt(2000000000000000000)} {
+		addressIndex.RecordType = types.RecordWithdrawal
+		addressIndex.Value = value
+		addressIndex2 = bm.UnmarshallAddressValue(bm.MarshallAddressValue(addressIndex))
+		assert.Equal(t, types.RecordWithdrawal, addressIndex2.RecordType)
+		assert.Equal(t, value, addressIndex2.Value)
+	}
+	// a zero value of a transaction
+	addressIndex.RecordType = types.RecordTransaction
+	addressIndex.Value = big.NewInt(0)
+	addressIndex2 = bm.UnmarshallAddressValue(bm.MarshallAddressValue(addressIndex))
+	assert.Equal(t, types.RecordTransaction, addressIndex2.RecordType)
+	assert.Equal(t, 0, addressIndex2.Value.Sign())
 }
 
 func TestMarshallBatchValue(t *testing.T) {
@@ -87,6 +103,13 @@ func TestMarshallBatchValue(t *testing.T) {
 	batchStatus := bm.UnmarshallBatchValue(value)
 	assert.True(t, batchStatus.UpdatedAt.Cmp(updatedAt) == 0)
 	assert.True(t, batchStatus.Current.Cmp(currentBlock) == 0)
+	// block 0 is different from a batch that is not started
+	value = bm.MarshallBatchValue(updatedAt, big.NewInt(0))
+	batchStatus = bm.UnmarshallBatchValue(value)
+	assert.Equal(t, int64(0), batchStatus.Current.Int64())
+	value = bm.MarshallBatchValue(updatedAt, nil)
+	batchStatus = bm.UnmarshallBatchValue(value)
+	assert.Nil(t, batchStatus.Current)
 }
 
 func TestMarshallBatchKey(t *testing.T) {
@@ -110,3 +133,10 @@ func TestMarshallBlockKey(t *testing.T) {
 	blockNumber := bm.UnmarshallBlockKey(key)
 	assert.Equal(t, blockNumberStr, blockNumber.String())
 }
+
+func TestMarshallRangeBlock(t *testing.T) {
+	bm := ByteMarshaller{}
+	assert.Equal(t, int64(3000000), bm.UnmarshallRangeBlock(bm.MarshallRangeBlock(3000000)))
+	// sorted by block number
+	assert.True(t, string(bm.MarshallRangeBlock(255)) < string(bm.MarshallRangeBlock(256)))
+}
@@ -26,4 +26,6 @@ type Marshaller interface {
 	MarshallAddressValue(index *types.AddressIndex) []byte
 	UnmarshallAddressKey(key []byte) (string, *big.Int)
 	UnmarshallAddressValue(value []byte) types.AddressIndex
+	MarshallRangeBlock(blockNumber int64) []byte
+	UnmarshallRangeBlock(value []byte) int64
 }
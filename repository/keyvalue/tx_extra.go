@@ -0,0 +1,53 @@
+package keyvalue
+
+import (
+	"encoding/json"
+
+	"github.com/WeTrustPlatform/account-indexer/core/types"
+	"github.com/WeTrustPlatform/account-indexer/repository"
+	"github.com/WeTrustPlatform/account-indexer/repository/keyvalue/dao"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	log "github.com/sirupsen/logrus"
+)
+
+// StoreExtrasIn implements IndexRepo, extras are stored as json by tx hash (32 bytes).
+// Extras of a reorged transaction are kept, they are the same if it's mined again
+func (repo *KVIndexRepo) StoreExtrasIn(wb repository.WriteBatch, extras map[string]*types.TransactionExtra) error {
+	batch, err := daoBatch(wb)
+	if err != nil {
+		return err
+	}
+	for txHash, extra := range extras {
+		key, err := hexutil.Decode(txHash)
+		if err != nil {
+			return err
+		}
+		value, err := json.Marshal(extra)
+		if err != nil {
+			return err
+		}
+		repo.extraDAO.PutTo(batch, dao.NewKeyValue(key, value))
+	}
+	return nil
+}
+
+// GetTransactionExtra implements IndexRepo
+func (repo *KVIndexRepo) GetTransactionExtra(txHash string) *types.TransactionExtra {
+	key, err := hexutil.Decode(txHash)
+	if err != nil {
+		return nil
+	}
+	keyValue, err := repo.extraDAO.FindByKey(key)
+	if err != nil || keyValue == nil {
+		return nil
+	}
+	extra := &types.TransactionExtra{}
+	if err := json.Unmarshal(keyValue.Value, extra); err != nil {
+		log.WithFields(log.Fields{
+			"txHash": txHash,
+			"error":  err.Error(),
+		}).Error("KVIndexRepo: cannot unmarshall transaction extra")
+		return nil
+	}
+	return extra
+}
@@ -0,0 +1,35 @@
+package keyvalue
+
+import (
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/WeTrustPlatform/account-indexer/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransactionExtras(t *testing.T) {
+	db, err := OpenDB(BackendLevelDb, filepath.Join(t.TempDir(), "db"))
+	assert.Nil(t, err)
+	defer db.Close()
+	repo, _ := db.ChainRepos("5")
+	extras := map[string]*types.TransactionExtra{
+		tx1: {Data: []byte{0xa9, 0x05}, Gas: 60000, GasPrice: big.NewInt(20000000000)},
+		// only gas is kept
+		tx2: {Gas: 21000},
+	}
+	wb := repo.NewWriteBatch()
+	assert.Nil(t, repo.StoreExtrasIn(wb, extras))
+	assert.Nil(t, repo.GetTransactionExtra(tx1))
+	assert.Nil(t, wb.Commit())
+	assert.Equal(t, extras[tx1], repo.GetTransactionExtra(tx1))
+	assert.Equal(t, extras[tx2], repo.GetTransactionExtra(tx2))
+	assert.Nil(t, repo.GetTransactionExtra("0x0000000000000000000000000000000000000000000000000000000000000003"))
+	assert.Nil(t, repo.GetTransactionExtra("not a hash"))
+	// extras are in the key space of the chain
+	defaultRepo, _ := db.Repos()
+	assert.Nil(t, defaultRepo.GetTransactionExtra(tx1))
+
+	assert.NotNil(t, repo.StoreExtrasIn(repo.NewWriteBatch(), map[string]*types.TransactionExtra{"not a hash": {}}))
+}
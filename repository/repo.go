@@ -1,27 +1,68 @@
 package repository
 
 import (
+	"context"
 	"math/big"
 	"time"
 
 	"github.com/WeTrustPlatform/account-indexer/core/types"
 )
 
+// WriteBatch writes of one or more repositories that are committed in one atomic write
+type WriteBatch interface {
+	Commit() error
+}
+
 // IndexRepo to store index data
 type IndexRepo interface {
+	NewWriteBatch() WriteBatch
 	Store(indexData []*types.AddressIndex, blockIndex *types.BlockIndex, isBatch bool) error
+	// StoreIn add index data of a block to wb, it's stored when wb is committed.
+	// A block that is not a batch block is added to the indexed ranges.
+	StoreIn(wb WriteBatch, indexData []*types.AddressIndex, blockIndex *types.BlockIndex, isBatch bool) error
 	GetTransactionByAddress(address string, rows int, start int, fromTime time.Time, toTime time.Time) (int, []types.AddressIndex)
 	GetTotalTransaction(address string, fromTime time.Time, toTime time.Time) int
+	// CountTransactions GetTotalTransaction that stops after reading budget records (0 for no limit) or when ctx is done,
+	// the total is partial and approximate is true then
+	CountTransactions(ctx context.Context, address string, fromTime time.Time, toTime time.Time, budget int) (total int, approximate bool)
+	// FindTransactions GetTransactionByAddress with the limits of CountTransactions
+	FindTransactions(ctx context.Context, address string, rows int, start int, fromTime time.Time, toTime time.Time, budget int) (total int, approximate bool, indexes []types.AddressIndex)
 	GetLastBlock() (types.BlockIndex, error)
 	GetFirstBlock() (types.BlockIndex, error)
 	DeleteOldBlocks(untilTime *big.Int) (int, error)
 	GetBlocks(blockNumber string, rows int, start int) (int, []types.BlockIndex)
 	SaveBlockIndex(blockIndex *types.BlockIndex) error
+	// GetAddressIndexesAt address records of an address at a block time, ordered by sequence
+	GetAddressIndexesAt(address string, blockTime *big.Int) []types.AddressIndex
+	// RepairAddressIndex save and delete address records in one atomic write
+	RepairAddressIndex(save []*types.AddressIndex, remove []types.AddressIndex) error
+	// GetIndexedRanges contiguous ranges of blocks indexed in realtime, ordered by block number
+	GetIndexedRanges() []types.BlockRange
+	// StoreExtrasIn add the kept fields of transactions by tx hash to wb, they are stored when wb is committed
+	StoreExtrasIn(wb WriteBatch, extras map[string]*types.TransactionExtra) error
+	// GetTransactionExtra the kept fields of a transaction, nil if they are not kept
+	GetTransactionExtra(txHash string) *types.TransactionExtra
+	// OnAddressesChanged listener is called with the addresses (lower case hex) whose address records are stored
+	// or deleted, after they are written
+	OnAddressesChanged(listener func(addresses []string))
 }
 
 // BatchRepo repository for batch status
 type BatchRepo interface {
+	NewWriteBatch() WriteBatch
 	GetAllBatchStatuses() []types.BatchStatus
 	UpdateBatch(batch types.BatchStatus) error
 	ReplaceBatch(from *big.Int, newTo *big.Int) error
+	// UpdateBatchIn add a batch update to wb, it's saved when wb is committed
+	UpdateBatchIn(wb WriteBatch, batch types.BatchStatus) error
+	// ReplaceBatchIn add a batch replacement to wb, it's saved when wb is committed
+	ReplaceBatchIn(wb WriteBatch, from *big.Int, newTo *big.Int) error
+}
+
+// APIKeyRepo repository for keys of the public api
+type APIKeyRepo interface {
+	GetAPIKeys() []types.APIKey
+	GetAPIKey(id string) (types.APIKey, error)
+	SaveAPIKey(key types.APIKey) error
+	DeleteAPIKey(id string) error
 }
@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/WeTrustPlatform/account-indexer/core/types"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// MaxScore score of a synced endpoint with peers and no latency
+	MaxScore = 100
+	// LagPenalty score lost per block behind the most advanced endpoint
+	LagPenalty = 5
+	// LatencyPenalty score lost per 100ms of probe latency, up to MaxLatencyPenalty
+	LatencyPenalty = 1
+	// MaxLatencyPenalty a slow endpoint is still better than an out of sync one
+	MaxLatencyPenalty = 50
+	// NoPeerPenalty score lost by an endpoint without peers, it will not get new blocks
+	NoPeerPenalty = 30
+	// SwitchMargin endpoints within this margin of the best score are considered as good as the best one
+	SwitchMargin = 10
+	// MinHealthyProbes consecutive successful probes before switching to an endpoint other than the current one
+	MinHealthyProbes = 3
+)
+
+// ProbeFunc get latest block and peer count (-1 if not supported) of an endpoint
+type ProbeFunc func(endpoint string) (latestBlock int64, peerCount int64, err error)
+
+// StartProbing probe all endpoints every interval and switch to the healthiest one until ctx is cancelled.
+// The first round is done before returning, so the indexer starts with the healthiest endpoint.
+func (im *IpcManager) StartProbing(ctx context.Context, probe ProbeFunc, interval time.Duration) {
+	im.mutex.Lock()
+	im.probe = probe
+	im.mutex.Unlock()
+	im.probeAll()
+	im.mutex.Lock()
+	if next := im.pick(); next != "" {
+		im.curIPC = next
+	}
+	log.WithField("ipc", im.curIPC).Info("IpcManager: Picked ipc after first probe")
+	im.mutex.Unlock()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				im.probeAll()
+				im.reselect()
+			}
+		}
+	}()
+}
+
+// GetEndpointStatuses statuses of all endpoints in the configured order
+func (im *IpcManager) GetEndpointStatuses() []types.EndpointStatus {
+	im.mutex.RLock()
+	defer im.mutex.RUnlock()
+	result := make([]types.EndpointStatus, len(im.statuses))
+	for i, status := range im.statuses {
+		status.Current = status.Endpoint == im.curIPC
+		result[i] = status
+	}
+	return result
+}
+
+// probeAll probe all endpoints concurrently then update their scores
+func (im *IpcManager) probeAll() {
+	roundStart := time.Now()
+	im.mutex.RLock()
+	probe := im.probe
+	results := append([]types.EndpointStatus{}, im.statuses...)
+	im.mutex.RUnlock()
+	wg := sync.WaitGroup{}
+	for i := range results {
+		wg.Add(1)
+		go func(status *types.EndpointStatus) {
+			defer wg.Done()
+			start := time.Now()
+			latestBlock, peerCount, err := probe(status.Endpoint)
+			status.LastProbe = time.Now()
+			status.Latency = status.LastProbe.Sub(start)
+			if err != nil {
+				status.LastError = err.Error()
+				status.Failures++
+				return
+			}
+			status.LatestBlock = latestBlock
+			status.PeerCount = peerCount
+			status.LastError = ""
+			status.Failures = 0
+		}(&results[i])
+	}
+	wg.Wait()
+
+	im.mutex.Lock()
+	defer im.mutex.Unlock()
+	for _, result := range results {
+		for i := range im.statuses {
+			// keep the failure if the endpoint is marked as failed during the probe
+			if im.statuses[i].Endpoint == result.Endpoint && !im.statuses[i].LastProbe.After(roundStart) {
+				im.statuses[i] = result
+			}
+		}
+	}
+	im.score()
+}
+
+// score compute score of all endpoints after a probe round, relative to the most advanced one
+func (im *IpcManager) score() {
+	bestBlock := int64(-1)
+	for _, status := range im.statuses {
+		if status.Failures == 0 && status.LatestBlock > bestBlock {
+			bestBlock = status.LatestBlock
+		}
+	}
+	for i := range im.statuses {
+		im.statuses[i].Score = Score(im.statuses[i], bestBlock)
+		if im.statuses[i].IsHealthy() {
+			im.statuses[i].Successes++
+		} else {
+			im.statuses[i].Successes = 0
+		}
+	}
+}
+
+// Score health score of an endpoint, 0 means the endpoint can't be used
+func Score(status types.EndpointStatus, bestBlock int64) float64 {
+	if status.Failures > 0 || status.LatestBlock < 0 {
+		return 0
+	}
+	latencyPenalty := float64(status.Latency/(100*time.Millisecond)) * LatencyPenalty
+	if latencyPenalty > MaxLatencyPenalty {
+		latencyPenalty = MaxLatencyPenalty
+	}
+	score := MaxScore - float64(bestBlock-status.LatestBlock)*LagPenalty - latencyPenalty
+	if status.PeerCount == 0 {
+		score -= NoPeerPenalty
+	}
+	if score < 0 {
+		return 0
+	}
+	return score
+}
+
+// markFailed an endpoint failed outside of probes, it's not used until it's probed successfully
+func (im *IpcManager) markFailed(ipc string, reason string) {
+	for i := range im.statuses {
+		if im.statuses[i].Endpoint == ipc {
+			im.statuses[i].LastError = reason
+			im.statuses[i].LastProbe = time.Now()
+			im.statuses[i].Failures++
+			im.statuses[i].Successes = 0
+			im.statuses[i].Score = 0
+		}
+	}
+}
+
+// pick the endpoint to use: the first one in the configured order that is as good as the best one, so it fails back
+// to preferred endpoints. An endpoint other than the current one needs MinHealthyProbes consecutive successful probes
+// unless it's the best one. "" if no endpoint is healthy.
+func (im *IpcManager) pick() string {
+	best := types.EndpointStatus{}
+	for _, status := range im.statuses {
+		if status.Score > best.Score {
+			best = status
+		}
+	}
+	if !best.IsHealthy() {
+		return ""
+	}
+	for _, status := range im.statuses {
+		if !status.IsHealthy() || status.Score < best.Score-SwitchMargin {
+			continue
+		}
+		if status.Endpoint == im.curIPC || status.Successes >= MinHealthyProbes {
+			return status.Endpoint
+		}
+	}
+	return best.Endpoint
+}
+
+// reselect switch to the picked endpoint after a probe round
+func (im *IpcManager) reselect() {
+	im.mutex.Lock()
+	next := im.pick()
+	degraded := im.degraded
+	if next == "" || (next == im.curIPC && !degraded) {
+		im.mutex.Unlock()
+		return
+	}
+	if !degraded && atomic.LoadInt32(&im.switchIPCCounter) > 0 {
+		// subscribers are not done with the last switch
+		im.mutex.Unlock()
+		return
+	}
+	im.degraded = false
+	im.mutex.Unlock()
+	log.WithFields(log.Fields{
+		"from":     im.GetIPC(),
+		"to":       next,
+		"degraded": degraded,
+	}).Info("IpcManager: Switching to healthier ipc")
+	atomic.AddInt32(&im.switchIPCCounter, 1)
+	// subscribers can block for a long time
+	go im.switchTo(next)
+}
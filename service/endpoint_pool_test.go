@@ -0,0 +1,128 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/WeTrustPlatform/account-indexer/core/types"
+)
+
+// mockNodes latest block and error of each endpoint
+type mockNodes struct {
+	mutex  sync.Mutex
+	blocks map[string]int64
+	errs   map[string]error
+}
+
+func (mn *mockNodes) probe(endpoint string) (int64, int64, error) {
+	mn.mutex.Lock()
+	defer mn.mutex.Unlock()
+	if err := mn.errs[endpoint]; err != nil {
+		return -1, -1, err
+	}
+	return mn.blocks[endpoint], 10, nil
+}
+
+func (mn *mockNodes) set(endpoint string, block int64, err error) {
+	mn.mutex.Lock()
+	defer mn.mutex.Unlock()
+	mn.blocks[endpoint] = block
+	mn.errs[endpoint] = err
+}
+
+type mockSubscriber struct {
+	updated chan string
+}
+
+func (ms *mockSubscriber) IpcUpdated(ipc string) {
+	ms.updated <- ipc
+}
+
+func (ms *mockSubscriber) Name() string {
+	return "mockSubscriber"
+}
+
+func newTestManager(t *testing.T, nodes *mockNodes, ipcs ...string) (*IpcManager, *mockSubscriber) {
+	im := &IpcManager{}
+	assert.Nil(t, im.SetIPC(ipcs))
+	sub := &mockSubscriber{updated: make(chan string, 10)}
+	var ipcSub IpcSubscriber = sub
+	im.Subscribe(&ipcSub)
+	// probing is driven by the test
+	im.probe = nodes.probe
+	return im, sub
+}
+
+func TestScore(t *testing.T) {
+	status := types.EndpointStatus{LatestBlock: 100, PeerCount: 10, Latency: 50 * time.Millisecond}
+	assert.Equal(t, float64(MaxScore), Score(status, 100))
+	assert.Equal(t, float64(MaxScore-2*LagPenalty), Score(status, 102))
+	status.Latency = 350 * time.Millisecond
+	assert.Equal(t, float64(MaxScore-3*LatencyPenalty), Score(status, 100))
+	status.PeerCount = 0
+	assert.Equal(t, float64(MaxScore-3*LatencyPenalty-NoPeerPenalty), Score(status, 100))
+	// too far behind
+	assert.Equal(t, float64(0), Score(status, 1000))
+	status.Failures = 1
+	assert.Equal(t, float64(0), Score(status, 100))
+}
+
+func TestPickAndFailBack(t *testing.T) {
+	nodes := &mockNodes{blocks: map[string]int64{"ipc1": 100, "ipc2": 100}, errs: map[string]error{}}
+	im, sub := newTestManager(t, nodes, "ipc1", "ipc2")
+	im.probeAll()
+	assert.Equal(t, "ipc1", im.pick())
+
+	// ipc1 is out of sync
+	nodes.set("ipc1", 50, nil)
+	im.probeAll()
+	im.reselect()
+	assert.Equal(t, "ipc2", <-sub.updated)
+	assert.Equal(t, "ipc2", im.GetIPC())
+	im.EnableSwitchIPC()
+
+	// ipc1 is synced again, fail back after it's healthy for a few probes
+	nodes.set("ipc1", 100, nil)
+	im.probeAll()
+	assert.Equal(t, "ipc2", im.pick())
+	for i := 1; i < MinHealthyProbes; i++ {
+		im.probeAll()
+	}
+	im.reselect()
+	assert.Equal(t, "ipc1", <-sub.updated)
+	statuses := im.GetEndpointStatuses()
+	assert.True(t, statuses[0].Current)
+	assert.False(t, statuses[1].Current)
+}
+
+func TestChangeIPCSingleEndpoint(t *testing.T) {
+	nodes := &mockNodes{blocks: map[string]int64{"ipc1": 100}, errs: map[string]error{}}
+	im, sub := newTestManager(t, nodes, "ipc1")
+	im.probeAll()
+	nodes.set("ipc1", 100, errors.New("connection refused"))
+	// should not panic, wait for the endpoint to recover
+	im.ForceChangeIPC()
+	assert.True(t, im.degraded)
+	assert.Equal(t, 0, len(sub.updated))
+	im.probeAll()
+	im.reselect()
+	assert.Equal(t, 0, len(sub.updated))
+
+	nodes.set("ipc1", 101, nil)
+	im.probeAll()
+	im.reselect()
+	// reconnect to the same endpoint
+	assert.Equal(t, "ipc1", <-sub.updated)
+	assert.False(t, im.degraded)
+}
+
+func TestChangeIPCWithoutProbe(t *testing.T) {
+	im := &IpcManager{}
+	assert.Nil(t, im.SetIPC([]string{"ipc1", "ipc2"}))
+	im.ChangeIPC()
+	assert.Equal(t, "ipc2", im.GetIPC())
+}
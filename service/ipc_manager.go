@@ -2,25 +2,46 @@ package service
 
 import (
 	"errors"
-	"strconv"
+	"net/url"
+	"strings"
 	"sync"
 	"sync/atomic"
 
+	"github.com/WeTrustPlatform/account-indexer/core/types"
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	// TransportIPC unix socket or windows named pipe
+	TransportIPC = "ipc"
+	// TransportHTTP plain json-rpc over http(s), it does not support subscription
+	TransportHTTP = "http"
+	// TransportWS json-rpc over websocket
+	TransportWS = "ws"
+	// maxDisagreements number of recent disagreements to keep per chain
+	maxDisagreements = 100
+)
+
 // IpcSubscriber interface for subscribers
 type IpcSubscriber interface {
 	IpcUpdated(ipc string)
 	Name() string
 }
 
-// IpcManager has the global IPC, it takes care of informing all fetcher when IPC is changed
+// IpcManager has the IPC of a chain, it takes care of informing all fetcher when IPC is changed.
+// Once probing is started, the IPC is picked from a pool of endpoints by their health score, see endpoint_pool.go
 type IpcManager struct {
+	mutex            sync.RWMutex
 	ipcList          []string
 	curIPC           string
 	subscribers      []*IpcSubscriber
 	switchIPCCounter int32
+	statuses         []types.EndpointStatus
+	probe            ProbeFunc
+	// degraded the current IPC failed and there was no healthy endpoint to switch to
+	degraded bool
+	// disagreements recent blocks that endpoints did not agree on in quorum mode, the oldest first
+	disagreements []types.Disagreement
 }
 
 var ipcManager *IpcManager
@@ -28,6 +49,8 @@ var once sync.Once
 
 // Subscribe method for a subscriber to call
 func (im *IpcManager) Subscribe(sub *IpcSubscriber) {
+	im.mutex.Lock()
+	defer im.mutex.Unlock()
 	for _, oldSub := range im.subscribers {
 		if oldSub == sub {
 			log.WithField("subscription", (*sub).Name()).Info("IpcManager: Already has the subscription no need to subscribe again")
@@ -39,35 +62,85 @@ func (im *IpcManager) Subscribe(sub *IpcSubscriber) {
 
 // GetIPC getter for ipc
 func (im *IpcManager) GetIPC() string {
+	im.mutex.RLock()
+	defer im.mutex.RUnlock()
 	return im.curIPC
 }
 
 // SetIPC gets called from main
 func (im *IpcManager) SetIPC(ipcs []string) error {
+	statuses, err := newStatuses(ipcs)
+	if err != nil {
+		return err
+	}
+	im.mutex.Lock()
+	defer im.mutex.Unlock()
+	im.ipcList = ipcs
+	im.statuses = statuses
+	im.curIPC = im.ipcList[0]
+	log.WithField("ipc", im.curIPC).Info("IpcManager: Initial ipc")
+	return nil
+}
+
+// UpdateIPC replace the endpoints while indexing, endpoints that are kept keep their health.
+// If the current IPC is removed, it switches to the first endpoint and informs all subscribers.
+func (im *IpcManager) UpdateIPC(ipcs []string) error {
+	statuses, err := newStatuses(ipcs)
+	if err != nil {
+		return err
+	}
+	im.mutex.Lock()
+	for i := range statuses {
+		for _, old := range im.statuses {
+			if old.Endpoint == statuses[i].Endpoint {
+				statuses[i] = old
+			}
+		}
+	}
+	im.ipcList = ipcs
+	im.statuses = statuses
+	removed := true
+	for _, ipc := range ipcs {
+		if ipc == im.curIPC {
+			removed = false
+		}
+	}
+	im.mutex.Unlock()
+	log.WithField("ipcList", ipcs).Info("IpcManager: Updated ipc list")
+	if removed {
+		atomic.AddInt32(&im.switchIPCCounter, 1)
+		// subscribers can block for a long time
+		go im.switchTo(ipcs[0])
+	}
+	return nil
+}
+
+// newStatuses validate endpoints and create their initial statuses
+func newStatuses(ipcs []string) ([]types.EndpointStatus, error) {
 	if len(ipcs) == 0 {
-		return errors.New("no ipc specified")
+		return nil, errors.New("no ipc specified")
 	}
 	tmp := map[string]string{}
+	statuses := []types.EndpointStatus{}
 	for _, ipc := range ipcs {
 		if ipc == "" {
-			return errors.New("blank ipc")
+			return nil, errors.New("blank ipc")
+		}
+		transport, err := GetTransport(ipc)
+		if err != nil {
+			return nil, err
 		}
 		if tmp[ipc] != "" {
-			return errors.New("duplicate IPC: " + ipc)
+			return nil, errors.New("duplicate IPC: " + ipc)
 		}
 		tmp[ipc] = ipc
+		statuses = append(statuses, types.EndpointStatus{Endpoint: ipc, Transport: transport, LatestBlock: -1, PeerCount: -1})
 	}
-	im.ipcList = ipcs
-	im.curIPC = im.ipcList[0]
-	log.WithField("ipc", im.curIPC).Info("IpcManager: Initial ipc")
-	return nil
+	return statuses, nil
 }
 
-// ForceChangeIPC force change ipc, otherwise panic
+// ForceChangeIPC change ipc after an error of the current one, same as ChangeIPC
 func (im *IpcManager) ForceChangeIPC() {
-	if len(im.ipcList) <= 1 {
-		panic(errors.New("IpcManager: Cannot switch IPC, number of IPC = " + strconv.Itoa(len(im.ipcList))))
-	}
 	im.ChangeIPC()
 }
 
@@ -77,7 +150,8 @@ func (im *IpcManager) EnableSwitchIPC() {
 	atomic.StoreInt32(&im.switchIPCCounter, 0)
 }
 
-// ChangeIPC change IPC and inform all subscribers about the change
+// ChangeIPC mark the current IPC as failed, change to the healthiest endpoint and inform all subscribers about the change.
+// Without a healthy endpoint, the switch is done by the next probe that finds one, even if it's the same IPC.
 func (im *IpcManager) ChangeIPC() {
 	atomic.AddInt32(&im.switchIPCCounter, 1)
 	counter := atomic.LoadInt32(&im.switchIPCCounter)
@@ -86,21 +160,64 @@ func (im *IpcManager) ChangeIPC() {
 		return
 	}
 	log.Info("IpcManager: Attempt to change IPC...")
-	if len(im.ipcList) <= 1 {
-		log.WithField("ipcList", im.ipcList).Info("IpcManager: Cannot change ipc")
+	im.mutex.Lock()
+	next := ""
+	if im.probe == nil {
+		// no health information, rotate
+		if len(im.ipcList) > 1 {
+			next = NextIPC(im.curIPC, im.ipcList)
+		}
+	} else {
+		im.markFailed(im.curIPC, "switch requested")
+		next = im.pick()
+		im.degraded = next == ""
+	}
+	im.mutex.Unlock()
+	if next == "" {
+		log.WithField("ipcList", im.ipcList).Warn("IpcManager: Cannot change ipc, no healthy endpoint")
+		// no switch is in progress, the next error should try again
+		atomic.StoreInt32(&im.switchIPCCounter, 0)
 		return
 	}
-	im.curIPC = NextIPC(im.curIPC, im.ipcList)
+	im.switchTo(next)
+}
+
+// switchTo set the current IPC and inform all subscribers, it blocks until all subscribers are updated
+func (im *IpcManager) switchTo(ipc string) {
+	im.mutex.Lock()
+	im.curIPC = ipc
+	subscribers := append([]*IpcSubscriber{}, im.subscribers...)
+	im.mutex.Unlock()
 	log.WithFields(log.Fields{
-		"curIPC":         im.curIPC,
-		"numSubscribers": len(im.subscribers),
+		"curIPC":         ipc,
+		"numSubscribers": len(subscribers),
 	}).Info("IPCManager: ChangeIPC")
-	for _, sub := range im.subscribers {
+	for _, sub := range subscribers {
 		log.WithField("ipc", (*sub).Name()).Info("IpcManager: Updating new ipc")
-		(*sub).IpcUpdated(im.curIPC)
+		(*sub).IpcUpdated(ipc)
 	}
 }
 
+// GetTransport detect transport of an endpoint from its url scheme, endpoints without scheme are ipc paths
+func GetTransport(endpoint string) (string, error) {
+	if !strings.Contains(endpoint, "://") {
+		return TransportIPC, nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return TransportHTTP, nil
+	case "ws", "wss":
+		return TransportWS, nil
+	case "ipc":
+		return TransportIPC, nil
+	}
+	return "", errors.New("unsupported scheme of endpoint: " + endpoint)
+}
+
 // NextIPC get next ipc from a list
 func NextIPC(curIPC string, ipcList []string) string {
 	index := 0
@@ -114,10 +231,36 @@ func NextIPC(curIPC string, ipcList []string) string {
 	return ipcList[newIndex]
 }
 
-// GetIpcManager singleton impl
+// AddDisagreement keep a block that endpoints of the chain did not agree on, only the latest ones are kept
+func (im *IpcManager) AddDisagreement(disagreement types.Disagreement) {
+	im.mutex.Lock()
+	defer im.mutex.Unlock()
+	im.disagreements = append(im.disagreements, disagreement)
+	if len(im.disagreements) > maxDisagreements {
+		im.disagreements = im.disagreements[len(im.disagreements)-maxDisagreements:]
+	}
+}
+
+// GetDisagreements recent blocks that endpoints of the chain did not agree on, the latest first
+func (im *IpcManager) GetDisagreements() []types.Disagreement {
+	im.mutex.RLock()
+	defer im.mutex.RUnlock()
+	result := make([]types.Disagreement, len(im.disagreements))
+	for i, disagreement := range im.disagreements {
+		result[len(im.disagreements)-1-i] = disagreement
+	}
+	return result
+}
+
+// NewIpcManager create an IpcManager for the endpoints of a chain
+func NewIpcManager() *IpcManager {
+	return &IpcManager{subscribers: []*IpcSubscriber{}}
+}
+
+// GetIpcManager singleton impl, the IpcManager of the default chain
 func GetIpcManager() *IpcManager {
 	once.Do(func() {
-		ipcManager = &IpcManager{subscribers: []*IpcSubscriber{}}
+		ipcManager = NewIpcManager()
 	})
 	return ipcManager
 }
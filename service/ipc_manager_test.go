@@ -1,8 +1,11 @@
 package service
 
 import (
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/WeTrustPlatform/account-indexer/core/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -21,17 +24,20 @@ func TestSetIPC(t *testing.T) {
 	assert.NotNil(t, err)
 	err = im.SetIPC([]string{"ipc1", ""})
 	assert.NotNil(t, err)
+	err = im.SetIPC([]string{"ipc1", "ftp://localhost"})
+	assert.NotNil(t, err)
 	err = im.SetIPC([]string{"ipc1", "ipc2"})
 	assert.Nil(t, err)
 	assert.Equal(t, "ipc1", im.curIPC)
 }
 
 type IpcSubscriberImpl struct {
-	count int
+	// count is updated by the goroutine that switches the ipc
+	count int32
 }
 
 func (is *IpcSubscriberImpl) IpcUpdated(ipc string) {
-	is.count++
+	atomic.AddInt32(&is.count, 1)
 }
 
 func (is *IpcSubscriberImpl) Name() string {
@@ -43,13 +49,80 @@ func TestChangeIPC(t *testing.T) {
 	err := im.SetIPC([]string{"ipc1", "ipc2"})
 	assert.Nil(t, err)
 	sub := IpcSubscriberImpl{}
-	assert.Equal(t, 0, sub.count)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&sub.count))
 	var tmp IpcSubscriber = &sub
 	im.Subscribe(&tmp)
 	im.EnableSwitchIPC()
 	im.ChangeIPC()
-	assert.Equal(t, 1, sub.count)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&sub.count))
+	im.EnableSwitchIPC()
+	im.ChangeIPC()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&sub.count))
+}
+
+func TestUpdateIPC(t *testing.T) {
+	im := NewIpcManager()
+	assert.Nil(t, im.SetIPC([]string{"ipc1", "ipc2"}))
+	im.statuses[1].Failures = 3
+	sub := IpcSubscriberImpl{}
+	var tmp IpcSubscriber = &sub
+	im.Subscribe(&tmp)
+	assert.NotNil(t, im.UpdateIPC(nil))
+
+	// the current ipc is kept, so is the health of ipc2
+	assert.Nil(t, im.UpdateIPC([]string{"ipc3", "ipc2", "ipc1"}))
+	assert.Equal(t, "ipc1", im.GetIPC())
+	statuses := im.GetEndpointStatuses()
+	assert.Equal(t, 3, len(statuses))
+	assert.Equal(t, 3, statuses[1].Failures)
+
+	// the current ipc is removed
+	im.EnableSwitchIPC()
+	assert.Nil(t, im.UpdateIPC([]string{"ipc2", "ipc3"}))
+	assert.Eventually(t, func() bool {
+		return im.GetIPC() == "ipc2"
+	}, time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&sub.count) == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestGetTransport(t *testing.T) {
+	endpoints := map[string]string{
+		"/data/geth.ipc":          TransportIPC,
+		"ipc:///data/geth.ipc":    TransportIPC,
+		"http://localhost:8545":   TransportHTTP,
+		"https://node.io/v3/key":  TransportHTTP,
+		"ws://localhost:8546":     TransportWS,
+		"wss://node.io/ws/v3/key": TransportWS,
+	}
+	for endpoint, transport := range endpoints {
+		result, err := GetTransport(endpoint)
+		assert.Nil(t, err)
+		assert.Equal(t, transport, result, endpoint)
+	}
+	_, err := GetTransport("ftp://localhost")
+	assert.NotNil(t, err)
+}
+
+func TestDisagreements(t *testing.T) {
+	im := NewIpcManager()
+	for i := 0; i < maxDisagreements+5; i++ {
+		im.AddDisagreement(types.Disagreement{BlockNumber: int64(i)})
+	}
+	disagreements := im.GetDisagreements()
+	assert.Equal(t, maxDisagreements, len(disagreements))
+	assert.Equal(t, int64(maxDisagreements+4), disagreements[0].BlockNumber)
+	assert.Equal(t, int64(5), disagreements[maxDisagreements-1].BlockNumber)
+	assert.Equal(t, 0, len(NewIpcManager().GetDisagreements()))
+}
+
+func TestChangeIPCWithoutOtherEndpoint(t *testing.T) {
+	im := NewIpcManager()
+	assert.Nil(t, im.SetIPC([]string{"ipc1"}))
 	im.EnableSwitchIPC()
 	im.ChangeIPC()
-	assert.Equal(t, 2, sub.count)
+	// nothing to switch to, the next error is not ignored
+	assert.Equal(t, int32(0), atomic.LoadInt32(&im.switchIPCCounter))
+	assert.Equal(t, "ipc1", im.GetIPC())
 }
@@ -46,14 +46,20 @@ func TestContractCreation(t *testing.T) {
 	t.Logf("TestContractCreation found transaction at %v \n", tm)
 }
 
-func NewTestIndexer() indexer.Indexer {
+func NewTestIndexer() *indexer.Indexer {
 	addressDB := memdb.New(comparer.DefaultComparer, 0)
 	addressDAO := dao.NewMemDbDAO(addressDB)
 	blockDB := memdb.New(comparer.DefaultComparer, 0)
 	blockDAO := dao.NewMemDbDAO(blockDB)
+	rangeDB := memdb.New(comparer.DefaultComparer, 0)
+	rangeDAO := dao.NewMemDbDAO(rangeDB)
+	counterDB := memdb.New(comparer.DefaultComparer, 0)
+	counterDAO := dao.NewMemDbDAO(counterDB)
+	extraDB := memdb.New(comparer.DefaultComparer, 0)
+	extraDAO := dao.NewMemDbDAO(extraDB)
 	batchDB := memdb.New(comparer.DefaultComparer, 0)
 	batchDAO := dao.NewMemDbDAO(batchDB)
-	indexRepo := keyvalue.NewKVIndexRepo(addressDAO, blockDAO)
+	indexRepo := keyvalue.NewKVIndexRepo(addressDAO, blockDAO, rangeDAO, counterDAO, extraDAO)
 	batchRepo := keyvalue.NewKVBatchRepo(batchDAO)
 	idx := indexer.NewIndexer(indexRepo, batchRepo, nil)
 	return idx
@@ -1,6 +1,7 @@
 package watcher
 
 import (
+	"context"
 	"time"
 
 	"github.com/WeTrustPlatform/account-indexer/common"
@@ -13,48 +14,64 @@ import (
 
 // Watcher interface for Watch()
 type Watcher interface {
-	Watch()
+	Watch(ctx context.Context)
 }
 
 // NodeStatusWatcher watch status of geth node
 type NodeStatusWatcher struct {
 	indexRepo  repository.IndexRepo
 	batchRepo  repository.BatchRepo
+	ipcManager *service.IpcManager
 	isWatching bool
 }
 
-// NewNodeStatusWatcher create NodeStatusWatcher
-func NewNodeStatusWatcher(indexRepo repository.IndexRepo, batchRepo repository.BatchRepo) NodeStatusWatcher {
-	return NodeStatusWatcher{indexRepo: indexRepo, batchRepo: batchRepo}
+// NewNodeStatusWatcher create NodeStatusWatcher, the ipc of ipcManager is changed when the node is out of date
+func NewNodeStatusWatcher(indexRepo repository.IndexRepo, batchRepo repository.BatchRepo, ipcManager *service.IpcManager) NodeStatusWatcher {
+	return NodeStatusWatcher{indexRepo: indexRepo, batchRepo: batchRepo, ipcManager: ipcManager}
 }
 
-// Watch entry point of this struct
-func (n *NodeStatusWatcher) Watch() {
+// Watch entry point of this struct, it returns when ctx is cancelled or the ipc needs to be changed
+func (n *NodeStatusWatcher) Watch(ctx context.Context) {
 	if n.isWatching {
 		// Don't start new ticker again
 		log.Info("Watcher: waching, no need to watch again")
 		return
 	}
 	n.isWatching = true
-	ticker := time.NewTicker(config.GetConfig().WatcherInterval)
-	for t := range ticker.C {
-		log.WithField("ticket", t).Info("Watcher: Watch geth node status")
-		n.watch(ticker)
+	defer func() { n.isWatching = false }()
+	interval := config.GetConfig().GetWatcherInterval()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("Watcher: Stopped")
+			return
+		case t := <-ticker.C:
+			// the interval can change on reload
+			if newInterval := config.GetConfig().GetWatcherInterval(); newInterval != interval {
+				interval = newInterval
+				ticker.Reset(interval)
+			}
+			log.WithField("ticket", t).Info("Watcher: Watch geth node status")
+			if n.watch() {
+				// TODO: update event database
+				// the indexer waits for this goroutine when the ipc is changed
+				go n.ipcManager.ChangeIPC()
+				return
+			}
+		}
 	}
 }
 
-func (n *NodeStatusWatcher) watch(ticker *time.Ticker) {
+// watch whether the ipc should be changed
+func (n *NodeStatusWatcher) watch() bool {
 	lastBlock, err := n.indexRepo.GetLastBlock()
 	if err != nil {
 		log.WithField("error", err.Error).Error("Watcher.watch error")
-		return
-	}
-	if shouldChangeIPC(lastBlock) {
-		n.isWatching = false
-		ticker.Stop()
-		// TODO: update event database
-		service.GetIpcManager().ChangeIPC()
+		return false
 	}
+	return shouldChangeIPC(lastBlock)
 }
 
 func shouldChangeIPC(lastBlock types.BlockIndex) bool {
@@ -1,6 +1,7 @@
 package watcher
 
 import (
+	"context"
 	"math/big"
 	"testing"
 	"time"
@@ -43,3 +44,20 @@ func TestShouldChangeIPC(t *testing.T) {
 	change = shouldChangeIPC(lastBlock)
 	assert.True(t, change)
 }
+
+func TestWatchStop(t *testing.T) {
+	config.GetConfig().WatcherInterval = time.Hour
+	watcher := NewNodeStatusWatcher(nil, nil, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		watcher.Watch(ctx)
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("Watch should return after cancel")
+	}
+}
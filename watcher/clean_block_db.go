@@ -1,6 +1,7 @@
 package watcher
 
 import (
+	"context"
 	"math/big"
 	"time"
 
@@ -20,13 +21,26 @@ func NewCleaner(repo repository.IndexRepo) Cleaner {
 	return Cleaner{repo: repo}
 }
 
-// CleanBlockDB clean block db regularly
-func (c Cleaner) CleanBlockDB() {
+// CleanBlockDB clean block db regularly until ctx is cancelled
+func (c Cleaner) CleanBlockDB(ctx context.Context) {
 	// Clean every 5 minute -> 5*60/15 ~ 20 blocks
-	ticker := time.NewTicker(config.GetConfig().CleanInterval)
-	for t := range ticker.C {
-		log.WithField("ticker", t).Info("Cleaner: Clean Block DB")
-		c.cleanBlockDB()
+	interval := config.GetConfig().GetCleanInterval()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("Cleaner: Stopped")
+			return
+		case t := <-ticker.C:
+			// the interval can change on reload
+			if newInterval := config.GetConfig().GetCleanInterval(); newInterval != interval {
+				interval = newInterval
+				ticker.Reset(interval)
+			}
+			log.WithField("ticker", t).Info("Cleaner: Clean Block DB")
+			c.cleanBlockDB()
+		}
 	}
 }
 